@@ -0,0 +1,207 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var ErrAccountExists = errors.New("account already exists")
+var ErrBadCredentials = errors.New("incorrect user name or password")
+var ErrKeyRegistered = errors.New("key already registered")
+
+// Passwords shorter than this are turned away at registration.
+var MIN_PASSWORD_LENGTH = 8
+
+// Store keeps track of registered user names and their hashed passwords.  Names are matched ignoring case, the same
+//	way the chat store matches them, so registering `Han` also covers `HAN` and `han`.  Accounts can belong to an SSH
+//	key (by its fingerprint) instead of a password, in which case whoever holds the key is the account's owner.
+type Store interface {
+	Register(name, password string) error
+	Authenticate(name, password string) error
+	Exists(name string) bool
+	RegisterKey(name, fingerprint string) error
+	FindByKey(fingerprint string) (string, bool)
+}
+
+type account struct {
+	Name           string `json:"name"`
+	PasswordHash   []byte `json:"password_hash,omitempty"`
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
+}
+
+// How hard bcrypt works at hashing each password - account and room passwords alike.  Tests can turn this down to
+//	`bcrypt.MinCost` to speed up.
+var HashCost = bcrypt.DefaultCost
+
+func HashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), HashCost)
+}
+
+// MemoryStore is the default account Store.  Accounts only live as long as the server does.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	accounts map[string]account
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts: map[string]account{},
+	}
+}
+
+func (s *MemoryStore) Register(name, password string) error {
+	if utf8.RuneCountInString(password) < MIN_PASSWORD_LENGTH {
+		return fmt.Errorf("passwords must be at least %d characters long", MIN_PASSWORD_LENGTH)
+	}
+	// Hash before taking the lock - bcrypt is slow on purpose, and there's no need to hold everyone else up.
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.accounts[key(name)]; found {
+		return ErrAccountExists
+	}
+	s.accounts[key(name)] = account{Name: name, PasswordHash: hash}
+	return nil
+}
+
+func (s *MemoryStore) Authenticate(name, password string) error {
+	s.mu.RLock()
+	acc, found := s.accounts[key(name)]
+	s.mu.RUnlock()
+	if !found {
+		return ErrBadCredentials
+	}
+	if bcrypt.CompareHashAndPassword(acc.PasswordHash, []byte(password)) != nil {
+		return ErrBadCredentials
+	}
+	return nil
+}
+
+func (s *MemoryStore) Exists(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, found := s.accounts[key(name)]
+	return found
+}
+
+// Register the name to an SSH key rather than a password.  Each key only ever gets one account, so it always comes
+//	back to the same name.
+func (s *MemoryStore) RegisterKey(name, fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.accounts[key(name)]; found {
+		return ErrAccountExists
+	}
+	for _, acc := range s.accounts {
+		if acc.KeyFingerprint == fingerprint {
+			return ErrKeyRegistered
+		}
+	}
+	s.accounts[key(name)] = account{Name: name, KeyFingerprint: fingerprint}
+	return nil
+}
+
+// Find the name of the account the SSH key belongs to, if it has one.
+func (s *MemoryStore) FindByKey(fingerprint string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, acc := range s.accounts {
+		if fingerprint != "" && acc.KeyFingerprint == fingerprint {
+			return acc.Name, true
+		}
+	}
+	return "", false
+}
+
+// FileStore is a MemoryStore that writes every new account out to a JSON file, and reads them all back in again when
+//	it is created, so accounts survive a restart.
+type FileStore struct {
+	*MemoryStore
+	Path string
+	// Only one registration writes to the file at a time, so they can't overwrite each other.
+	writeMu sync.Mutex
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), Path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	accountList := []account{}
+	err = json.Unmarshal(data, &accountList)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read accounts file %s: %v", path, err)
+	}
+	for _, acc := range accountList {
+		s.accounts[key(acc.Name)] = acc
+	}
+	return s, nil
+}
+
+func (s *FileStore) Register(name, password string) error {
+	err := s.MemoryStore.Register(name, password)
+	if err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *FileStore) RegisterKey(name, fingerprint string) error {
+	err := s.MemoryStore.RegisterKey(name, fingerprint)
+	if err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// Write the whole set of accounts out to a temp file and then move it over the real one, so a crash halfway through
+//	can never leave us with a half written accounts file.
+func (s *FileStore) save() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.mu.RLock()
+	accountList := make([]account, 0, len(s.accounts))
+	for _, acc := range s.accounts {
+		accountList = append(accountList, acc)
+	}
+	s.mu.RUnlock()
+
+	data, err := json.MarshalIndent(accountList, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+func key(name string) string {
+	return strings.ToLower(name)
+}
@@ -0,0 +1,148 @@
+package accounts
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Turn password hashing right down for the length of a test.
+func useFastHashing(t *testing.T) {
+	previous := HashCost
+	HashCost = bcrypt.MinCost
+	t.Cleanup(func() { HashCost = previous })
+}
+
+func newTestStore(t *testing.T) *MemoryStore {
+	useFastHashing(t)
+	return NewMemoryStore()
+}
+
+func Test_MemoryStore_Register_success(t *testing.T) {
+	s := newTestStore(t)
+
+	err := s.Register("Han Solo", "kessel-run")
+
+	assert.Nil(t, err)
+	assert.True(t, s.Exists("Han Solo"))
+	assert.True(t, s.Exists("HAN SOLO"))
+	assert.NotEqual(t, []byte("kessel-run"), s.accounts["han solo"].PasswordHash)
+}
+
+func Test_MemoryStore_Register_already_exists(t *testing.T) {
+	s := newTestStore(t)
+	s.Register("Han Solo", "kessel-run")
+
+	err := s.Register("han solo", "12-parsecs")
+
+	assert.Equal(t, ErrAccountExists, err)
+	assert.Nil(t, s.Authenticate("Han Solo", "kessel-run"))
+}
+
+func Test_MemoryStore_Register_password_too_short(t *testing.T) {
+	s := newTestStore(t)
+
+	err := s.Register("Han Solo", "solo")
+
+	assert.Equal(t, "passwords must be at least 8 characters long", fmt.Sprint(err))
+	assert.False(t, s.Exists("Han Solo"))
+}
+
+func Test_MemoryStore_Authenticate(t *testing.T) {
+	s := newTestStore(t)
+	s.Register("Han Solo", "kessel-run")
+
+	assert.Nil(t, s.Authenticate("Han Solo", "kessel-run"))
+	assert.Nil(t, s.Authenticate("han solo", "kessel-run"))
+	assert.Equal(t, ErrBadCredentials, s.Authenticate("Han Solo", "Kessel-Run"))
+	assert.Equal(t, ErrBadCredentials, s.Authenticate("Greedo", "kessel-run"))
+}
+
+func Test_MemoryStore_RegisterKey(t *testing.T) {
+	s := newTestStore(t)
+	s.Register("Lando", "cloud-city")
+
+	assert.Nil(t, s.RegisterKey("Han Solo", "SHA256:falcon"))
+	assert.Equal(t, ErrAccountExists, s.RegisterKey("han solo", "SHA256:other"))
+	assert.Equal(t, ErrAccountExists, s.RegisterKey("Lando", "SHA256:other"))
+	assert.Equal(t, ErrKeyRegistered, s.RegisterKey("Chewbacca", "SHA256:falcon"))
+	assert.True(t, s.Exists("HAN SOLO"))
+	assert.False(t, s.Exists("Chewbacca"))
+	// There's no password to get in with.
+	assert.Equal(t, ErrBadCredentials, s.Authenticate("Han Solo", ""))
+}
+
+func Test_MemoryStore_FindByKey(t *testing.T) {
+	s := newTestStore(t)
+	s.Register("Lando", "cloud-city")
+	s.RegisterKey("Han Solo", "SHA256:falcon")
+
+	name, found := s.FindByKey("SHA256:falcon")
+	assert.True(t, found)
+	assert.Equal(t, "Han Solo", name)
+	_, found = s.FindByKey("SHA256:other")
+	assert.False(t, found)
+	_, found = s.FindByKey("")
+	assert.False(t, found)
+}
+
+func Test_FileStore_persists_accounts(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "accounts")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "accounts.json")
+
+	useFastHashing(t)
+	s1, err := NewFileStore(path)
+	assert.Nil(t, err)
+	assert.Nil(t, s1.Register("Han Solo", "kessel-run"))
+
+	s2, err := NewFileStore(path)
+
+	assert.Nil(t, err)
+	assert.True(t, s2.Exists("Han Solo"))
+	assert.Nil(t, s2.Authenticate("Han Solo", "kessel-run"))
+	data, _ := ioutil.ReadFile(path)
+	assert.NotContains(t, string(data), "kessel-run")
+}
+
+func Test_FileStore_persists_keys(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "accounts")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "accounts.json")
+
+	s1, err := NewFileStore(path)
+	assert.Nil(t, err)
+	assert.Nil(t, s1.RegisterKey("Han Solo", "SHA256:falcon"))
+
+	s2, err := NewFileStore(path)
+
+	assert.Nil(t, err)
+	name, found := s2.FindByKey("SHA256:falcon")
+	assert.True(t, found)
+	assert.Equal(t, "Han Solo", name)
+}
+
+func Test_FileStore_missing_file_starts_empty(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "accounts")
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(filepath.Join(dir, "accounts.json"))
+
+	assert.Nil(t, err)
+	assert.False(t, s.Exists("Han Solo"))
+}
+
+func Test_FileStore_bad_file(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "accounts")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "accounts.json")
+	ioutil.WriteFile(path, []byte("not json"), 0600)
+
+	_, err := NewFileStore(path)
+
+	assert.Error(t, err)
+}
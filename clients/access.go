@@ -0,0 +1,179 @@
+package clients
+
+import (
+	"chat-telnet/accounts"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// RoomMode decides who can see a room in `\list-rooms` and who can `\join` it.
+type RoomMode string
+
+const (
+	// Listed for everyone, and anyone can join.
+	PublicRoom RoomMode = "public"
+	// Anyone can join, as long as they know the room's name - it's never listed.
+	UnlistedRoom RoomMode = "unlisted"
+	// Never listed, and you need the password to join, ex. `\join den kessel-run`.
+	PasswordRoom RoomMode = "password"
+	// Never listed, and you need an `\invite` from the owner or a moderator to join.
+	InviteOnlyRoom RoomMode = "invite-only"
+)
+
+var roomModes = []RoomMode{PublicRoom, UnlistedRoom, PasswordRoom, InviteOnlyRoom}
+
+// RoomAccess is who a room lets in.  Owners and moderators can always get back in to their own room, whatever its mode.
+type RoomAccess struct {
+	Mode         RoomMode
+	PasswordHash []byte
+	Invites      []Member
+}
+
+// Rooms made before modes existed, or without one, are public.
+func (a RoomAccess) Listed() bool {
+	return a.Mode == "" || a.Mode == PublicRoom
+}
+
+// Can anyone who knows the room's name get in, without a password or an invite?
+func (a RoomAccess) Open() bool {
+	return a.Mode != PasswordRoom && a.Mode != InviteOnlyRoom
+}
+
+func (a RoomAccess) Invited(c *Client) bool {
+	for _, invite := range a.Invites {
+		if invite.Is(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// Build the access for a mode, hashing the password if it needs one.
+func newRoomAccess(mode RoomMode, password string) (RoomAccess, error) {
+	access := RoomAccess{Mode: mode}
+	if mode != PasswordRoom {
+		return access, nil
+	}
+	if password == "" || strings.ContainsAny(password, " \t") {
+		return access, fmt.Errorf("password rooms need a password, with no spaces in it")
+	}
+	hash, err := accounts.HashPassword(password)
+	if err != nil {
+		return access, err
+	}
+	access.PasswordHash = hash
+	return access, nil
+}
+
+func parseRoomMode(value string) (RoomMode, bool) {
+	for _, mode := range roomModes {
+		if strings.EqualFold(value, string(mode)) {
+			return mode, true
+		}
+	}
+	return "", false
+}
+
+func roomModeNames() string {
+	names := []string{}
+	for _, mode := range roomModes {
+		names = append(names, string(mode))
+	}
+	return strings.Join(names, ", ")
+}
+
+// `\create` takes `<room name> [+mode] [password]`.  Room names can have spaces in them, so the mode is only split off
+//	the end if it actually reads as one, ex. `\create den +password kessel-run` or `\create back room +unlisted`.
+func splitRoomOptions(value string) (string, RoomAccess, error) {
+	optionIndex := strings.LastIndex(value, " +")
+	if optionIndex < 0 {
+		return value, RoomAccess{Mode: PublicRoom}, nil
+	}
+	options := strings.Fields(value[optionIndex+2:])
+	if len(options) == 0 || len(options) > 2 {
+		return value, RoomAccess{Mode: PublicRoom}, nil
+	}
+	mode, found := parseRoomMode(options[0])
+	if !found {
+		return value, RoomAccess{Mode: PublicRoom}, nil
+	}
+	password := ""
+	if len(options) == 2 {
+		password = options[1]
+	}
+	access, err := newRoomAccess(mode, password)
+	return strings.TrimSpace(value[:optionIndex]), access, err
+}
+
+// Can the client see the room in `\list-rooms` and look at who's in it?  Only public rooms show up for everyone,
+//	the rest only show up for whoever is already inside.
+func (c *Client) canSee(roomName string, moderation RoomModeration) bool {
+	return moderation.Listed() || c.inRoom(roomName) || moderation.CanModerate(c)
+}
+
+// Check the client is allowed in, answering with why not if they aren't.
+func (c *Client) canEnter(roomName string, moderation RoomModeration, password string) (string, bool) {
+	if moderation.CanModerate(c) {
+		return "", true
+	}
+	switch moderation.Mode {
+	case PasswordRoom:
+		if password == "" {
+			return fmt.Sprintf("%s needs a password - usage: `\\join <room name> <password>`", roomName), false
+		}
+		if bcrypt.CompareHashAndPassword(moderation.PasswordHash, []byte(password)) != nil {
+			return fmt.Sprintf("Wrong password for %s.", roomName), false
+		}
+	case InviteOnlyRoom:
+		if !moderation.Invited(c) {
+			return fmt.Sprintf("%s is invite only - ask its owner or a moderator for an `\\invite`.", roomName), false
+		}
+	}
+	return "", true
+}
+
+func (c *Client) setRoomMode(value string) Response {
+	options := strings.Fields(value)
+	mode, found := parseRoomMode(options[0])
+	if !found || len(options) > 2 {
+		return failure(fmt.Sprintf("Invalid room mode - pick one of: %s.", roomModeNames()))
+	}
+	password := ""
+	if len(options) == 2 {
+		password = options[1]
+	}
+	access, err := newRoomAccess(mode, password)
+	if err != nil {
+		return failure(fmt.Sprintf("Invalid room mode - %v.", err))
+	}
+	roomName := c.ActiveRoom()
+	c.Store.UpdateModeration(roomName, func(moderation *RoomModeration) error {
+		// Hang on to any invites, in case the room goes back to being invite only.
+		access.Invites = moderation.Invites
+		moderation.RoomAccess = access
+		return nil
+	})
+	return announce(roomName, eventNotice, fmt.Sprintf("%s is now %s.", roomName, mode))
+}
+
+// Invite someone in to the moderator's room.  The invite lasts as long as the room does, and the person invited is
+//	told how to use it.
+func (c *Client) invite(value string) Response {
+	target, found := c.Store.FindClientByName(value)
+	if !found {
+		return failure(fmt.Sprintf("There's nobody called %s online.", value))
+	}
+	err := c.Store.UpdateModeration(c.ActiveRoom(), func(moderation *RoomModeration) error {
+		if moderation.Invited(target) || moderation.CanModerate(target) {
+			return errNotModerated
+		}
+		moderation.Invites = append(moderation.Invites, MemberOf(target))
+		return nil
+	})
+	if err != nil {
+		return failure(fmt.Sprintf("%s can already get in to %s.", target.UserName(), c.ActiveRoom()))
+	}
+	target.WriteResponse(serverNotice(fmt.Sprintf("%s has invited you to %s - use `\\join %s` to go in.", c.UserName(), c.ActiveRoom(), c.ActiveRoom())))
+	return reply(fmt.Sprintf("%s has been invited to %s.", target.UserName(), c.ActiveRoom()))
+}
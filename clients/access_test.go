@@ -0,0 +1,124 @@
+package clients
+
+import (
+	"chat-telnet/mocks"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_splitRoomOptions(t *testing.T) {
+	useFastHashing(t)
+	var tests = []struct {
+		value         string
+		expectedName  string
+		expectedMode  RoomMode
+		expectedError string
+	}{
+		{"cantina", "cantina", PublicRoom, "<nil>"},
+		{"back room +unlisted", "back room", UnlistedRoom, "<nil>"},
+		{"den +PASSWORD kessel-run", "den", PasswordRoom, "<nil>"},
+		{"throne room +invite-only", "throne room", InviteOnlyRoom, "<nil>"},
+		{"c +plus +sparkly", "c +plus +sparkly", PublicRoom, "<nil>"},
+		{"den +password", "den", PasswordRoom, "password rooms need a password, with no spaces in it"},
+	}
+	for _, tt := range tests {
+		name, access, err := splitRoomOptions(tt.value)
+		assert.Equal(t, tt.expectedName, name, tt.value)
+		assert.Equal(t, tt.expectedMode, access.Mode, tt.value)
+		assert.Equal(t, tt.expectedError, fmt.Sprint(err), tt.value)
+	}
+}
+
+func Test_password_room(t *testing.T) {
+	useFastHashing(t)
+	owner := &Client{Id: "123", Name: "Lando", Writer: &mocks.IoWriterMock{}}
+	guest := &Client{Id: "456", Name: "Han Solo", Writer: &mocks.IoWriterMock{}}
+	seedStore(owner, guest)
+
+	response := owner.createRoom("cloud city +password tibanna").Payload
+	assert.Equal(t, "New password room created: cloud city", response)
+
+	var tests = []struct {
+		input    string
+		expected string
+	}{
+		{"cloud city", "cloud city needs a password - usage: `\\join <room name> <password>`"},
+		{"cloud city sabacc", "Wrong password for cloud city."},
+		{"cloud city tibanna", "Han Solo has entered: cloud city"},
+	}
+	for _, tt := range tests {
+		response := guest.joinRoom(tt.input).Payload
+		assert.Equal(t, tt.expected, response, tt.input)
+	}
+}
+
+func Test_invite_only_room(t *testing.T) {
+	owner := &Client{Id: "123", Name: "Jabba", Writer: &mocks.IoWriterMock{}}
+	w := &mocks.IoWriterMock{}
+	guest := &Client{Id: "456", Name: "Boba Fett", Writer: w}
+	seedStore(owner, guest)
+	owner.createRoom("palace +invite-only")
+
+	response := guest.joinRoom("palace").Payload
+	assert.Equal(t, "palace is invite only - ask its owner or a moderator for an `\\invite`.", response)
+
+	response = owner.parseResponse("\\invite boba fett").Payload
+	assert.Equal(t, "Boba Fett has been invited to palace.", response)
+	assert.Contains(t, string(w.WriteCalledWith), "Jabba has invited you to palace - use `\\join palace` to go in.")
+	response = owner.invite("Boba Fett").Payload
+	assert.Equal(t, "Boba Fett can already get in to palace.", response)
+	response = owner.invite("Greedo").Payload
+	assert.Equal(t, "There's nobody called Greedo online.", response)
+
+	response = guest.joinRoom("palace").Payload
+	assert.Equal(t, "Boba Fett has entered: palace", response)
+}
+
+func Test_hidden_rooms_are_not_listed(t *testing.T) {
+	owner := &Client{Id: "123", Name: "Luke", Writer: &mocks.IoWriterMock{}}
+	outsider := &Client{Id: "456", Name: "Vader", Writer: &mocks.IoWriterMock{}}
+	seedStore(owner, outsider)
+	owner.createRoom("rebel base +unlisted")
+
+	response := outsider.listRooms().Payload
+	assert.Equal(t, "No rooms yet - make one!", response)
+	response = outsider.listMembers("rebel base").Payload
+	assert.Equal(t, "No such room rebel base!", response)
+	response = owner.listRooms().Payload
+	assert.Contains(t, response, "Room: rebel base")
+
+	// Unlisted rooms are still open to anyone who knows the name.
+	response = outsider.joinRoom("rebel base").Payload
+	assert.Equal(t, "Vader has entered: rebel base", response)
+	response = outsider.listMembers("rebel base").Payload
+	assert.Contains(t, response, "\tLuke\n")
+}
+
+func Test_setRoomMode(t *testing.T) {
+	useFastHashing(t)
+	owner := &Client{Id: "123", Name: "Leia", CurrentRoom: "alderaan", Writer: &mocks.IoWriterMock{}}
+	moderator := &Client{Id: "456", Name: "Han Solo", CurrentRoom: "alderaan", Writer: &mocks.IoWriterMock{}}
+	seedStore(owner, moderator)
+	owner.setModerator("Han Solo", true)
+
+	var tests = []struct {
+		client   *Client
+		input    string
+		expected string
+	}{
+		{moderator, "\\room-mode unlisted", "Only the owner of alderaan can use `\\room-mode`."},
+		{owner, "\\room-mode secret", "Invalid room mode - pick one of: public, unlisted, password, invite-only."},
+		{owner, "\\room-mode password", "Invalid room mode - password rooms need a password, with no spaces in it."},
+		{owner, "\\room-mode password dantooine", "alderaan is now password."},
+	}
+	for _, tt := range tests {
+		response := tt.client.parseResponse(tt.input).Payload
+		assert.Equal(t, tt.expected, response, tt.input)
+	}
+
+	// Moderators can always get back in, whatever the mode.
+	moderation, _ := owner.Store.Moderation("alderaan")
+	_, allowed := moderator.canEnter("alderaan", moderation, "")
+	assert.True(t, allowed)
+}
@@ -0,0 +1,83 @@
+package clients
+
+import (
+	"chat-telnet/accounts"
+	"chat-telnet/events"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Where registered user names and their passwords live.  The server swaps this for an `accounts.FileStore` when
+//	`ACCOUNTS_FILE` is set.
+var Accounts accounts.Store = accounts.NewMemoryStore()
+
+// When set, nobody gets to use the `LoggedIn` commands (the room commands) until they've logged in.
+var RequireLogin = false
+
+// Both `\register` and `\login` take `<user name> <password>`.  User names can have spaces in them but passwords
+//	can't, so the password is everything after the last space.
+func splitCredentials(value string) (string, string, bool) {
+	passwordIndex := strings.LastIndexByte(value, ' ')
+	if passwordIndex < 0 {
+		return "", "", false
+	}
+	name := strings.TrimSpace(value[:passwordIndex])
+	password := value[passwordIndex+1:]
+	return name, password, name != ""
+}
+
+func (c *Client) register(value string) Response {
+	name, password, ok := splitCredentials(value)
+	if !ok {
+		return failure("Usage: `\\register <user name> <password>`")
+	}
+	err := NameRules.Validate(name)
+	if err != nil {
+		return failure(fmt.Sprintf("Invalid name - %v.", err))
+	}
+	if other, found := c.Store.FindClientByName(name); found && other != c {
+		return failure(fmt.Sprintf("Invalid name - `%s` is already taken, please pick another.", name))
+	}
+	err = Accounts.Register(name, password)
+	if err == accounts.ErrAccountExists {
+		return failure(fmt.Sprintf("`%s` is already registered - use `\\login` if it's yours.", name))
+	}
+	if err != nil {
+		return failure(fmt.Sprintf("Unable to register - %v.", err))
+	}
+	log.Printf("Registered account: %s\n", name)
+
+	return c.logInAs(name, fmt.Sprintf("%s has registered and logged in as %s", c.UserName(), name))
+}
+
+func (c *Client) login(value string) Response {
+	name, password, ok := splitCredentials(value)
+	if !ok {
+		return failure("Usage: `\\login <user name> <password>`")
+	}
+	if Accounts.Authenticate(name, password) != nil {
+		return failure("Login failed - incorrect user name or password.")
+	}
+
+	return c.logInAs(name, fmt.Sprintf("%s has logged in as %s", c.UserName(), name))
+}
+
+// Take on the account's name, as long as nobody else is already online under it.
+func (c *Client) logInAs(name, msg string) Response {
+	oldName := c.UserName()
+	err := c.Store.RenameClient(c, name)
+	if err == ErrNameTaken {
+		return failure(fmt.Sprintf("`%s` is already online.", name))
+	}
+	c.publish(events.Event{Kind: events.Rename, OldName: oldName})
+	c.setAccount(name)
+	rename := announce(c.ActiveRoom(), eventRename, msg)
+	rename.OldName = oldName
+	return rename
+}
+
+// Registered names can only be claimed by logging in to them, so only let this client have it if it's theirs.
+func (c *Client) canClaimName(name string) bool {
+	return !Accounts.Exists(name) || strings.EqualFold(c.account(), name)
+}
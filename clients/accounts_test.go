@@ -0,0 +1,184 @@
+package clients
+
+import (
+	"chat-telnet/accounts"
+	"chat-telnet/mocks"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+)
+
+// Turn password hashing right down for the length of a test.
+func useFastHashing(t *testing.T) {
+	previous := accounts.HashCost
+	accounts.HashCost = bcrypt.MinCost
+	t.Cleanup(func() { accounts.HashCost = previous })
+}
+
+// Swap in a fresh, fast account store for the length of a test.
+func useTestAccounts(t *testing.T) *accounts.MemoryStore {
+	useFastHashing(t)
+	store := accounts.NewMemoryStore()
+	previous := Accounts
+	Accounts = store
+	t.Cleanup(func() { Accounts = previous })
+	return store
+}
+
+func Test_register_success(t *testing.T) {
+	accountStore := useTestAccounts(t)
+	c := &Client{Id: "123", Name: "guest-1"}
+	seedStore(c)
+
+	response := c.register("Han Solo kessel-run")
+
+	assert.Equal(t, "guest-1 has registered and logged in as Han Solo", response.Payload)
+	assert.Equal(t, ToRoom, response.Audience)
+	assert.Equal(t, "Han Solo", c.Name)
+	assert.Equal(t, "Han Solo", c.Account)
+	assert.Nil(t, accountStore.Authenticate("Han Solo", "kessel-run"))
+}
+
+func Test_register_bad_input(t *testing.T) {
+	useTestAccounts(t)
+	c := &Client{Id: "123", Name: "guest-1"}
+	seedStore(c)
+
+	var tests = []struct {
+		input       string
+		expectedStr string
+	}{
+		{"kessel-run", "Usage: `\\register <user name> <password>`"},
+		{"Han Solo solo", "Unable to register - passwords must be at least 8 characters long."},
+		{"Admin kessel-run", "Invalid name - that name is reserved."},
+	}
+
+	for _, tt := range tests {
+		response := c.register(tt.input)
+		assert.Equal(t, tt.expectedStr, response.Payload)
+		assert.Equal(t, eventError, response.Event)
+	}
+	assert.Equal(t, "guest-1", c.Name)
+	assert.Equal(t, "", c.Account)
+}
+
+func Test_register_name_online(t *testing.T) {
+	accountStore := useTestAccounts(t)
+	c1 := &Client{Id: "123", Name: "Han Solo"}
+	c2 := &Client{Id: "456", Name: "guest-2"}
+	seedStore(c1, c2)
+
+	response := c2.register("han solo kessel-run")
+
+	assert.Equal(t, "Invalid name - `han solo` is already taken, please pick another.", response.Payload)
+	assert.Equal(t, eventError, response.Event)
+	assert.False(t, accountStore.Exists("Han Solo"))
+}
+
+func Test_register_already_registered(t *testing.T) {
+	accountStore := useTestAccounts(t)
+	accountStore.Register("Han Solo", "kessel-run")
+	c := &Client{Id: "123", Name: "guest-1"}
+	seedStore(c)
+
+	response := c.register("Han Solo 12-parsecs")
+
+	assert.Equal(t, "`Han Solo` is already registered - use `\\login` if it's yours.", response.Payload)
+	assert.Equal(t, eventError, response.Event)
+	assert.Equal(t, "guest-1", c.Name)
+}
+
+func Test_login_success(t *testing.T) {
+	accountStore := useTestAccounts(t)
+	accountStore.Register("Han Solo", "kessel-run")
+	c := &Client{Id: "123", Name: "guest-1"}
+	seedStore(c)
+
+	response := c.login("Han Solo kessel-run")
+
+	assert.Equal(t, "guest-1 has logged in as Han Solo", response.Payload)
+	assert.Equal(t, ToRoom, response.Audience)
+	assert.Equal(t, "Han Solo", c.Name)
+	assert.Equal(t, "Han Solo", c.Account)
+}
+
+func Test_login_bad_password(t *testing.T) {
+	accountStore := useTestAccounts(t)
+	accountStore.Register("Han Solo", "kessel-run")
+	c := &Client{Id: "123", Name: "guest-1"}
+	seedStore(c)
+
+	response := c.login("Han Solo 12-parsecs")
+
+	assert.Equal(t, "Login failed - incorrect user name or password.", response.Payload)
+	assert.Equal(t, eventError, response.Event)
+	assert.Equal(t, "guest-1", c.Name)
+	assert.Equal(t, "", c.Account)
+}
+
+func Test_login_already_online(t *testing.T) {
+	accountStore := useTestAccounts(t)
+	accountStore.Register("Han Solo", "kessel-run")
+	c1 := &Client{Id: "123", Name: "Han Solo", Account: "Han Solo"}
+	c2 := &Client{Id: "456", Name: "guest-2"}
+	seedStore(c1, c2)
+
+	response := c2.login("Han Solo kessel-run")
+
+	assert.Equal(t, "`Han Solo` is already online.", response.Payload)
+	assert.Equal(t, eventError, response.Event)
+	assert.Equal(t, "", c2.Account)
+}
+
+func Test_changeClientName_registered_name(t *testing.T) {
+	accountStore := useTestAccounts(t)
+	accountStore.Register("Han Solo", "kessel-run")
+	c := &Client{Id: "123", Name: "guest-1"}
+	seedStore(c)
+
+	response := c.changeClientName("HAN SOLO")
+
+	assert.Equal(t, "Invalid name - `HAN SOLO` is registered, use `\\login` to claim it.", response.Payload)
+	assert.Equal(t, eventError, response.Event)
+	assert.Equal(t, "guest-1", c.Name)
+}
+
+func Test_changeClientName_back_to_own_account(t *testing.T) {
+	accountStore := useTestAccounts(t)
+	accountStore.Register("Han Solo", "kessel-run")
+	c := &Client{Id: "123", Name: "Captain", Account: "Han Solo"}
+	seedStore(c)
+
+	response := c.changeClientName("Han Solo")
+
+	assert.Equal(t, "User: Captain has become -> Han Solo", response.Payload)
+	assert.Equal(t, ToRoom, response.Audience)
+}
+
+func Test_parseResponse_RequireLogin(t *testing.T) {
+	accountStore := useTestAccounts(t)
+	accountStore.Register("Han Solo", "kessel-run")
+	defer func() { RequireLogin = false }()
+	RequireLogin = true
+	c := &Client{Id: "123", Name: "guest-1", Writer: &mocks.IoWriterMock{}}
+	seedStore(c)
+
+	var tests = []struct {
+		input        string
+		expectedStr  string
+		expectedBool bool
+	}{
+		{"\\create broom", "Please `\\login` or `\\register` before using the room commands.", false},
+		{"\\list-rooms", "Please `\\login` or `\\register` before using the room commands.", false},
+		{"\\whoami", "\nClient Name: guest-1\nCurrent Room: None\nAll Rooms: None", false},
+		{"\\login Han Solo kessel-run", "guest-1 has logged in as Han Solo", true},
+		{"\\create broom", "New room created: broom", false},
+	}
+
+	for _, tt := range tests {
+		actual := c.parseResponse(tt.input)
+		assert.Equal(t, tt.expectedStr, actual.Payload)
+		assert.Equal(t, tt.expectedBool, actual.Audience == ToRoom)
+		assert.False(t, actual.Disconnect)
+	}
+}
@@ -2,90 +2,233 @@ package clients
 
 import (
 	"bufio"
+	"chat-telnet/events"
+	"chat-telnet/ids"
 	"chat-telnet/interfaces"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net"
+	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
-var CLIENTS = "clients"
-var ROOMS = "rooms"
+var SERVER = "Server"
 
+// Where new clients get their ids and starting names from.  Swap this out for an `ids.SequenceGenerator` to get
+//	predictable ones.
+var IdGenerator ids.Generator = &ids.RandomGenerator{}
+
+// Other clients read (and moderators change) a client's name, active room and account from their own go routines,
+//	so once the client is in the store those only go through `UserName`, `ActiveRoom` and friends, under `mu`.
 type Client struct {
 	Writer      interfaces.AbstractIoWriter
 	Conn        interfaces.AbstractNetConn
-	Cache       interfaces.AbstractCache // TODO - explore a cache like redis or BadgerDB?
+	Store       ChatStore
 	Name        string
-	CurrentRoom string
+	CurrentRoom string // The active room, where plain messages go.  The client can be in others too, see `Rooms`.
 	Id          string
+	Account     string // The name of the account this client has logged in to, if any.
+	mu          sync.RWMutex
+	// What the client's rooms are told when they go, if not that they've gone offline - see `leaveWith`.
+	departure string
+	// Everything waiting to be written to the connection.  Only connected clients get one - without it, writes go
+	//	straight to the `Writer`.
+	outbox *outbox
+	color  int32       // Whether to style messages with ANSI colors, see `\color`.  Only ever touched atomically.
+	json   int32       // Whether the client speaks JSON lines instead of text, see `\mode`.  Only ever touched atomically.
+	irc    *ircSession // Only set for clients connected over IRC, who get IRC commands and replies instead.
+}
+
+func (c *Client) UserName() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Name
+}
+
+func (c *Client) setName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Name = name
+}
+
+func (c *Client) ActiveRoom() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.CurrentRoom
+}
+
+func (c *Client) setActiveRoom(roomName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.CurrentRoom = roomName
 }
 
-func GenerateNewClient(conn interfaces.AbstractNetConn, cache interfaces.AbstractCache) error {
+func (c *Client) account() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Account
+}
+
+func (c *Client) setAccount(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Account = name
+}
+
+// Have the client's rooms told `message` when their connection is removed, instead of that they've gone offline.
+func (c *Client) leaveWith(message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.departure = message
+}
+
+func GenerateNewClient(conn interfaces.AbstractNetConn, store ChatStore) error {
 	log.Printf("Accepting new connection from address %v\n", conn.RemoteAddr().String())
 
-	// Generate a semi-random id and initial name for ourselves, using a time stamp.  For now, this is "unique"
-	//  enough since our users are not logging on so quickly that they should collide.
-	id := fmt.Sprintf("%v", time.Now().Unix())
-	client := &Client{
+	return startClient(newClient(conn, store))
+}
+
+// Add the client to the store and greet them under the nickname they were given.
+func startClient(client *Client) error {
+	err := addUnderNickname(client)
+	if err != nil {
+		client.Writer.Write([]byte(fmt.Sprintf("ERROR: %s\n", err)))
+		return err
+	}
+	client.publish(events.Event{Kind: events.Connect, Address: client.address()})
+	nameInstructions := fmt.Sprintf("\n\nNOTE: Your user name has been automatically set to `%s`\nIf you'd like to reset it, please use the '\\name' command.\n\n", client.UserName())
+
+	client.greet(nameInstructions)
+	return nil
+}
+
+// A fresh client under a random nickname, not yet in the store.
+func newClient(conn interfaces.AbstractNetConn, store ChatStore) *Client {
+	// The id is what we actually track the client by, so the name is free to change from here on out.
+	id := IdGenerator.NewId()
+	return &Client{
 		Conn:        conn,
 		Writer:      conn,
-		Name:        id,
+		Name:        freeNickname(store),
 		CurrentRoom: "",
 		Id:          id,
-		Cache:       cache,
+		Store:       store,
+		outbox:      newOutbox(OutboundQueueSize, OutboundQueuePolicy),
 	}
+}
 
-	err := client.addClientToCache()
-	if err != nil {
-		client.WriteString(fmt.Sprintf("ERROR: %s\n", err))
-		return err
+// Nicknames are only random, not unique, so make a few attempts to steer clear of anyone already online, or anyone
+//	who has registered the name.
+func freeNickname(store ChatStore) string {
+	name := IdGenerator.NewNickname()
+	for attempt := 0; attempt < 5; attempt++ {
+		if _, taken := store.FindClientByName(name); !taken && !Accounts.Exists(name) {
+			break
+		}
+		name = IdGenerator.NewNickname()
 	}
-	intro := `
-Welcome to Chattington!
-
-Feel free to join any chat rooms you see, or create a room instead, using the available commands below.
-
-Available Commands:
-=====
-\name 	<user name>		: Change your user name to the <user name> supplied
-\create <room name>		: Create and join a new chat room with the <room name> supplied
-\join 	<room name>		: Join an existing chat room with the <room name> supplied
-\list 	<room name>		: List members in the chat room named after the <room name> supplied
-\leave					: Leave the room you are currently in
-\list 					: List members in the room you're currently in
-\list-rooms				: List all the available rooms and their members
-\whoami					: List your name and what room you're currently in
-\exit					: Exit server and terminate connection
-`
-	nameInstructions := fmt.Sprintf("\n\nNOTE: Your user name has been automatically set to `%s`\nIf you'd like to reset it, please use the '\\name' command.\n\n", id)
-
-	client.WriteString(intro + nameInstructions)
-	go client.listen()
-	return nil
+	return name
 }
 
-func (c *Client) WriteString(msg string) error {
-	_, err := c.Writer.Write([]byte(msg))
+// Add the client to the store, giving them another nickname if someone has come in under theirs since it was picked.
+func addUnderNickname(client *Client) error {
+	err := client.Store.AddClient(client)
+	for attempt := 0; err == ErrNameTaken && attempt < 5; attempt++ {
+		client.setName(freeNickname(client.Store))
+		err = client.Store.AddClient(client)
+	}
+	return err
+}
 
+// Send the intro, followed by the note about how the client got their name, and start serving them.
+func (c *Client) greet(note string) {
+	// Nothing is sent from the outbox until the intro has gone out, so these first writes go straight to the
+	//	connection, and anything sent to the client in the meantime waits its turn behind them.
+	intro := "\nWelcome to Chattington!\n\n" +
+		"Feel free to join any chat rooms you see, or create a room instead, using the available commands below.\n\n" +
+		"Available Commands:\n=====\n" + Commands.Summary()
+
+	welcome := intro + MessageOfTheDay.banner() + note
+	if c.speaksJSON() {
+		welcome = c.formatJSON(time.Now().Unix(), serverNotice(welcome))
+	}
+	c.Writer.Write([]byte(welcome))
+	go c.sendQueued()
+	go c.listen()
+}
+
+func (c *Client) WriteString(msg string) error {
+	if c.outbox == nil {
+		_, err := c.Writer.Write([]byte(msg))
+		return err
+	}
+	err := c.outbox.push(msg)
+	if err == ErrQueueFull {
+		// Closing the connection takes the client out through `listen`, like any other disconnect.
+		log.Printf("Disconnecting %s, who has %d messages waiting\n", c.UserName(), c.QueueDepth())
+		c.Conn.Close()
+	}
 	return err
 }
 
-func (c *Client) WriteResponse(msg string, sendingClient interface{}) error {
-	// Using `sendingClient` you can send in the string name who the sender of the message is, if it's `nil` we'll
-	//  or the same as the target client (`c`) then we can format the response as i.
-	now := time.Now().Unix()
-	prefix := ""
-	if sendingClient == nil || sendingClient == c.Name {
-		prefix = fmt.Sprintf("%d: %s>", now, c.Name)
-	} else {
-		prefix = fmt.Sprintf("%d: %s:", now, sendingClient)
+// Send the client a response, whether it's their own or one from somebody else, in whatever their connection speaks.
+//	Its `Sender` says who it's from, its `Room` where they heard it, and its `Event` what kind of thing happened.
+func (c *Client) WriteResponse(r Response) error {
+	sent := time.Now().Unix()
+	// The log only ever gets the plain version, colors or not.
+	log.Print(c.styleMessage(sent, r, false))
+	rendered := c.renderer().render(c, sent, r)
+	if rendered == "" {
+		return nil
+	}
+	return c.WriteString(rendered)
+}
+
+// Add chat room response formatting - `sent` is the unix time the message went out, which is now for everything but
+//	the history.
+func (c *Client) formatMessage(sent int64, r Response) string {
+	return c.styleMessage(sent, r, c.colorEnabled())
+}
+
+func (c *Client) styleMessage(sent int64, r Response, color bool) string {
+	label, name, separator, notice, msg := "", r.Sender, ":", false, r.Payload
+	if r.Event == eventDirect {
+		label = "[DM] "
+	} else if r.Room != "" {
+		if name == c.UserName() {
+			separator = ">"
+		}
+		label, notice = fmt.Sprintf("[%s] ", r.Room), r.notice()
+	} else if name == "" || name == c.UserName() {
+		name, separator = c.UserName(), ">"
+	}
+	if color {
+		name, msg = c.colorize(name, msg, notice)
+	}
+	return fmt.Sprintf("%d: %s%s%s %s\n", sent, label, name, separator, msg)
+}
+
+// Let every connected client know the server is going down, give any broadcasts still in flight the `gracePeriod`
+//	to land, and then close every connection.  Closing the connection kicks each client's `listen` loop out of
+//	its `Read`, so they clean themselves up through `removeConnection` like any other disconnect.
+func DisconnectAll(store ChatStore, gracePeriod time.Duration) {
+	system := &Client{Writer: ioutil.Discard, Name: SERVER, Store: store}
+	system.deliver(Response{
+		Audience: ToEveryone, Event: eventNotice,
+		Payload: fmt.Sprintf("Chattington is shutting down in %v - see you next time!", gracePeriod),
+	})
+
+	time.Sleep(gracePeriod)
+
+	for _, client := range store.ListClients() {
+		client.Conn.Close()
 	}
-	// Add chat room response formatting
-	msg = fmt.Sprintf("%s %s\n", prefix, msg)
-	log.Print(msg)
-	return c.WriteString(msg)
 }
 
 // Should I attach this to a struct?
@@ -102,89 +245,162 @@ func Read(r interfaces.AbstractBufioReader) (string, error) {
 	return value, err
 }
 
+// However the client went (`\exit`, an idle timeout, a dropped connection), every room they're in hears they've gone
+//	before they're taken out of the store.
 func (c *Client) removeConnection() {
-	c.removeClientFromCache()
-	c.Conn.Close()
-	log.Printf("Removed connection %v from pool\n", c.Conn.RemoteAddr().String())
+	c.mu.RLock()
+	departure := c.departure
+	c.mu.RUnlock()
+	if departure == "" {
+		departure = fmt.Sprintf("%s has gone offline", c.UserName())
+	}
+	c.broadcastDeparture(departure)
+	c.Store.RemoveClient(c)
+	if c.outbox != nil {
+		// Give anything still queued (ex. a goodbye) the chance to go out first - `sendQueued` hangs up once it's
+		//	done, or we do once it's had long enough.
+		c.outbox.close()
+		time.AfterFunc(OUTBOX_DRAIN_TIMEOUT, func() { c.Conn.Close() })
+	} else {
+		c.Conn.Close()
+	}
+	c.publish(events.Event{Kind: events.Disconnect, Address: c.address()})
 }
 
-func (c *Client) changeClientName(name string) (string, bool) {
-	msg := fmt.Sprintf("User: %s has become -> %s", c.Name, name)
-
-	c.Name = name
-	c.updateClientInCache()
-	// Overwrite this user in the cache so all users can see it.
-	return msg, true
+func (c *Client) changeClientName(name string) Response {
+	err := NameRules.Validate(name)
+	if err != nil {
+		return failure(fmt.Sprintf("Invalid name - %v.", err))
+	}
+	if !c.canClaimName(name) {
+		return failure(fmt.Sprintf("Invalid name - `%s` is registered, use `\\login` to claim it.", name))
+	}
+	oldName := c.UserName()
+	// The store only holds pointers to us, so everyone will see the new name straight away.
+	err = c.Store.RenameClient(c, name)
+	if err == ErrNameTaken {
+		return failure(fmt.Sprintf("Invalid name - `%s` is already taken, please pick another.", name))
+	}
+	c.publish(events.Event{Kind: events.Rename, OldName: oldName})
+	response := fmt.Sprintf("User: %s has become -> %s", oldName, name)
+	rename := announce(c.ActiveRoom(), eventRename, response)
+	rename.OldName, rename.id = oldName, nextResponseId()
+	// The active room gets this through the usual broadcast, so let everyone in the other rooms know too.
+	c.broadcastToOtherRooms(rename)
+	return rename
 }
 
-func (c *Client) displayClientStats() (string, bool) {
-	currentRoom := c.CurrentRoom
+func (c *Client) displayClientStats() Response {
+	currentRoom := c.ActiveRoom()
 	if currentRoom == "" {
 		currentRoom = "None"
 	}
-	return fmt.Sprintf("\nClient Name: %s\nCurrent Room: %s", c.Name, currentRoom), false
+	rooms := strings.Join(c.Rooms(), ", ")
+	if rooms == "" {
+		rooms = "None"
+	}
+	return reply(fmt.Sprintf("\nClient Name: %s\nCurrent Room: %s\nAll Rooms: %s", c.UserName(), currentRoom, rooms))
 }
 
-func (c *Client) listRooms() (string, bool) {
-	rooms := c.getAllRoomsFromCache()
+func (c *Client) listRooms() Response {
+	rooms := c.Store.ListRooms()
 	if len(rooms) < 1 {
-		return "No rooms yet - make one!", false
+		return reply("No rooms yet - make one!")
+	}
+	roomNames := []string{}
+	for name := range rooms {
+		// Unlisted and private rooms only show up for whoever is already inside them.
+		if moderation, found := c.Store.Moderation(name); found && !c.canSee(name, moderation) {
+			continue
+		}
+		roomNames = append(roomNames, name)
+	}
+	if len(roomNames) < 1 {
+		return reply("No rooms yet - make one!")
 	}
+	sort.Strings(roomNames)
 	roomString := ""
-	for name, members := range rooms {
-		roomString = roomString + fmt.Sprintf("  Room: %s\n  Members:\n", name)
-		for _, c := range members {
-			roomString = roomString + fmt.Sprintf("\t%s\n", c.Name)
+	for _, name := range roomNames {
+		roomString = roomString + fmt.Sprintf("  Room: %s\n", name)
+		if moderation, found := c.Store.Moderation(name); found && moderation.Topic != "" {
+			roomString = roomString + fmt.Sprintf("  Topic: %s\n", moderation.Topic)
+		}
+		roomString = roomString + "  Members:\n"
+		for _, c := range rooms[name] {
+			roomString = roomString + fmt.Sprintf("\t%s\n", c.UserName())
 		}
 	}
-	return fmt.Sprintf("\nCurrent rooms: \n%s", roomString), false
+	return reply(fmt.Sprintf("\nCurrent rooms: \n%s", roomString))
 }
 
-func (c *Client) listMembers(roomName string) (string, bool) {
-	room, found := c.getRoomFromCacheByName(roomName)
-	if !found {
-		return fmt.Sprintf("No such room %s!", roomName), false
+func (c *Client) listMembers(roomName string) Response {
+	room, found := c.Store.MembersOf(roomName)
+	if moderation, listed := c.Store.Moderation(roomName); !found || (listed && !c.canSee(roomName, moderation)) {
+		return failure(fmt.Sprintf("No such room %s!", roomName))
 	}
 	roomString := ""
 	for _, c := range room {
-		roomString = roomString + fmt.Sprintf("\t%s\n", c.Name)
+		roomString = roomString + fmt.Sprintf("\t%s\n", c.UserName())
 	}
-	return fmt.Sprintf("\nCurrent Members:\n%s", roomString), false
+	return reply(fmt.Sprintf("\nCurrent Members:\n%s", roomString))
 }
 
-func (c *Client) createRoom(roomName string) (string, bool) {
-	_, found := c.getRoomFromCacheByName(roomName)
-	if found {
-		return "Room already exists - use `\\join` to join the chat.", false
+func (c *Client) createRoom(value string) Response {
+	roomName, access, err := splitRoomOptions(value)
+	if err != nil {
+		return failure(fmt.Sprintf("Invalid room - %v.", err))
 	}
-	// Defer first since this since it also locks the mutex and this should run last.
-	// Leave any existing rooms this user is in since you can only be in 1.
-	defer c.leaveRoom(c.CurrentRoom)
+	err = c.Store.CreateRoom(roomName, c, access)
+	if err != nil {
+		return failure("Room already exists - use `\\join` to join the chat.")
+	}
+	c.publish(events.Event{Kind: events.RoomCreated, Room: roomName})
 
-	log.Printf("Creating Room: %s\n", roomName)
-	c.CurrentRoom = roomName
-	c.updateRoomInCache(roomName, []*Client{c})
+	// Stay in any other rooms, but talk in the new one from here on.
+	c.talkIn(roomName)
 
-	return fmt.Sprintf("New room created: %s", roomName), false
+	if !access.Listed() {
+		return reply(fmt.Sprintf("New %s room created: %s", access.Mode, roomName))
+	}
+	return reply(fmt.Sprintf("New room created: %s", roomName))
 }
 
-func (c *Client) joinRoom(roomName string) (string, bool) {
-	room, found := c.getRoomFromCacheByName(roomName)
-	if !found {
-		return fmt.Sprintf("Room `%s` doesn't exist - try creating it with `\\create`", roomName), false
+func (c *Client) joinRoom(value string) Response {
+	roomName, password := value, ""
+	moderation, found := c.Store.Moderation(roomName)
+	// Room names can have spaces in them, so only split a password off the end if the whole value isn't a room.
+	if i := strings.LastIndex(value, " "); !found && i > 0 {
+		if m, ok := c.Store.Moderation(value[:i]); ok {
+			roomName, password, moderation, found = value[:i], value[i+1:], m, true
+		}
+	}
+	if found && !c.inRoom(roomName) {
+		if response, allowed := c.canEnter(roomName, moderation, password); !allowed {
+			return failure(response)
+		}
+	}
+	err := c.Store.JoinRoom(roomName, c)
+	if err == ErrNoSuchRoom {
+		return failure(fmt.Sprintf("Room `%s` doesn't exist - try creating it with `\\create`", roomName))
+	}
+	if err == ErrAlreadyInRoom {
+		return failure(fmt.Sprintf("You're already in %s - use `\\switch %s` to talk in it.", roomName, roomName))
 	}
-	if c.CurrentRoom == roomName {
-		return fmt.Sprintf("You're already in %s!", roomName), false
+	if err == ErrBanned {
+		moderation, _ := c.Store.Moderation(roomName)
+		now := time.Now()
+		ban, _ := moderation.ActiveBan(c, now)
+		return failure(fmt.Sprintf("You're banned from %s %s.", roomName, ban.Remaining(now)))
 	}
-	// Defer first since this since it also locks the mutex and this should run last.
-	// Leave any existing rooms this user is in since you can only be in 1.
-	defer c.leaveRoom(c.CurrentRoom)
 
-	c.CurrentRoom = roomName
+	c.publish(events.Event{Kind: events.Join, Room: roomName})
+
+	// Stay in any other rooms, but talk in the new one from here on.
+	c.talkIn(roomName)
+	c.showTopic(roomName)
+	c.replayHistory(roomName)
 
-	room = append(room, c)
-	c.updateRoomInCache(roomName, room)
-	return fmt.Sprintf("%s has entered: %s", c.Name, roomName), true
+	return announce(roomName, eventJoin, fmt.Sprintf("%s has entered: %s", c.UserName(), roomName))
 }
 
 func (c *Client) leaveRoom(roomName string) {
@@ -193,102 +409,194 @@ func (c *Client) leaveRoom(roomName string) {
 		return
 	}
 
-	room, found := c.getRoomFromCacheByName(roomName)
-	// If this room doesn't exist then just return as a no-op here
-	if !found {
+	// If this room doesn't exist then just return as a no-op here.  The store takes care of deleting the room if
+	//	we were the last one in it.
+	err := c.Store.LeaveRoom(roomName, c)
+	if err != nil {
 		return
 	}
-	// Re-create the list of clients in the given room, minus whatever client we have in play since they are leaving.
-	prunedList := []*Client{}
-	for _, client := range room {
-		if c != client {
-			prunedList = append(prunedList, client)
-		}
-	}
-
-	/// If the room no longer has anyone in it after this user has been removed then delete it.
-	if len(prunedList) == 0 {
-		c.deleteRoomFromCache(roomName)
-	} else {
-		c.updateRoomInCache(roomName, prunedList)
-	}
+	c.droppedFrom(roomName)
+	c.publish(events.Event{Kind: events.Leave, Room: roomName})
 
 	// I hate to do this in here, but I don't really want to pass roomName up through all these methods and
 	//their associated conditions when 90% of the time it's going to be what's already on the client.  So
 	//leaving this for now.
-	go c.broadcastToRoom(fmt.Sprintf("%s has left %s.", c.Name, roomName), roomName)
-	// TODO - Consider the map version below relying on this data structure
-	//      {<room name>: {<client id>: <client pointer>} }
-	//// Delete this client from the rooms: clients mappings.
-	//if ChatCache.Rooms[roomName][clientName] != nil {
-	//    delete(ChatCache.Rooms[roomName], clientName)
-	//}
+	c.broadcastEvent(eventLeave, fmt.Sprintf("%s has left %s.", c.UserName(), roomName), roomName)
 }
 
-func (c *Client) directMessage(targetClient string) (string, bool) {
-	return "", false
+// The value here comes in as `<user name> <message>`.  Since user names are allowed to have spaces in them we can't
+//	just split on the first one, so instead we look for the longest user name the value starts with and treat
+//	everything after it as the message.
+func (c *Client) dmResponse(value string) Response {
+	targetName := ""
+	var target *Client
+	for _, client := range c.Store.ListClients() {
+		name := client.UserName()
+		// Names are unique ignoring case, so they can be messaged ignoring case too.
+		if len(value) > len(name) && value[len(name)] == ' ' && strings.EqualFold(value[:len(name)], name) &&
+			len(name) > len(targetName) {
+			targetName, target = name, client
+		}
+	}
+
+	if target == nil {
+		return failure("No such user to message - usage: `\\dm <user name> <message>`")
+	}
+	message := strings.TrimSpace(value[len(targetName):])
+	if message == "" {
+		return failure(fmt.Sprintf("No message given for %s - usage: `\\dm <user name> <message>`", targetName))
+	}
+	return Response{Audience: ToUser, Event: eventDirect, User: targetName, Payload: message, recipient: target}
 }
 
 func (c *Client) broadcastToRoom(message, roomName string) {
+	c.broadcastEvent(eventMessage, message, roomName)
+}
+
+// Let a room know about something that happened in it, like someone being kicked, as opposed to something someone
+//	said.
+func (c *Client) broadcastNotice(message, roomName string) {
+	c.broadcastEvent(eventNotice, message, roomName)
+}
+
+// The same as `broadcastNotice`, for the things that happen often enough to get an event of their own (ex.
+//	`eventJoin`), so clients speaking JSON can tell them apart without reading the message.
+func (c *Client) broadcastEvent(event, message, roomName string) {
+	c.broadcastResponse(Response{Audience: ToRoom, Event: event, Room: roomName, Payload: message})
+}
+
+// Send everyone in the response's room a copy of it, from this client.  Anything more the event needs (ex. the
+//	`OldName` for a rename) goes along with it, for the renderers that make use of it.
+func (c *Client) broadcastResponse(r Response) {
 	// We don't care if the room was found or not, since we'll detect and empty room (or one where this client is
 	//the only one in it) and send the message only to that client.
-	room, _ := c.getRoomFromCacheByName(roomName)
+	room, found := c.Store.MembersOf(r.Room)
+	if found {
+		kind := events.Message
+		if r.notice() {
+			kind = events.Notice
+		}
+		c.publish(events.Event{Kind: kind, Room: r.Room, Text: r.Payload})
+	}
 	// If no one is in the room I'm in then just send it to myself.
 	if len(room) < 1 {
-		c.WriteResponse(message, nil)
+		c.WriteResponse(Response{Audience: ToSelf, Event: r.Event, Payload: r.Payload})
 	}
+	r.Audience, r.Sender = ToRoom, c.UserName()
 	for _, targetClient := range room {
-		targetClient.WriteResponse(message, c.Name)
+		targetClient.WriteResponse(r)
+	}
+}
+
+// Let every room the client is in know they're on their way out, and not just leaving the room.
+func (c *Client) broadcastDeparture(message string) {
+	departure := Response{Audience: ToRoom, Event: eventLeave, Payload: message, Disconnect: true, id: nextResponseId()}
+	c.broadcastToOtherRooms(departure)
+	if roomName := c.ActiveRoom(); roomName != "" {
+		departure.Room = roomName
+		c.broadcastResponse(departure)
 	}
 }
 
+// Post a message into a room on behalf of something other than a connected user - a script, a bot, the API.  The
+//	sender's name is wrapped in brackets so nobody can mistake it for (or pass themselves off as) a real user.  They
+//	only get to post where anyone could `\join` and say it themselves, so never into a password or invite-only room.
+func PostToRoom(store ChatStore, sender, roomName, message string) error {
+	rules := NameRules
+	rules.Reserved = nil
+	err := rules.Validate(sender)
+	if err != nil {
+		return fmt.Errorf("Invalid sender - %v", err)
+	}
+	moderation, found := store.Moderation(roomName)
+	if !found {
+		return ErrNoSuchRoom
+	}
+	if !moderation.Open() {
+		return ErrNotOpen
+	}
+	system := &Client{
+		Writer: ioutil.Discard,
+		Name:   fmt.Sprintf("[%s]", sender),
+		Store:  store,
+	}
+	system.broadcastToRoom(message, roomName)
+	return nil
+}
+
 func (c *Client) listen() {
 	r := bufio.NewReader(c.Conn)
 	defer c.removeConnection()
 
+	warned := false
 	for {
+		c.extendIdleDeadline(warned)
 		input, err := Read(r)
-		if err != nil && err != io.EOF {
+		// NOTE: This fires only when the Client kills its connection, or when the server closes it on shutdown.
+		if err == io.EOF || errors.Is(err, net.ErrClosed) {
+			break
+		}
+		// They've gone quiet - warn them the first time, and hang up on them the next.
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if warned = c.idleTimedOut(warned); warned {
+				continue
+			}
+			break
+		}
+		warned = false
+		// Anything else (a reset connection, a failed TLS handshake) will just keep failing, so hang up on those too.
+		if err != nil {
 			log.Printf("Read error: %v\n", err)
-			c.WriteResponse(input, nil)
+			break
 		}
-
-		// NOTE: This fires only when the Client kills its connection
-		if err == io.EOF {
+		if c.irc != nil {
+			if c.handleIRC(input) {
+				continue
+			}
+			break
+		}
+		if c.speaksJSON() {
+			if c.handleJSON(input) {
+				continue
+			}
 			break
 		}
 
 		if input != "" {
 			// These should be commands from the user
 			if strings.HasPrefix(input, "\\") {
-				response, toBroadcast, err := c.parseResponse(input)
-				if err != nil {
-					go c.broadcastToRoom(response, c.CurrentRoom)
-					break // Sever the connection to this client
+				response := c.parseResponse(input)
+				if own := c.deliver(response); own.Payload != "" {
+					c.WriteResponse(own)
 				}
-				if response != "" {
-					if toBroadcast {
-						go c.broadcastToRoom(response, c.CurrentRoom)
-					} else {
-						c.WriteResponse(response, nil)
-					}
+				if response.Disconnect {
+					break // Sever the connection to this client
 				}
-			} else if c.CurrentRoom != "" {
-				go c.broadcastToRoom(input, c.CurrentRoom)
+			} else if roomName := c.ActiveRoom(); roomName == "" {
+				c.WriteResponse(Response{Audience: ToSelf, Event: eventMessage, Payload: input})
+			} else if notice, muted := c.mutedIn(roomName); muted {
+				c.WriteResponse(serverNotice(notice))
 			} else {
-				c.WriteResponse(input, nil)
+				c.broadcastToRoom(input, roomName)
 			}
 		}
 
 	}
 }
 
-// Here we will handle any commands and return anything we want to send back to the client.  If we want this to
-//  be "broadcast" (to every client in the chat room) we can answer `true` with the accompanying bool.  Most methods
-// should actually return their own values to decide whether their message gets broadcast or not, so we can send
-//error messages privately, etc.
-// TODO - create response type structs instead of returning all this willy nilly?
-func (c *Client) parseResponse(cmd string) (string, bool, error) {
+// Here we will look the command up in `Commands` and run it, returning its response for `deliver` to send on.  Each
+//  command's handler decides who hears about what it did, so we can send error messages privately, etc.
+func (c *Client) parseResponse(cmd string) Response {
+	command, value, problem := c.findCommand(cmd)
+	if command == nil {
+		return failure(problem)
+	}
+	return command.Handler(c, value)
+}
+
+// Split the command from its value and look it up in `Commands`, checking the client is allowed to run it as given.
+//	If they aren't, there's no command, just the reason why.
+func (c *Client) findCommand(cmd string) (*Command, string, string) {
 	value := ""
 	// Attempt to split the command from the proceeding value, determined by a space (if applicable)
 	cmdIndex := strings.IndexByte(cmd, ' ')
@@ -296,38 +604,15 @@ func (c *Client) parseResponse(cmd string) (string, bool, error) {
 		value = strings.TrimSpace(cmd[cmdIndex:])
 		cmd = cmd[:cmdIndex]
 	}
-	switch {
-	case cmd == "\\dm" && value != "":
-		//TODO
-	case cmd == "\\name" && value != "":
-		response, toBroadcast := c.changeClientName(value)
-		return response, toBroadcast, nil
-	case cmd == "\\create" && value != "":
-		response, toBroadcast := c.createRoom(value)
-		return response, toBroadcast, nil
-	case cmd == "\\join" && value != "":
-		response, toBroadcast := c.joinRoom(value)
-		return response, toBroadcast, nil
-	case cmd == "\\list" && value != "": // list people in another room
-		response, toBroadcast := c.listMembers(value)
-		return response, toBroadcast, nil
-	case cmd == "\\leave":
-		roomName := c.CurrentRoom
-		c.leaveRoom(c.CurrentRoom)
-		c.CurrentRoom = "" // Set this here because leaveRoom is called from all over
-
-		return fmt.Sprintf("You have left room %s", roomName), false, nil
-	case cmd == "\\list": // list the members of your current room
-		response, toBroadcast := c.listMembers(c.CurrentRoom)
-		return response, toBroadcast, nil
-	case cmd == "\\list-rooms":
-		response, toBroadcast := c.listRooms()
-		return response, toBroadcast, nil
-	case cmd == "\\whoami":
-		response, toBroadcast := c.displayClientStats()
-		return response, toBroadcast, nil
-	case cmd == "\\exit":
-		return fmt.Sprintf("%s has gone offline", c.Name), true, io.EOF
-	}
-	return fmt.Sprintf("Invalid command: `%s`", cmd), false, nil
+	command, found := Commands.Lookup(cmd)
+	if !found {
+		return nil, "", fmt.Sprintf("Invalid command: `%s`", cmd)
+	}
+	if response, ok := c.permitted(command); !ok {
+		return nil, "", response
+	}
+	if command.ArgSpec == RequiredArgs && value == "" {
+		return nil, "", fmt.Sprintf("Missing value - usage: `%s`", command.Usage())
+	}
+	return command, value, ""
 }
@@ -2,13 +2,15 @@ package clients
 
 import (
 	"bou.ke/monkey"
+	"bytes"
+	"chat-telnet/ids"
 	"chat-telnet/interfaces"
 	"chat-telnet/mocks"
 	"fmt"
-	cache2 "github.com/patrickmn/go-cache"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -19,17 +21,50 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
+// Build a store with the given clients connected and sitting in whatever their `CurrentRoom` is set to.
+func seedStore(clientList ...*Client) *MemoryStore {
+	store := NewMemoryStore()
+	for _, c := range clientList {
+		c.Store = store
+		store.AddClient(c)
+		if c.CurrentRoom == "" {
+			continue
+		}
+		if store.JoinRoom(c.CurrentRoom, c) == ErrNoSuchRoom {
+			store.CreateRoom(c.CurrentRoom, c, RoomAccess{})
+		}
+	}
+	return store
+}
+
 func Test_GenerateNewClient_success(t *testing.T) {
 	// Kill the listen loop
 	monkey.Patch(Read, func(a interfaces.AbstractBufioReader) (string, error) {
 		return "", io.EOF
 	})
 	defer monkey.Unpatch(Read)
-	err := GenerateNewClient(&mocks.NetConnMock{}, cache2.New(cache2.NoExpiration, cache2.NoExpiration))
+	err := GenerateNewClient(&mocks.NetConnMock{}, NewMemoryStore())
 	assert.Nil(t, err)
 }
 
-func Test_GenerateNewClient_client_already_exists_error(t *testing.T) {
+func Test_GenerateNewClient_uses_IdGenerator(t *testing.T) {
+	// Kill the listen loop
+	monkey.Patch(Read, func(a interfaces.AbstractBufioReader) (string, error) {
+		return "", io.EOF
+	})
+	defer monkey.Unpatch(Read)
+	defer func(g ids.Generator) { IdGenerator = g }(IdGenerator)
+	IdGenerator = &ids.SequenceGenerator{}
+
+	conn := &mocks.NetConnMock{}
+	store := NewMemoryStore()
+	err := GenerateNewClient(conn, store)
+
+	assert.Nil(t, err)
+	assert.Contains(t, string(conn.CalledWith), "Your user name has been automatically set to `guest-1`")
+}
+
+func Test_GenerateNewClient_same_instant_connections_do_not_collide(t *testing.T) {
 	// Kill the listen loop
 	monkey.Patch(Read, func(a interfaces.AbstractBufioReader) (string, error) {
 		return "", io.EOF
@@ -40,13 +75,27 @@ func Test_GenerateNewClient_client_already_exists_error(t *testing.T) {
 	})
 	defer monkey.Unpatch(time.Now)
 
-	cm := &mocks.CacheMock{}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string]*Client{"1650452400": &Client{}}, true
-	}
+	store := NewMemoryStore()
+	err1 := GenerateNewClient(&mocks.NetConnMock{}, store)
+	err2 := GenerateNewClient(&mocks.NetConnMock{}, store)
+
+	assert.Nil(t, err1)
+	assert.Nil(t, err2)
+}
+
+func Test_GenerateNewClient_client_already_exists_error(t *testing.T) {
+	// Kill the listen loop
+	monkey.Patch(Read, func(a interfaces.AbstractBufioReader) (string, error) {
+		return "", io.EOF
+	})
+	defer monkey.Unpatch(Read)
+	defer func(g ids.Generator) { IdGenerator = g }(IdGenerator)
+	IdGenerator = &ids.SequenceGenerator{}
+
+	store := seedStore(&Client{Id: "1"})
 
-	err := GenerateNewClient(&mocks.NetConnMock{}, cm)
-	assert.Equal(t, "User Conflict: 1650452400 user already in service. Please try again.", fmt.Sprint(err))
+	err := GenerateNewClient(&mocks.NetConnMock{}, store)
+	assert.Equal(t, "User Conflict: guest-1 user already in service. Please try again.", fmt.Sprint(err))
 }
 
 func Test_WriteString_success(t *testing.T) {
@@ -82,7 +131,7 @@ func Test_WriteString_write_error(t *testing.T) {
 	assert.Error(t, err)
 }
 
-func Test_WriteResponse_success_no_sendingClient(t *testing.T) {
+func Test_WriteResponse_success_own_response(t *testing.T) {
 	w := &mocks.IoWriterMock{}
 	m := &Client{
 		Writer:      w,
@@ -96,13 +145,13 @@ func Test_WriteResponse_success_no_sendingClient(t *testing.T) {
 	})
 	defer monkey.Unpatch(time.Now)
 
-	err := m.WriteResponse("Hi", nil)
+	err := m.WriteResponse(reply("Hi"))
 
 	assert.Nil(t, err)
 	assert.Equal(t, "1650452400: Han Solo> Hi\n", string(w.WriteCalledWith))
 }
 
-func Test_WriteResponse_success_with_sendingClient(t *testing.T) {
+func Test_WriteResponse_success_from_someone_else(t *testing.T) {
 	w := &mocks.IoWriterMock{}
 	m := &Client{
 		Writer:      w,
@@ -115,7 +164,7 @@ func Test_WriteResponse_success_with_sendingClient(t *testing.T) {
 		return time.Date(2022, 04, 20, 11, 00, 00, 00, time.UTC)
 	})
 	defer monkey.Unpatch(time.Now)
-	err := m.WriteResponse("Hi", "Leia Organa")
+	err := m.WriteResponse(Response{Audience: ToEveryone, Event: eventNotice, Sender: "Leia Organa", Payload: "Hi"})
 
 	assert.Nil(t, err)
 	assert.Equal(t, "1650452400: Leia Organa: Hi\n", string(w.WriteCalledWith))
@@ -134,11 +183,52 @@ func Test_WriteResponse_returns_error(t *testing.T) {
 		CurrentRoom: "",
 		Id:          "test-id",
 	}
-	err := m.WriteResponse("Hi", nil)
+	err := m.WriteResponse(reply("Hi"))
 
 	assert.Error(t, err)
 }
 
+func Test_WriteResponse_success_direct_message(t *testing.T) {
+	w := &mocks.IoWriterMock{}
+	m := &Client{
+		Writer:      w,
+		Conn:        &mocks.NetConnMock{},
+		Name:        "Han Solo",
+		CurrentRoom: "",
+		Id:          "test-id",
+	}
+	monkey.Patch(time.Now, func() time.Time {
+		return time.Date(2022, 04, 20, 11, 00, 00, 00, time.UTC)
+	})
+	defer monkey.Unpatch(time.Now)
+	err := m.WriteResponse(Response{Audience: ToUser, Event: eventDirect, Sender: "Leia Organa", Payload: "Hi"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1650452400: [DM] Leia Organa: Hi\n", string(w.WriteCalledWith))
+}
+
+
+func Test_DisconnectAll_success(t *testing.T) {
+	w1 := &mocks.IoWriterMock{}
+	w2 := &mocks.IoWriterMock{}
+	conn1 := &mocks.NetConnMock{}
+	conn2 := &mocks.NetConnMock{}
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: w1, Conn: conn1}
+	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "", Writer: w2, Conn: conn2}
+	store := seedStore(c1, c2)
+	monkey.Patch(time.Now, func() time.Time {
+		return time.Date(2022, 04, 20, 11, 00, 00, 00, time.UTC)
+	})
+	defer monkey.Unpatch(time.Now)
+
+	DisconnectAll(store, 0)
+
+	assert.Equal(t, "1650452400: Server: Chattington is shutting down in 0s - see you next time!\n", string(w1.WriteCalledWith))
+	assert.Equal(t, "1650452400: Server: Chattington is shutting down in 0s - see you next time!\n", string(w2.WriteCalledWith))
+	assert.True(t, conn1.CloseCalled)
+	assert.True(t, conn2.CloseCalled)
+}
+
 func Test_Read_success(t *testing.T) {
 	m := &mocks.ReaderMock{}
 	_, err := Read(m)
@@ -161,222 +251,269 @@ func Test_Read_returns_error(t *testing.T) {
 }
 
 func Test_removeConnection_success(t *testing.T) {
-	cm := &mocks.CacheMock{}
-	c := &Client{Id: "123", Conn: &mocks.NetConnMock{}, Cache: cm}
+	useTestHistory(t)
+	conn := &mocks.NetConnMock{}
+	c := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Conn: conn, Writer: &mocks.IoWriterMock{}}
+	w := &mocks.IoWriterMock{}
+	chewie := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom", Writer: w}
+	store := seedStore(c, chewie)
 
-	// Seed the cache
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string]*Client{c.Id: c}, true
-	}
+	c.removeConnection()
+
+	assert.Equal(t, []*Client{chewie}, store.ListClients())
+	assert.True(t, conn.CloseCalled)
+	assert.Contains(t, string(w.WriteCalledWith), "[broom] Han Solo: Han Solo has gone offline\n")
+}
+
+func Test_removeConnection_last_one_out(t *testing.T) {
+	conn := &mocks.NetConnMock{}
+	c := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Conn: conn, Writer: &mocks.IoWriterMock{}}
+	store := seedStore(c)
 
 	c.removeConnection()
 
-	assert.Equal(t, CLIENTS, cm.GetCalledWithKey)
-	assert.Equal(t, CLIENTS, cm.SetCalledWithKey)
-	assert.Equal(t, map[string]*Client{}, cm.SetCalledWithInterface)
-	assert.Equal(t, cache2.NoExpiration, cm.SetCalledWithDuration)
+	assert.Empty(t, store.ListClients())
+	assert.Empty(t, store.ListRooms())
+	assert.True(t, conn.CloseCalled)
 }
 
 func Test_changeClientName_success(t *testing.T) {
-	cm := &mocks.CacheMock{}
-	c := &Client{Id: "123", Name: "Han Solo", Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string]*Client{c.Id: c}, true
-	}
-	c.changeClientName("Luke Skywalker")
+	c := &Client{Id: "123", Name: "Han Solo"}
+	store := seedStore(c)
+
+	response := c.changeClientName("Luke Skywalker")
+
+	assert.Equal(t, "User: Han Solo has become -> Luke Skywalker", response.Payload)
+	assert.Equal(t, ToRoom, response.Audience)
+	assert.Equal(t, "Luke Skywalker", store.ListClients()[0].Name)
+}
+
+func Test_changeClientName_invalid_name(t *testing.T) {
+	c := &Client{Id: "123", Name: "Han Solo"}
+	seedStore(c)
+
+	response := c.changeClientName(strings.Repeat("Jar Jar ", 1280))
+
+	assert.Equal(t, "Invalid name - names can be at most 32 characters long.", response.Payload)
+	assert.Equal(t, eventError, response.Event)
+	assert.Equal(t, "Han Solo", c.Name)
+}
+
+func Test_changeClientName_reserved_name(t *testing.T) {
+	c := &Client{Id: "123", Name: "Han Solo"}
+	seedStore(c)
+
+	response := c.changeClientName("Server")
 
-	assert.Equal(t, CLIENTS, cm.GetCalledWithKey)
-	assert.Equal(t, CLIENTS, cm.SetCalledWithKey)
-	assert.IsType(t, map[string]*Client{}, cm.SetCalledWithInterface)
-	assert.Equal(t, "Luke Skywalker", cm.SetCalledWithInterface.(map[string]*Client)[c.Id].Name)
-	assert.Equal(t, cache2.NoExpiration, cm.SetCalledWithDuration)
+	assert.Equal(t, "Invalid name - that name is reserved.", response.Payload)
+	assert.Equal(t, eventError, response.Event)
+	assert.Equal(t, "Han Solo", c.Name)
+}
+
+func Test_changeClientName_name_taken(t *testing.T) {
+	c1 := &Client{Id: "123", Name: "Han Solo"}
+	c2 := &Client{Id: "456", Name: "Chewbacca"}
+	seedStore(c1, c2)
+
+	response := c2.changeClientName("HAN SOLO")
+
+	assert.Equal(t, "Invalid name - `HAN SOLO` is already taken, please pick another.", response.Payload)
+	assert.Equal(t, eventError, response.Event)
+	assert.Equal(t, "Chewbacca", c2.Name)
 }
 
 func Test_displayClientStats_success(t *testing.T) {
 	c := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom"}
-	response, b := c.displayClientStats()
+	response := c.displayClientStats()
 
-	assert.Equal(t, "\nClient Name: Han Solo\nCurrent Room: broom", response)
-	assert.False(t, b)
+	assert.Equal(t, "\nClient Name: Han Solo\nCurrent Room: broom\nAll Rooms: None", response.Payload)
+	assert.Equal(t, eventCommandResult, response.Event)
 }
 
 func Test_listRooms_success(t *testing.T) {
-	cm := &mocks.CacheMock{}
-	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Cache: cm}
-	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom", Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string][]*Client{"broom": {c1, c2}}, true
-	}
-	response, b := c1.listRooms()
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom"}
+	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom"}
+	c3 := &Client{Id: "789", Name: "Lando Calrissian", CurrentRoom: "azure"}
+	seedStore(c1, c2, c3)
 
-	assert.Equal(t, "\nCurrent rooms: \n  Room: broom\n  Members:\n\tHan Solo\n\tChewbacca\n", response)
-	assert.False(t, b)
+	response := c1.listRooms()
 
-	assert.Equal(t, ROOMS, cm.GetCalledWithKey)
-	assert.False(t, cm.SetCalled)
+	assert.Equal(t, "\nCurrent rooms: \n  Room: azure\n  Members:\n\tLando Calrissian\n  Room: broom\n  Members:\n\tHan Solo\n\tChewbacca\n", response.Payload)
+	assert.Equal(t, eventCommandResult, response.Event)
 }
 
 func Test_listRooms_no_rooms(t *testing.T) {
-	cm := &mocks.CacheMock{}
-	c := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string][]*Client{}, false
-	}
+	c := &Client{Id: "123", Name: "Han Solo"}
+	seedStore(c)
 
-	response, b := c.listRooms()
+	response := c.listRooms()
 
-	assert.Equal(t, "No rooms yet - make one!", response)
-	assert.False(t, b)
-	assert.Equal(t, ROOMS, cm.GetCalledWithKey)
+	assert.Equal(t, "No rooms yet - make one!", response.Payload)
+	assert.Equal(t, eventCommandResult, response.Event)
 }
 
 func Test_listMembers_success(t *testing.T) {
-	cm := &mocks.CacheMock{}
-	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Cache: cm}
-	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom", Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string][]*Client{"broom": {c1, c2}}, true
-	}
-	response, b := c1.listMembers("broom")
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom"}
+	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom"}
+	seedStore(c1, c2)
+
+	response := c1.listMembers("broom")
 
-	assert.Equal(t, "\nCurrent Members:\n\tHan Solo\n\tChewbacca\n", response)
-	assert.False(t, b)
-	assert.Equal(t, ROOMS, cm.GetCalledWithKey)
+	assert.Equal(t, "\nCurrent Members:\n\tHan Solo\n\tChewbacca\n", response.Payload)
+	assert.Equal(t, eventCommandResult, response.Event)
 }
 
 func Test_listMembers_invalid_roomName(t *testing.T) {
-	cm := &mocks.CacheMock{}
-	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Cache: cm}
-	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom", Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string][]*Client{"broom": {c1, c2}}, true
-	}
-	response, b := c1.listMembers("vroom")
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom"}
+	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom"}
+	seedStore(c1, c2)
+
+	response := c1.listMembers("vroom")
 
-	assert.Equal(t, "No such room vroom!", response)
-	assert.False(t, b)
-	assert.Equal(t, ROOMS, cm.GetCalledWithKey)
+	assert.Equal(t, "No such room vroom!", response.Payload)
+	assert.Equal(t, eventError, response.Event)
 }
 
 func Test_createRoom_success(t *testing.T) {
-	cm := &mocks.CacheMock{}
-	c := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}, Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string][]*Client{"broom": {c}}, true
-	}
+	c := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}}
+	store := seedStore(c)
+
+	response := c.createRoom("mushroom")
+
+	assert.Equal(t, "New room created: mushroom", response.Payload)
+	assert.Equal(t, eventCommandResult, response.Event)
+
+	assert.Equal(t, "mushroom", c.CurrentRoom)
+	// Creating a room doesn't take anyone out of the rooms they were already in.
+	assert.Equal(t, map[string][]*Client{"broom": {c}, "mushroom": {c}}, store.ListRooms())
+}
 
-	response, b := c.createRoom("mushroom")
+func Test_createRoom_room_already_exists(t *testing.T) {
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}}
+	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "mushroom", Writer: &mocks.IoWriterMock{}}
+	store := seedStore(c1, c2)
 
-	assert.Equal(t, "New room created: mushroom", response)
-	assert.False(t, b)
+	response := c1.createRoom("mushroom")
 
-	// TODO - figure out a good pattern to assert on function taking multiple calls.  Right now my mock will only
-	// 	provide the calls for the last one.
-	assert.Equal(t, ROOMS, cm.GetCalledWithKey)
-	assert.Equal(t, 2, cm.SetCallCount)
+	assert.Equal(t, "Room already exists - use `\\join` to join the chat.", response.Payload)
+	assert.Equal(t, eventError, response.Event)
+
+	assert.Equal(t, "broom", c1.CurrentRoom)
+	assert.Equal(t, map[string][]*Client{"broom": {c1}, "mushroom": {c2}}, store.ListRooms())
 }
 
 func Test_joinRoom_success(t *testing.T) {
-	cm := &mocks.CacheMock{}
-	c := &Client{Id: "123", Name: "Han Solo", Writer: &mocks.IoWriterMock{}, Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string][]*Client{"broom": {}}, true
-	}
+	c1 := &Client{Id: "123", Name: "Han Solo", Writer: &mocks.IoWriterMock{}}
+	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}}
+	store := seedStore(c1, c2)
 
-	response, b := c.joinRoom("broom")
+	response := c1.joinRoom("broom")
 
-	assert.Equal(t, "Han Solo has entered: broom", response)
-	assert.True(t, b)
+	assert.Equal(t, "Han Solo has entered: broom", response.Payload)
+	assert.Equal(t, ToRoom, response.Audience)
 
-	assert.Equal(t, "broom", c.CurrentRoom)
-	assert.Equal(t, ROOMS, cm.GetCalledWithKey)
-	assert.Equal(t, ROOMS, cm.SetCalledWithKey)
-	assert.Equal(t, []*Client{c}, cm.SetCalledWithInterface.(map[string][]*Client)["broom"])
+	assert.Equal(t, "broom", c1.CurrentRoom)
+	room, _ := store.MembersOf("broom")
+	assert.Equal(t, []*Client{c2, c1}, room)
 }
 
 func Test_joinRoom_room_does_not_exist(t *testing.T) {
-	cm := &mocks.CacheMock{}
-	c := &Client{Id: "123", Name: "Han Solo", Writer: &mocks.IoWriterMock{}, Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string][]*Client{}, true
-	}
+	c := &Client{Id: "123", Name: "Han Solo", Writer: &mocks.IoWriterMock{}}
+	store := seedStore(c)
 
-	response, b := c.joinRoom("vroom")
+	response := c.joinRoom("vroom")
 
 	assert.Equal(t, "", c.CurrentRoom)
-	assert.Equal(t, "Room `vroom` doesn't exist - try creating it with `\\create`", response)
-	assert.False(t, b)
+	assert.Equal(t, "Room `vroom` doesn't exist - try creating it with `\\create`", response.Payload)
+	assert.Equal(t, eventError, response.Event)
 
-	assert.False(t, cm.SetCalled)
+	assert.Empty(t, store.ListRooms())
 }
 
 func Test_joinRoom_already_in_room(t *testing.T) {
-	cm := &mocks.CacheMock{}
-	c := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}, Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string][]*Client{"broom": {c}}, true
-	}
-	response, b := c.joinRoom("broom")
+	c := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}}
+	store := seedStore(c)
+
+	response := c.joinRoom("broom")
 
 	assert.Equal(t, "broom", c.CurrentRoom)
-	assert.Equal(t, "You're already in broom!", response)
-	assert.False(t, b)
+	assert.Equal(t, "You're already in broom - use `\\switch broom` to talk in it.", response.Payload)
+	assert.Equal(t, eventError, response.Event)
 
-	assert.False(t, cm.SetCalled)
+	assert.Equal(t, map[string][]*Client{"broom": {c}}, store.ListRooms())
 }
 
 func Test_leaveRoom_success(t *testing.T) {
-	cm := &mocks.CacheMock{}
-	w2 := &mocks.IoWriterMock{}
-	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}, Cache: cm}
-	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom", Writer: w2, Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string][]*Client{"broom": {c1, c2}}, true
-	}
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}}
+	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}}
+	store := seedStore(c1, c2)
 
 	c1.leaveRoom("broom")
 
-	assert.Equal(t, ROOMS, cm.GetCalledWithKey)
-	assert.Equal(t, ROOMS, cm.SetCalledWithKey)
-	assert.Equal(t, []*Client{c2}, cm.SetCalledWithInterface.(map[string][]*Client)["broom"])
+	room, _ := store.MembersOf("broom")
+	assert.Equal(t, []*Client{c2}, room)
 }
 
 func Test_leaveRoom_empty_string_room_name(t *testing.T) {
-	cm := &mocks.CacheMock{}
 	w2 := &mocks.IoWriterMock{}
-	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}, Cache: cm}
-	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom", Writer: w2, Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string][]*Client{"broom": {c1, c2}}, true
-	}
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}}
+	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom", Writer: w2}
+	store := seedStore(c1, c2)
 
 	c1.leaveRoom("")
 
 	assert.False(t, w2.WriteCalled)
-	assert.False(t, cm.SetCalled)
+	room, _ := store.MembersOf("broom")
+	assert.Equal(t, []*Client{c1, c2}, room)
 }
 
 func Test_leaveRoom_empties_out_room_destroys_room(t *testing.T) {
-	cm := &mocks.CacheMock{}
-	c := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}, Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string][]*Client{"broom": {c}}, true
-	}
+	c := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}}
+	store := seedStore(c)
 
 	c.leaveRoom("broom")
 
-	assert.Equal(t, map[string][]*Client{}, cm.SetCalledWithInterface.(map[string][]*Client))
+	assert.Equal(t, map[string][]*Client{}, store.ListRooms())
+}
+
+// Who gets a DM is worked out up front, with the DM itself going out when the response is delivered.
+func Test_dmResponse(t *testing.T) {
+	c1 := &Client{Id: "123", Name: "Han Solo", Writer: &mocks.IoWriterMock{}}
+	leia := &Client{Id: "456", Name: "Leia Organa", Writer: &mocks.IoWriterMock{}}
+	c3 := &Client{Id: "789", Name: "Stormtrooper", Writer: &mocks.IoWriterMock{}}
+	tk421 := &Client{Id: "012", Name: "Stormtrooper TK-421", Writer: &mocks.IoWriterMock{}}
+	seedStore(c1, leia, c3, tk421)
+
+	var tests = []struct {
+		input    string
+		expected Response
+	}{
+		{
+			"Leia Organa Help me Obi-Wan",
+			Response{Audience: ToUser, Event: eventDirect, User: "Leia Organa", Payload: "Help me Obi-Wan", recipient: leia},
+		},
+		{
+			"leia organa Help me Obi-Wan",
+			Response{Audience: ToUser, Event: eventDirect, User: "Leia Organa", Payload: "Help me Obi-Wan", recipient: leia},
+		},
+		{"Greedo Put down the blaster", failure("No such user to message - usage: `\\dm <user name> <message>`")},
+		{
+			"Stormtrooper TK-421 Why aren't you at your post?",
+			Response{Audience: ToUser, Event: eventDirect, User: "Stormtrooper TK-421", Payload: "Why aren't you at your post?", recipient: tk421},
+		},
+		{"Leia Organa ", failure("No message given for Leia Organa - usage: `\\dm <user name> <message>`")},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, c1.dmResponse(tt.input), tt.input)
+	}
 }
 
 func Test_broadcastToRoom_success(t *testing.T) {
-	cm := &mocks.CacheMock{}
 	w1 := &mocks.IoWriterMock{}
 	w2 := &mocks.IoWriterMock{}
-	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: w1, Cache: cm}
-	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom", Writer: w2, Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string][]*Client{"broom": {c1, c2}}, true
-	}
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: w1}
+	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom", Writer: w2}
+	seedStore(c1, c2)
 
 	monkey.Patch(time.Now, func() time.Time {
 		return time.Date(2022, 04, 20, 11, 00, 00, 00, time.UTC)
@@ -385,17 +522,14 @@ func Test_broadcastToRoom_success(t *testing.T) {
 
 	c1.broadcastToRoom("test", "broom")
 
-	assert.Equal(t, "1650452400: Han Solo> test\n", string(w1.WriteCalledWith))
-	assert.Equal(t, "1650452400: Han Solo: test\n", string(w2.WriteCalledWith))
+	assert.Equal(t, "1650452400: [broom] Han Solo> test\n", string(w1.WriteCalledWith))
+	assert.Equal(t, "1650452400: [broom] Han Solo: test\n", string(w2.WriteCalledWith))
 }
 
 func Test_broadcastToRoom_alone_write_to_self(t *testing.T) {
-	cm := &mocks.CacheMock{}
 	w1 := &mocks.IoWriterMock{}
-	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: w1, Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string][]*Client{"broom": {c1}}, true
-	}
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: w1}
+	seedStore(c1)
 	monkey.Patch(time.Now, func() time.Time {
 		return time.Date(2022, 04, 20, 11, 00, 00, 00, time.UTC)
 	})
@@ -403,69 +537,115 @@ func Test_broadcastToRoom_alone_write_to_self(t *testing.T) {
 
 	c1.broadcastToRoom("test", "broom")
 
-	assert.Equal(t, "1650452400: Han Solo> test\n", string(w1.WriteCalledWith))
+	assert.Equal(t, "1650452400: [broom] Han Solo> test\n", string(w1.WriteCalledWith))
+}
+
+func Test_PostToRoom_success(t *testing.T) {
+	w1 := &mocks.IoWriterMock{}
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: w1}
+	store := seedStore(c1)
+	monkey.Patch(time.Now, func() time.Time {
+		return time.Date(2022, 04, 20, 11, 00, 00, 00, time.UTC)
+	})
+	defer monkey.Unpatch(time.Now)
+
+	err := PostToRoom(store, "deploy-bot", "broom", "Shipped!")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "1650452400: [broom] [deploy-bot]: Shipped!\n", string(w1.WriteCalledWith))
+}
+
+func Test_PostToRoom_no_such_room(t *testing.T) {
+	store := seedStore()
+
+	err := PostToRoom(store, "deploy-bot", "broom", "Shipped!")
+
+	assert.Equal(t, ErrNoSuchRoom, err)
+}
+
+func Test_PostToRoom_room_not_open(t *testing.T) {
+	store := seedStore()
+	store.SeedRoom("den", RoomModeration{RoomAccess: RoomAccess{Mode: PasswordRoom}})
+	store.SeedRoom("palace", RoomModeration{RoomAccess: RoomAccess{Mode: InviteOnlyRoom}})
+	store.SeedRoom("hideout", RoomModeration{RoomAccess: RoomAccess{Mode: UnlistedRoom}})
+
+	assert.Equal(t, ErrNotOpen, PostToRoom(store, "deploy-bot", "den", "Shipped!"))
+	assert.Equal(t, ErrNotOpen, PostToRoom(store, "deploy-bot", "palace", "Shipped!"))
+	assert.Nil(t, PostToRoom(store, "deploy-bot", "hideout", "Shipped!"))
+}
+
+func Test_PostToRoom_invalid_sender(t *testing.T) {
+	w1 := &mocks.IoWriterMock{}
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: w1}
+	store := seedStore(c1)
+
+	err := PostToRoom(store, "bot\x07", "broom", "Shipped!")
+
+	assert.Equal(t, "Invalid sender - names can only contain letters, numbers and any of ` -_.'`", fmt.Sprint(err))
+	assert.False(t, w1.WriteCalled)
 }
 
 func Test_parseResponse_one_client_required(t *testing.T) {
-	cm := cache2.New(cache2.NoExpiration, cache2.NoExpiration)
-	c := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "", Writer: &mocks.IoWriterMock{}, Cache: cm}
+	c := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "", Writer: &mocks.IoWriterMock{}}
+	seedStore(c)
 
 	var tests = []struct {
-		input         string
-		expectedStr   string
-		expectedBool  bool
-		expectedError error
+		input              string
+		expectedStr        string
+		expectedAudience   Audience
+		expectedDisconnect bool
 	}{
-		{"\\name Lando Calrissian", "User: Han Solo has become -> Lando Calrissian", true, nil},
-		{"\\create broom", "New room created: broom", false, nil},
-		{"\\list", "\nCurrent Members:\n\tLando Calrissian\n", false, nil},
-		{"\\list-rooms", "\nCurrent rooms: \n  Room: broom\n  Members:\n\tLando Calrissian\n", false, nil},
-		{"\\whoami", "\nClient Name: Lando Calrissian\nCurrent Room: broom", false, nil},
-		{"\\leave", "You have left room broom", false, nil},
-		{"\\invalid-command", "Invalid command: `\\invalid-command`", false, nil},
-		{"\\exit", "Lando Calrissian has gone offline", true, io.EOF},
+		{"\\name Lando Calrissian", "User: Han Solo has become -> Lando Calrissian", ToRoom, false},
+		{"\\create broom", "New room created: broom", ToSelf, false},
+		{"\\list", "\nCurrent Members:\n\tLando Calrissian\n", ToSelf, false},
+		{"\\list-rooms", "\nCurrent rooms: \n  Room: broom\n  Members:\n\tLando Calrissian\n", ToSelf, false},
+		{"\\whoami", "\nClient Name: Lando Calrissian\nCurrent Room: broom\nAll Rooms: broom", ToSelf, false},
+		{"\\dm Lando Calrissian Talking to myself", "Talking to myself", ToUser, false},
+		{"\\leave", "You have left room broom", ToSelf, false},
+		{"\\invalid-command", "Invalid command: `\\invalid-command`", ToSelf, false},
+		{"\\exit", "Lando Calrissian has gone offline", ToRoom, true},
 	}
 
 	for _, tt := range tests {
-		actualStr, actualBool, actualError := c.parseResponse(tt.input)
-		assert.Equal(t, tt.expectedStr, actualStr)
-		assert.Equal(t, tt.expectedBool, actualBool)
-		assert.Equal(t, tt.expectedError, actualError)
+		actual := c.parseResponse(tt.input)
+		assert.Equal(t, tt.expectedStr, actual.Payload)
+		assert.Equal(t, tt.expectedAudience, actual.Audience)
+		assert.Equal(t, tt.expectedDisconnect, actual.Disconnect)
 	}
 }
 
 func Test_parseResponse_more_than_one_client_required(t *testing.T) {
-	cm := &mocks.CacheMock{}
-	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}, Cache: cm}
-	c2 := &Client{Id: "123", Name: "Leia Organa", CurrentRoom: "vroom", Writer: &mocks.IoWriterMock{}, Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		return map[string][]*Client{"broom": {c1}, "vroom": {c2}}, true
-	}
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}}
+	c2 := &Client{Id: "456", Name: "Leia Organa", CurrentRoom: "vroom", Writer: &mocks.IoWriterMock{}}
+	seedStore(c1, c2)
 
-	actualStr1, actualBool1, actualError1 := c1.parseResponse("\\list vroom")
-	actualStr2, actualBool2, actualError2 := c2.parseResponse("\\list broom")
+	actual1 := c1.parseResponse("\\list vroom")
+	actual2 := c2.parseResponse("\\list broom")
 
-	actualStr3, actualBool3, actualError3 := c2.parseResponse("\\join broom")
+	actual3 := c2.parseResponse("\\join broom")
 
-	assert.Equal(t, "\nCurrent Members:\n\tLeia Organa\n", actualStr1)
-	assert.False(t, actualBool1)
-	assert.Nil(t, actualError1)
-	assert.Equal(t, "\nCurrent Members:\n\tHan Solo\n", actualStr2)
-	assert.False(t, actualBool2)
-	assert.Nil(t, actualError2)
+	assert.Equal(t, "\nCurrent Members:\n\tLeia Organa\n", actual1.Payload)
+	assert.Equal(t, ToSelf, actual1.Audience)
+	assert.Equal(t, "\nCurrent Members:\n\tHan Solo\n", actual2.Payload)
+	assert.Equal(t, ToSelf, actual2.Audience)
 
-	assert.Equal(t, "Leia Organa has entered: broom", actualStr3)
-	assert.True(t, actualBool3)
-	assert.Nil(t, actualError3)
+	assert.Equal(t, "Leia Organa has entered: broom", actual3.Payload)
+	assert.Equal(t, ToRoom, actual3.Audience)
+	assert.Equal(t, eventJoin, actual3.Event)
 }
 
 func Test_listen_msg_broadcasts_to_room(t *testing.T) {
+	wg1 := sync.WaitGroup{}
+	wg2 := sync.WaitGroup{}
 	count := 0
 	monkey.Patch(Read, func(a interfaces.AbstractBufioReader) (string, error) {
 		if count == 0 {
 			count++
 			return "test", nil
 		} else {
+			// Hold the connection open until the broadcast lands, since hanging up takes us out of the room.
+			wg1.Wait()
+			wg2.Wait()
 			return "", io.EOF //Also secretly testing that io.EOF kills the process
 		}
 	})
@@ -476,41 +656,35 @@ func Test_listen_msg_broadcasts_to_room(t *testing.T) {
 	})
 	defer monkey.Unpatch(time.Now)
 
-	wg1 := sync.WaitGroup{}
-	wg2 := sync.WaitGroup{}
+	// Hanging up tells the room too, so keep everything each of them is sent, not just the last write.
+	var written1, written2 []byte
+	once1, once2 := sync.Once{}, sync.Once{}
 	m1 := &mocks.IoWriterMock{WriteMock: func(p []byte) (n int, err error) {
-		wg1.Done()
+		written1 = append(written1, p...)
+		once1.Do(wg1.Done)
 		return 0, nil
 	}}
 	m2 := &mocks.IoWriterMock{WriteMock: func(p []byte) (n int, err error) {
-		wg2.Done()
+		written2 = append(written2, p...)
+		once2.Do(wg2.Done)
 		return 0, nil
 	}}
 
-	cm := &mocks.CacheMock{}
-
-	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: m1, Conn: &mocks.NetConnMock{}, Cache: cm}
-	c2 := &Client{Id: "456", Name: "Leia Organa", CurrentRoom: "broom", Writer: m2, Conn: &mocks.NetConnMock{}, Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		if k == CLIENTS {
-			return map[string]*Client{c1.Id: c1, c2.Id: c2}, true
-		} else {
-			return map[string][]*Client{"broom": {c1, c2}}, true
-		}
-	}
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: m1, Conn: &mocks.NetConnMock{}}
+	c2 := &Client{Id: "456", Name: "Leia Organa", CurrentRoom: "broom", Writer: m2, Conn: &mocks.NetConnMock{}}
+	seedStore(c1, c2)
 
 	wg1.Add(1)
 	wg2.Add(1)
 
 	c1.listen()
 
-	wg1.Wait()
-	wg2.Wait()
-
 	assert.True(t, m1.WriteCalled)
 	assert.True(t, m2.WriteCalled)
-	assert.Equal(t, "1650452400: Han Solo> test\n", string(m1.WriteCalledWith))
-	assert.Equal(t, "1650452400: Han Solo: test\n", string(m2.WriteCalledWith))
+	assert.Equal(t, "1650452400: [broom] Han Solo> test\n"+
+		"1650452400: [broom] Han Solo> Han Solo has gone offline\n", string(written1))
+	assert.Equal(t, "1650452400: [broom] Han Solo: test\n"+
+		"1650452400: [broom] Han Solo: Han Solo has gone offline\n", string(written2))
 }
 
 func Test_listen_msg_sends_only_to_self(t *testing.T) {
@@ -532,17 +706,10 @@ func Test_listen_msg_sends_only_to_self(t *testing.T) {
 
 	m1 := &mocks.IoWriterMock{}
 	m2 := &mocks.IoWriterMock{}
-	cm := &mocks.CacheMock{}
 
-	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "", Writer: m1, Conn: &mocks.NetConnMock{}, Cache: cm}
-	c2 := &Client{Id: "456", Name: "Leia Organa", CurrentRoom: "broom", Writer: m2, Conn: &mocks.NetConnMock{}, Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		if k == CLIENTS {
-			return map[string]*Client{c1.Id: c1, c2.Id: c2}, true
-		} else {
-			return map[string][]*Client{"broom": {c1, c2}}, true
-		}
-	}
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "", Writer: m1, Conn: &mocks.NetConnMock{}}
+	c2 := &Client{Id: "456", Name: "Leia Organa", CurrentRoom: "broom", Writer: m2, Conn: &mocks.NetConnMock{}}
+	seedStore(c1, c2)
 	c1.listen()
 
 	assert.True(t, m1.WriteCalled)
@@ -551,12 +718,17 @@ func Test_listen_msg_sends_only_to_self(t *testing.T) {
 }
 
 func Test_listen_cmd_broadcasts_to_room(t *testing.T) {
+	wg1 := sync.WaitGroup{}
+	wg2 := sync.WaitGroup{}
 	count := 0
 	monkey.Patch(Read, func(a interfaces.AbstractBufioReader) (string, error) {
 		if count == 0 {
 			count++
 			return "\\name LukeSkywalker", nil
 		} else {
+			// Hold the connection open until the broadcast lands, since hanging up takes us out of the room.
+			wg1.Wait()
+			wg2.Wait()
 			return "", io.EOF //Also secretly testing that io.EOF kills the process
 		}
 	})
@@ -567,40 +739,35 @@ func Test_listen_cmd_broadcasts_to_room(t *testing.T) {
 	})
 	defer monkey.Unpatch(time.Now)
 
-	wg1 := sync.WaitGroup{}
-	wg2 := sync.WaitGroup{}
+	// Hanging up tells the room too, so keep everything each of them is sent, not just the last write.
+	var written1, written2 []byte
+	once1, once2 := sync.Once{}, sync.Once{}
 	m1 := &mocks.IoWriterMock{WriteMock: func(p []byte) (n int, err error) {
-		wg1.Done()
+		written1 = append(written1, p...)
+		once1.Do(wg1.Done)
 		return 0, nil
 	}}
 	m2 := &mocks.IoWriterMock{WriteMock: func(p []byte) (n int, err error) {
-		wg2.Done()
+		written2 = append(written2, p...)
+		once2.Do(wg2.Done)
 		return 0, nil
 	}}
-	cm := &mocks.CacheMock{}
 
-	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: m1, Conn: &mocks.NetConnMock{}, Cache: cm}
-	c2 := &Client{Id: "456", Name: "Leia Organa", CurrentRoom: "broom", Writer: m2, Conn: &mocks.NetConnMock{}, Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		if k == CLIENTS {
-			return map[string]*Client{c1.Id: c1, c2.Id: c2}, true
-		} else {
-			return map[string][]*Client{"broom": {c1, c2}}, true
-		}
-	}
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: m1, Conn: &mocks.NetConnMock{}}
+	c2 := &Client{Id: "456", Name: "Leia Organa", CurrentRoom: "broom", Writer: m2, Conn: &mocks.NetConnMock{}}
+	seedStore(c1, c2)
 
 	wg1.Add(1)
 	wg2.Add(1)
 
 	c1.listen()
 
-	wg1.Wait()
-	wg2.Wait()
-
 	assert.True(t, m1.WriteCalled)
 	assert.True(t, m2.WriteCalled)
-	assert.Equal(t, "1650452400: LukeSkywalker> User: Han Solo has become -> LukeSkywalker\n", string(m1.WriteCalledWith))
-	assert.Equal(t, "1650452400: LukeSkywalker: User: Han Solo has become -> LukeSkywalker\n", string(m2.WriteCalledWith))
+	assert.Equal(t, "1650452400: [broom] LukeSkywalker> User: Han Solo has become -> LukeSkywalker\n"+
+		"1650452400: [broom] LukeSkywalker> LukeSkywalker has gone offline\n", string(written1))
+	assert.Equal(t, "1650452400: [broom] LukeSkywalker: User: Han Solo has become -> LukeSkywalker\n"+
+		"1650452400: [broom] LukeSkywalker: LukeSkywalker has gone offline\n", string(written2))
 }
 
 func Test_listen_cmd_sends_only_to_self(t *testing.T) {
@@ -619,22 +786,16 @@ func Test_listen_cmd_sends_only_to_self(t *testing.T) {
 	})
 	defer monkey.Unpatch(time.Now)
 
-	m1 := &mocks.IoWriterMock{}
-	m2 := &mocks.IoWriterMock{}
-	cm := &mocks.CacheMock{}
+	m1 := &bytes.Buffer{}
+	m2 := &bytes.Buffer{}
 
-	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: m1, Conn: &mocks.NetConnMock{}, Cache: cm}
-	c2 := &Client{Id: "456", Name: "Leia Organa", CurrentRoom: "broom", Writer: m2, Conn: &mocks.NetConnMock{}, Cache: cm}
-	cm.GetMock = func(k string) (interface{}, bool) {
-		if k == CLIENTS {
-			return map[string]*Client{c1.Id: c1, c2.Id: c2}, true
-		} else {
-			return map[string][]*Client{"broom": {c1, c2}}, true
-		}
-	}
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: m1, Conn: &mocks.NetConnMock{}}
+	c2 := &Client{Id: "456", Name: "Leia Organa", CurrentRoom: "broom", Writer: m2, Conn: &mocks.NetConnMock{}}
+	seedStore(c1, c2)
 	c1.listen()
 
-	assert.True(t, m1.WriteCalled)
-	assert.False(t, m2.WriteCalled)
-	assert.Equal(t, "1650452400: Han Solo> \nCurrent Members:\n\tHan Solo\n\tLeia Organa\n\n", string(m1.WriteCalledWith))
+	assert.Equal(t, "1650452400: Han Solo> \nCurrent Members:\n\tHan Solo\n\tLeia Organa\n\n"+
+		"1650452400: [broom] Han Solo> Han Solo has gone offline\n", m1.String())
+	// All the room hears is them hanging up.
+	assert.Equal(t, "1650452400: [broom] Han Solo: Han Solo has gone offline\n", m2.String())
 }
@@ -0,0 +1,127 @@
+package clients
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiNotice  = "\x1b[33m"  // Yellow, which no user name gets, so joins, leaves and the like stand apart.
+	ansiMention = "\x1b[1;7m" // Bold and reversed.
+)
+
+// Colors user names are picked from - everything but yellow, which is kept for notices, and the black and white that
+//	disappear into one background or another.
+var nameColors = []string{
+	"\x1b[31m", "\x1b[32m", "\x1b[34m", "\x1b[35m", "\x1b[36m",
+	"\x1b[91m", "\x1b[92m", "\x1b[94m", "\x1b[95m", "\x1b[96m",
+}
+
+// Everyone sees the same name in the same color, and it stays that way for as long as they keep the name.
+func nameColor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return nameColors[h.Sum32()%uint32(len(nameColors))]
+}
+
+// Whether the client has picked colors on or off with `\color`, or left it up to us.
+const (
+	colorDefault int32 = iota
+	colorOff
+	colorOn
+)
+
+// Only terminals know what to do with ANSI escape codes - anywhere else they're just noise.
+func (c *Client) onTerminal() bool {
+	_, ok := c.Conn.(terminalSizer)
+	return ok
+}
+
+// Unless they've said otherwise, clients only get colors once their telnet client has told us how big its window is,
+//	so bots and scripts connecting over plain TCP never have to pick the escape codes back out.
+func (c *Client) colorEnabled() bool {
+	switch atomic.LoadInt32(&c.color) {
+	case colorOn:
+		return true
+	case colorOff:
+		return false
+	}
+	conn, ok := c.Conn.(terminalSizer)
+	return ok && conn.TerminalWidth() > 0
+}
+
+func (c *Client) setColorEnabled(enabled bool) {
+	value := colorOff
+	if enabled {
+		value = colorOn
+	}
+	atomic.StoreInt32(&c.color, value)
+}
+
+// Style a message for the client: the sender's name in their color, notices set apart from the chatter, and the
+//	client's own name picked out wherever someone else mentions it.
+func (c *Client) colorize(sender, msg string, notice bool) (string, string) {
+	if sender == SERVER {
+		return ansiBold + sender + ansiReset, msg
+	}
+	styledSender := nameColor(sender) + sender + ansiReset
+	if notice {
+		return styledSender, ansiNotice + msg + ansiReset
+	}
+	if name := c.UserName(); sender != name && name != "" {
+		msg = highlightMentions(msg, name)
+	}
+	return styledSender, msg
+}
+
+// Pick out every mention of the name in the message, whatever case it's written in (ex. `@han` for `Han`), but only
+//	where it stands as a word of its own - `Han` isn't mentioned in `Hannah`.
+func highlightMentions(msg, name string) string {
+	mention := regexp.MustCompile("(?i)" + regexp.QuoteMeta(name))
+	var highlighted strings.Builder
+	last := 0
+	for _, match := range mention.FindAllStringIndex(msg, -1) {
+		if !wordBoundary(msg, match[0], match[1]) {
+			continue
+		}
+		highlighted.WriteString(msg[last:match[0]])
+		highlighted.WriteString(ansiMention + msg[match[0]:match[1]] + ansiReset)
+		last = match[1]
+	}
+	highlighted.WriteString(msg[last:])
+	return highlighted.String()
+}
+
+// Whether `msg[start:end]` isn't run together with the letters or digits either side of it.
+func wordBoundary(msg string, start, end int) bool {
+	before, _ := utf8.DecodeLastRuneInString(msg[:start])
+	after, _ := utf8.DecodeRuneInString(msg[end:])
+	return !wordRune(before) && !wordRune(after)
+}
+
+func wordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
+
+func (c *Client) setColor(value string) Response {
+	enabled := false
+	switch strings.ToLower(value) {
+	case "on":
+		enabled = true
+	case "off":
+	default:
+		return failure("Invalid value - usage: `\\color <on|off>`")
+	}
+	if enabled && !c.onTerminal() {
+		return failure("Your connection can't show colors.")
+	}
+	c.setColorEnabled(enabled)
+	return reply(fmt.Sprintf("Colors are %s.", strings.ToLower(value)))
+}
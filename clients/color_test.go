@@ -0,0 +1,101 @@
+package clients
+
+import (
+	"chat-telnet/mocks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_formatMessage_with_color(t *testing.T) {
+	c := &Client{Id: "123", Name: "Han Solo", Conn: &sizedConnMock{}}
+	c.setColorEnabled(true)
+	leia := nameColor("Leia Organa") + "Leia Organa" + ansiReset
+	han := nameColor("Han Solo") + "Han Solo" + ansiReset
+
+	heard := func(sender, event, payload string) Response {
+		return Response{Audience: ToRoom, Event: event, Room: "falcon", Sender: sender, Payload: payload}
+	}
+
+	var tests = []struct {
+		response Response
+		expected string
+	}{
+		{heard("Leia Organa", eventMessage, "Hi"), "1650452400: [falcon] " + leia + ": Hi\n"},
+		{heard("Han Solo", eventMessage, "Hi"), "1650452400: [falcon] " + han + "> Hi\n"},
+		{
+			heard("Leia Organa", eventJoin, "Leia Organa has entered: falcon"),
+			"1650452400: [falcon] " + leia + ": " + ansiNotice + "Leia Organa has entered: falcon" + ansiReset + "\n",
+		},
+		{
+			heard("Leia Organa", eventMessage, "Where's Han Solo?"),
+			"1650452400: [falcon] " + leia + ": Where's " + ansiMention + "Han Solo" + ansiReset + "?\n",
+		},
+		{
+			Response{Audience: ToUser, Event: eventDirect, Sender: "Leia Organa", Payload: "Hi"},
+			"1650452400: [DM] " + leia + ": Hi\n",
+		},
+		{serverNotice("Welcome"), "1650452400: " + ansiBold + "Server" + ansiReset + ": Welcome\n"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, c.formatMessage(1650452400, tt.response))
+	}
+}
+
+func Test_highlightMentions(t *testing.T) {
+	mention := func(name string) string { return ansiMention + name + ansiReset }
+
+	var tests = []struct {
+		msg      string
+		name     string
+		expected string
+	}{
+		{"Where's Han?", "Han", "Where's " + mention("Han") + "?"},
+		{"@han, punch it", "Han", "@" + mention("han") + ", punch it"},
+		{"HAN! han!", "Han", mention("HAN") + "! " + mention("han") + "!"},
+		{"Hannah says hi", "Han", "Hannah says hi"},
+		{"Ask Chan", "Han", "Ask Chan"},
+		{"han_solo is here", "Han", "han_solo is here"},
+		{"Where's han solo?", "Han Solo", "Where's " + mention("han solo") + "?"},
+		{"R2 and r2-d2", "R2-D2", "R2 and " + mention("r2-d2")},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, highlightMentions(tt.msg, tt.name), tt.msg)
+	}
+}
+
+func Test_nameColor_is_stable(t *testing.T) {
+	assert.Equal(t, nameColor("Chewbacca"), nameColor("Chewbacca"))
+	assert.Contains(t, nameColors, nameColor("Chewbacca"))
+}
+
+func Test_setColor(t *testing.T) {
+	c := &Client{Id: "123", Name: "Han Solo", Conn: &sizedConnMock{}}
+
+	response := c.setColor("on")
+	assert.Equal(t, "Colors are on.", response.Payload)
+	assert.Equal(t, eventCommandResult, response.Event)
+	assert.True(t, c.colorEnabled())
+
+	response = c.setColor("OFF")
+	assert.Equal(t, "Colors are off.", response.Payload)
+	assert.False(t, c.colorEnabled())
+
+	response = c.setColor("maybe")
+	assert.Equal(t, failure("Invalid value - usage: `\\color <on|off>`"), response)
+}
+
+func Test_colorEnabled_by_default(t *testing.T) {
+	assert.True(t, (&Client{Conn: &sizedConnMock{width: 80}}).colorEnabled())
+	assert.False(t, (&Client{Conn: &sizedConnMock{}}).colorEnabled())
+	assert.False(t, (&Client{Conn: &mocks.NetConnMock{}}).colorEnabled())
+}
+
+func Test_setColor_off_terminal(t *testing.T) {
+	c := &Client{Id: "123", Name: "Han Solo", Conn: &mocks.NetConnMock{}}
+
+	response := c.setColor("on").Payload
+
+	assert.Equal(t, "Your connection can't show colors.", response)
+	assert.False(t, c.colorEnabled())
+	assert.Equal(t, "1650452400: Han Solo> Hi\n", c.formatMessage(1650452400, reply("Hi")))
+}
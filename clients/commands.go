@@ -0,0 +1,332 @@
+package clients
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// ArgSpec says whether a command takes a value after its name.
+type ArgSpec int
+
+const (
+	NoArgs ArgSpec = iota
+	OptionalArgs
+	RequiredArgs
+)
+
+// Permission says who is allowed to run a command.
+type Permission int
+
+const (
+	Anyone Permission = iota
+	// Held back from anyone who hasn't logged in yet, but only when `RequireLogin` is set.
+	LoggedIn
+	// Only for the owner and moderators of the room the client is in.
+	RoomModerator
+	// Only for the owner of the room the client is in.
+	RoomOwner
+)
+
+// Command is everything we know about one of the `\` commands: what it's called, what it takes, who can run it, what
+//	to tell people about it and what it actually does.  The handler gets the value typed after the command, already
+//	trimmed, and answers with a `Response` saying who should hear about what it did.
+type Command struct {
+	Name       string
+	Aliases    []string
+	Args       string // How the value is written in the help, ex. `<room name>`.
+	ArgSpec    ArgSpec
+	Help       string
+	Permission Permission
+	Handler    func(c *Client, value string) Response
+}
+
+func (cmd *Command) Usage() string {
+	if cmd.Args == "" {
+		return cmd.Name
+	}
+	return fmt.Sprintf("%s %s", cmd.Name, cmd.Args)
+}
+
+// CommandRegistry holds every command a client can run, in the order they were registered, which is also the order
+//	they're listed in the help.
+type CommandRegistry struct {
+	commands []*Command
+	byName   map[string]*Command
+}
+
+func NewCommandRegistry() *CommandRegistry {
+	return &CommandRegistry{byName: map[string]*Command{}}
+}
+
+// Add a command, and its aliases, to the registry.  Names have to start with a `\` and can't clash with any command
+//	or alias already registered.
+func (r *CommandRegistry) Register(cmd Command) error {
+	if cmd.Handler == nil {
+		return fmt.Errorf("command `%s` has no handler", cmd.Name)
+	}
+	names := append([]string{cmd.Name}, cmd.Aliases...)
+	for _, name := range names {
+		if !strings.HasPrefix(name, "\\") || strings.ContainsAny(name, " \t") {
+			return fmt.Errorf("invalid command name `%s`", name)
+		}
+		if _, found := r.byName[name]; found {
+			return fmt.Errorf("command `%s` is already registered", name)
+		}
+	}
+	for _, name := range names {
+		r.byName[name] = &cmd
+	}
+	r.commands = append(r.commands, &cmd)
+	return nil
+}
+
+// Find a command by its name or any of its aliases.
+func (r *CommandRegistry) Lookup(name string) (*Command, bool) {
+	cmd, found := r.byName[name]
+	return cmd, found
+}
+
+func (r *CommandRegistry) List() []*Command {
+	return append([]*Command{}, r.commands...)
+}
+
+// One line per command, lined up, ex. `\join <room name>    : Join an existing chat room...`.
+func (r *CommandRegistry) Summary() string {
+	buf := &bytes.Buffer{}
+	w := tabwriter.NewWriter(buf, 0, 8, 2, ' ', 0)
+	for _, cmd := range r.commands {
+		fmt.Fprintf(w, "%s\t: %s\n", cmd.Usage(), cmd.Help)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// Everything about a single command, looked up with or without its leading `\`.
+func (r *CommandRegistry) Describe(name string) (string, bool) {
+	if !strings.HasPrefix(name, "\\") {
+		name = "\\" + name
+	}
+	cmd, found := r.Lookup(name)
+	if !found {
+		return "", false
+	}
+	description := fmt.Sprintf("\nUsage: %s\n%s", cmd.Usage(), cmd.Help)
+	if len(cmd.Aliases) > 0 {
+		description = description + fmt.Sprintf("\nAlso: %s", strings.Join(cmd.Aliases, ", "))
+	}
+	return description, true
+}
+
+// Every command clients can run.  Register more here, or from anywhere else before the server starts, and they'll
+//	show up in the welcome banner and `\help` on their own.
+var Commands = DefaultCommands()
+
+func DefaultCommands() *CommandRegistry {
+	r := NewCommandRegistry()
+	for _, cmd := range []Command{
+		{
+			Name: "\\name", Aliases: []string{"\\nick"}, Args: "<user name>", ArgSpec: RequiredArgs,
+			Help:    "Change your user name to the <user name> supplied",
+			Handler: (*Client).changeClientName,
+		},
+		{
+			Name: "\\register", Args: "<user name> <password>", ArgSpec: RequiredArgs,
+			Help:    "Register the <user name> supplied so only you can use it, and log in to it",
+			Handler: (*Client).register,
+		},
+		{
+			Name: "\\login", Args: "<user name> <password>", ArgSpec: RequiredArgs,
+			Help:    "Log in to an account you've registered, taking on its <user name>",
+			Handler: (*Client).login,
+		},
+		{
+			Name: "\\create", Args: "<room name> [+mode] [password]", ArgSpec: RequiredArgs, Permission: LoggedIn,
+			Help:    "Create and join a new chat room with the <room name> supplied, and who can see and join it (see `\\room-mode`)",
+			Handler: (*Client).createRoom,
+		},
+		{
+			Name: "\\join", Args: "<room name> [password]", ArgSpec: RequiredArgs, Permission: LoggedIn,
+			Help:    "Join an existing chat room with the <room name> supplied, and its [password] if it has one",
+			Handler: (*Client).joinRoom,
+		},
+		{
+			Name: "\\leave", Args: "[room name]", ArgSpec: OptionalArgs, Permission: LoggedIn,
+			Help: "Leave the room named [room name], or the room you are currently in",
+			Handler: func(c *Client, value string) Response {
+				if value == "" {
+					value = c.ActiveRoom()
+				}
+				if !c.inRoom(value) {
+					return failure(fmt.Sprintf("You're not in %s.", value))
+				}
+				c.leaveRoom(value)
+				return reply(fmt.Sprintf("You have left room %s", value))
+			},
+		},
+		{
+			Name: "\\switch", Args: "<room name>", ArgSpec: RequiredArgs, Permission: LoggedIn,
+			Help:    "Send your messages to <room name> from now on, without leaving any of your other rooms",
+			Handler: (*Client).switchRoom,
+		},
+		{
+			Name: "\\say", Args: "<room name> <message>", ArgSpec: RequiredArgs, Permission: LoggedIn,
+			Help:    "Send a <message> to <room name>, one of your other rooms, without switching to it",
+			Handler: (*Client).say,
+		},
+		{
+			Name: "\\list", Args: "[room name]", ArgSpec: OptionalArgs, Permission: LoggedIn,
+			Help: "List members in the chat room named [room name], or the room you're currently in",
+			Handler: func(c *Client, value string) Response {
+				if value == "" {
+					value = c.ActiveRoom()
+				}
+				return c.listMembers(value)
+			},
+		},
+		{
+			Name: "\\list-rooms", Aliases: []string{"\\rooms"}, Permission: LoggedIn,
+			Help: "List all the available rooms and their members",
+			Handler: func(c *Client, value string) Response {
+				return c.listRooms()
+			},
+		},
+		{
+			Name: "\\dm", Aliases: []string{"\\msg"}, Args: "<user name> <message>", ArgSpec: RequiredArgs,
+			Help:    "Send a private <message> to the user named <user name>, wherever they are",
+			Handler: (*Client).dmResponse,
+		},
+		{
+			Name: "\\history", Args: "[number]", ArgSpec: OptionalArgs, Permission: LoggedIn,
+			Help:    "Show the last [number] of messages sent to the room you're currently in",
+			Handler: (*Client).showHistory,
+		},
+		{
+			Name: "\\whoami",
+			Help: "List your name and what room you're currently in",
+			Handler: func(c *Client, value string) Response {
+				return c.displayClientStats()
+			},
+		},
+		{
+			Name: "\\color", Args: "<on|off>", ArgSpec: RequiredArgs,
+			Help:    "Turn colored names and notices on or off, on terminals that can show them",
+			Handler: (*Client).setColor,
+		},
+		{
+			Name: "\\mode", Args: "<text|json>", ArgSpec: RequiredArgs,
+			Help:    "Switch to talking in JSON lines, for bots and other programs, or back to plain text",
+			Handler: (*Client).setMode,
+		},
+		{
+			Name: "\\kick", Args: "<user name>", ArgSpec: RequiredArgs, Permission: RoomModerator,
+			Help:    "Remove the user named <user name> from your room",
+			Handler: (*Client).kick,
+		},
+		{
+			Name: "\\ban", Args: "<user name> [duration]", ArgSpec: RequiredArgs, Permission: RoomModerator,
+			Help:    "Remove the user named <user name> from your room and keep them out, for [duration] (ex. 10m) or for good",
+			Handler: (*Client).ban,
+		},
+		{
+			Name: "\\unban", Args: "<user name>", ArgSpec: RequiredArgs, Permission: RoomModerator,
+			Help:    "Let the user named <user name> back in to your room",
+			Handler: (*Client).unban,
+		},
+		{
+			Name: "\\mute", Args: "<user name> [duration]", ArgSpec: RequiredArgs, Permission: RoomModerator,
+			Help:    "Stop the user named <user name> talking in your room, for [duration] (ex. 10m) or until unmuted",
+			Handler: (*Client).mute,
+		},
+		{
+			Name: "\\unmute", Args: "<user name>", ArgSpec: RequiredArgs, Permission: RoomModerator,
+			Help:    "Let the user named <user name> talk in your room again",
+			Handler: (*Client).unmute,
+		},
+		{
+			Name: "\\mod", Args: "<user name>", ArgSpec: RequiredArgs, Permission: RoomOwner,
+			Help: "Make the user named <user name> a moderator of your room",
+			Handler: func(c *Client, value string) Response {
+				return c.setModerator(value, true)
+			},
+		},
+		{
+			Name: "\\unmod", Args: "<user name>", ArgSpec: RequiredArgs, Permission: RoomOwner,
+			Help: "Take moderator status away from the user named <user name>",
+			Handler: func(c *Client, value string) Response {
+				return c.setModerator(value, false)
+			},
+		},
+		{
+			Name: "\\topic", Args: "[text]", ArgSpec: OptionalArgs, Permission: LoggedIn,
+			Help:    "Show the topic of the room you're currently in, or, as its owner or a moderator, change it to [text]",
+			Handler: (*Client).topic,
+		},
+		{
+			Name: "\\room-mode", Args: "<mode> [password]", ArgSpec: RequiredArgs, Permission: RoomOwner,
+			Help:    "Make your room public, unlisted, password (with a [password]) or invite-only",
+			Handler: (*Client).setRoomMode,
+		},
+		{
+			Name: "\\room-persist", Args: "<on|off>", ArgSpec: RequiredArgs, Permission: RoomOwner,
+			Help:    "Keep your room open once everyone has left it, or let it close",
+			Handler: (*Client).setPersistent,
+		},
+		{
+			Name: "\\invite", Args: "<user name>", ArgSpec: RequiredArgs, Permission: RoomModerator,
+			Help:    "Let the user named <user name> in to your room, even if it's invite only",
+			Handler: (*Client).invite,
+		},
+		{
+			Name: "\\help", Aliases: []string{"\\?"}, Args: "[command]", ArgSpec: OptionalArgs,
+			Help: "List every command, or explain the [command] supplied",
+			// Look the registry up through `r`, not `Commands`, so this still works in any registry we build.
+			Handler: func(c *Client, value string) Response {
+				if value == "" {
+					return reply("\nAvailable Commands:\n=====\n" + r.Summary())
+				}
+				description, found := r.Describe(value)
+				if !found {
+					return failure(fmt.Sprintf("No such command `%s` - use `\\help` to list them all.", value))
+				}
+				return reply(description)
+			},
+		},
+		{
+			Name: "\\exit", Aliases: []string{"\\quit"},
+			Help: "Exit server and terminate connection",
+			Handler: func(c *Client, value string) Response {
+				return goodbye(fmt.Sprintf("%s has gone offline", c.UserName()))
+			},
+		},
+	} {
+		err := r.Register(cmd)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Check the client is allowed to run the command, answering with why not if they aren't.
+func (c *Client) permitted(cmd *Command) (string, bool) {
+	switch cmd.Permission {
+	case LoggedIn:
+		if RequireLogin && c.account() == "" {
+			return "Please `\\login` or `\\register` before using the room commands.", false
+		}
+	case RoomModerator, RoomOwner:
+		moderation, found := c.Store.Moderation(c.ActiveRoom())
+		if !found {
+			return fmt.Sprintf("You need to be in a room to use `%s`.", cmd.Name), false
+		}
+		if cmd.Permission == RoomOwner && !moderation.IsOwner(c) {
+			return fmt.Sprintf("Only the owner of %s can use `%s`.", c.ActiveRoom(), cmd.Name), false
+		}
+		if !moderation.CanModerate(c) {
+			return fmt.Sprintf("Only the owner and moderators of %s can use `%s`.", c.ActiveRoom(), cmd.Name), false
+		}
+	}
+	return "", true
+}
@@ -0,0 +1,137 @@
+package clients
+
+import (
+	"bou.ke/monkey"
+	"chat-telnet/interfaces"
+	"chat-telnet/mocks"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+func echoCommand(name string, aliases ...string) Command {
+	return Command{
+		Name: name, Aliases: aliases, Args: "<words>", ArgSpec: RequiredArgs,
+		Help: "Say the <words> back",
+		Handler: func(c *Client, value string) Response {
+			return reply(value)
+		},
+	}
+}
+
+func Test_CommandRegistry_Register_and_Lookup(t *testing.T) {
+	r := NewCommandRegistry()
+
+	err := r.Register(echoCommand("\\echo", "\\say-back"))
+
+	assert.Nil(t, err)
+	byName, found := r.Lookup("\\echo")
+	assert.True(t, found)
+	byAlias, found := r.Lookup("\\say-back")
+	assert.True(t, found)
+	assert.Equal(t, byName, byAlias)
+	_, found = r.Lookup("\\ECHO")
+	assert.False(t, found)
+}
+
+func Test_CommandRegistry_Register_errors(t *testing.T) {
+	r := NewCommandRegistry()
+	r.Register(echoCommand("\\echo", "\\say-back"))
+
+	var tests = []struct {
+		cmd      Command
+		expected string
+	}{
+		{echoCommand("\\echo"), "command `\\echo` is already registered"},
+		{echoCommand("\\parrot", "\\say-back"), "command `\\say-back` is already registered"},
+		{echoCommand("parrot"), "invalid command name `parrot`"},
+		{echoCommand("\\par rot"), "invalid command name `\\par rot`"},
+		{Command{Name: "\\parrot"}, "command `\\parrot` has no handler"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, fmt.Sprint(r.Register(tt.cmd)))
+	}
+	assert.Len(t, r.List(), 1)
+}
+
+func Test_CommandRegistry_Summary_lines_up_in_order(t *testing.T) {
+	r := NewCommandRegistry()
+	r.Register(echoCommand("\\echo"))
+	r.Register(Command{Name: "\\ping", Help: "Pong", Handler: func(c *Client, value string) Response {
+		return reply("pong")
+	}})
+
+	assert.Equal(t, "\\echo <words>  : Say the <words> back\n\\ping          : Pong\n", r.Summary())
+}
+
+func Test_CommandRegistry_Describe(t *testing.T) {
+	r := NewCommandRegistry()
+	r.Register(echoCommand("\\echo", "\\say-back"))
+
+	withSlash, found := r.Describe("\\echo")
+	assert.True(t, found)
+	withoutSlash, _ := r.Describe("say-back")
+	_, found = r.Describe("parrot")
+
+	assert.Equal(t, "\nUsage: \\echo <words>\nSay the <words> back\nAlso: \\say-back", withSlash)
+	assert.Equal(t, withSlash, withoutSlash)
+	assert.False(t, found)
+}
+
+func Test_help_lists_every_command(t *testing.T) {
+	c := &Client{Writer: &mocks.IoWriterMock{}}
+	seedStore(c)
+
+	response := c.parseResponse("\\help").Payload
+
+	assert.True(t, strings.HasPrefix(response, "\nAvailable Commands:\n=====\n"))
+	for _, cmd := range Commands.List() {
+		assert.Contains(t, response, cmd.Usage())
+		assert.Contains(t, response, cmd.Help)
+	}
+}
+
+// The welcome banner is built from the registry rather than by hand, so it can't drift out of date.
+func Test_GenerateNewClient_banner_lists_every_command(t *testing.T) {
+	monkey.Patch(Read, func(a interfaces.AbstractBufioReader) (string, error) {
+		return "", io.EOF
+	})
+	defer monkey.Unpatch(Read)
+	conn := &mocks.NetConnMock{}
+
+	GenerateNewClient(conn, NewMemoryStore())
+
+	assert.Contains(t, string(conn.CalledWith), "Welcome to Chattington!")
+	assert.Contains(t, string(conn.CalledWith), Commands.Summary())
+}
+
+func Test_parseResponse_through_registry(t *testing.T) {
+	previous := Commands
+	Commands = DefaultCommands()
+	defer func() { Commands = previous }()
+	Commands.Register(echoCommand("\\echo"))
+	c := &Client{Id: "123", Name: "Han Solo", Writer: &mocks.IoWriterMock{}}
+	seedStore(c)
+
+	var tests = []struct {
+		input        string
+		expectedStr  string
+		expectedBool bool
+	}{
+		{"\\echo I know", "I know", false},
+		{"\\echo", "Missing value - usage: `\\echo <words>`", false},
+		{"\\join", "Missing value - usage: `\\join <room name> [password]`", false},
+		{"\\nick Captain Solo", "User: Han Solo has become -> Captain Solo", true},
+		{"\\help echo", "\nUsage: \\echo <words>\nSay the <words> back", false},
+		{"\\? nick", "\nUsage: \\name <user name>\nChange your user name to the <user name> supplied\nAlso: \\nick", false},
+		{"\\help parrot", "No such command `parrot` - use `\\help` to list them all.", false},
+	}
+	for _, tt := range tests {
+		actual := c.parseResponse(tt.input)
+		assert.Equal(t, tt.expectedStr, actual.Payload)
+		assert.Equal(t, tt.expectedBool, actual.Audience == ToRoom)
+		assert.False(t, actual.Disconnect)
+	}
+}
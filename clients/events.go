@@ -0,0 +1,37 @@
+package clients
+
+import (
+	"chat-telnet/events"
+)
+
+// Where clients tell anyone who's interested what they've been up to.  The server swaps or adds to the subscribers
+//	here, so nothing that reacts to what happens in the chat has to be wired in to the clients themselves.
+var Events = DefaultEvents()
+
+// A bus with the subscribers the chat can't do without - the server log and the room history.
+func DefaultEvents() *events.Bus {
+	bus := events.NewBus()
+	// Every message and notice is already logged as each client is sent it, so there's no need to log it again here.
+	bus.Subscribe(events.Log,
+		events.Connect, events.Disconnect, events.Join, events.Leave, events.Rename, events.RoomCreated, events.Shutdown,
+	)
+	bus.Subscribe(recordHistory, events.Message)
+	bus.Subscribe(clearHistory, events.RoomCreated)
+	return bus
+}
+
+// Publish something the client did, with them as the user it was done by unless the event says otherwise.
+func (c *Client) publish(event events.Event) {
+	if event.User == "" {
+		event.User = c.UserName()
+	}
+	Events.Publish(event)
+}
+
+// Where the client connected from, if we know.
+func (c *Client) address() string {
+	if c.Conn == nil || c.Conn.RemoteAddr() == nil {
+		return ""
+	}
+	return c.Conn.RemoteAddr().String()
+}
@@ -0,0 +1,77 @@
+package clients
+
+import (
+	"chat-telnet/events"
+	"chat-telnet/mocks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Swap in a bus that collects every event published to it, with the times that change from run to run left out.
+func useTestEvents(t *testing.T) *[]events.Event {
+	published := &[]events.Event{}
+	previous := Events
+	Events = events.NewBus()
+	Events.Subscribe(func(event events.Event) {
+		event.Time = time.Time{}
+		*published = append(*published, event)
+	})
+	t.Cleanup(func() { Events = previous })
+	return published
+}
+
+func Test_room_lifecycle_publishes_events(t *testing.T) {
+	useTestHistory(t)
+	han := &Client{Id: "123", Name: "Han Solo", Writer: &mocks.IoWriterMock{}}
+	chewie := &Client{Id: "456", Name: "Chewbacca", Writer: &mocks.IoWriterMock{}}
+	seedStore(han, chewie)
+	published := useTestEvents(t)
+
+	han.createRoom("falcon")
+	chewie.joinRoom("falcon")
+	han.changeClientName("Captain Solo")
+	chewie.broadcastToRoom("Rrraaawwr", "falcon")
+	chewie.leaveRoom("falcon")
+
+	assert.Equal(t, []events.Event{
+		{Kind: events.RoomCreated, User: "Han Solo", Room: "falcon"},
+		{Kind: events.Join, User: "Chewbacca", Room: "falcon"},
+		{Kind: events.Rename, User: "Captain Solo", OldName: "Han Solo"},
+		{Kind: events.Message, User: "Chewbacca", Room: "falcon", Text: "Rrraaawwr"},
+		{Kind: events.Leave, User: "Chewbacca", Room: "falcon"},
+		{Kind: events.Notice, User: "Chewbacca", Room: "falcon", Text: "Chewbacca has left falcon."},
+	}, *published)
+}
+
+func Test_kick_publishes_leave(t *testing.T) {
+	owner, _, _, _ := seedModeratedRoom()
+	published := useTestEvents(t)
+
+	owner.kick("Greedo")
+
+	assert.Equal(t, events.Event{
+		Kind: events.Leave, User: "Greedo", Room: "cantina", Text: "You've been kicked from cantina by Han Solo.",
+	}, (*published)[0])
+}
+
+func Test_removeConnection_publishes_disconnect(t *testing.T) {
+	c := &Client{Id: "123", Name: "Han Solo", Conn: &mocks.NetConnMock{}}
+	seedStore(c)
+	published := useTestEvents(t)
+
+	c.removeConnection()
+
+	assert.Equal(t, []events.Event{{Kind: events.Disconnect, User: "Han Solo"}}, *published)
+}
+
+// The history keeps up with the rooms through the default bus, not by being told about each message directly.
+func Test_DefaultEvents_records_history(t *testing.T) {
+	historyStore := useTestHistory(t)
+	c := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}}
+	seedStore(c)
+
+	DefaultEvents().Publish(events.Event{Kind: events.Message, User: "Han Solo", Room: "broom", Text: "test"})
+
+	assert.Equal(t, "test", historyStore.Recent("broom", 1)[0].Message)
+}
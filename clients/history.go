@@ -0,0 +1,79 @@
+package clients
+
+import (
+	"chat-telnet/events"
+	"chat-telnet/history"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Where every message sent to a room is kept.  The server swaps this for a `history.FileStore` when `HISTORY_FILE`
+//	is set.
+var History history.Store = history.NewMemoryStore(history.DEFAULT_SIZE)
+
+// How many of a room's most recent messages are replayed to someone as they `\join` it.  Zero turns replay off.
+var HistoryReplay = 10
+
+// How many messages `\history` shows when it isn't told how many to fetch.
+var DEFAULT_HISTORY_COUNT = 20
+
+// Keep every message said in a room, see `DefaultEvents`.  Notices (ex. joins) aren't worth catching anyone up on.
+func recordHistory(event events.Event) {
+	err := History.Record(history.Entry{Time: event.Time, Room: event.Room, Sender: event.User, Message: event.Text})
+	if err != nil {
+		log.Printf("Unable to record history for room %s: %v", event.Room, err)
+	}
+}
+
+// A room that has just been created is a new room, whatever it's called, so nobody in it gets to see what was said in
+//	an old one that went by the same name - which may well have been private.  See `DefaultEvents`.
+func clearHistory(event events.Event) {
+	err := History.Clear(event.Room)
+	if err != nil {
+		log.Printf("Unable to clear history for room %s: %v", event.Room, err)
+	}
+}
+
+// Lay the messages out one per line, each exactly the way they looked when they were first sent.
+func (c *Client) formatHistory(entries []history.Entry) string {
+	lines := ""
+	for _, entry := range entries {
+		lines = lines + c.formatMessage(entry.Time.Unix(), Response{
+			Audience: ToRoom, Event: eventMessage, Room: entry.Room, Sender: entry.Sender, Payload: entry.Message,
+		})
+	}
+	return strings.TrimSuffix(lines, "\n")
+}
+
+// Catch someone who has just joined a room up on what they missed.
+func (c *Client) replayHistory(roomName string) {
+	if HistoryReplay < 1 {
+		return
+	}
+	entries := History.Recent(roomName, HistoryReplay)
+	if len(entries) < 1 {
+		return
+	}
+	c.WriteResponse(serverNotice(fmt.Sprintf("\nCatching you up on %s:\n%s", roomName, c.formatHistory(entries))))
+}
+
+func (c *Client) showHistory(value string) Response {
+	if c.ActiveRoom() == "" {
+		return failure("You're not in a room - `\\join` one to see its history.")
+	}
+	count := DEFAULT_HISTORY_COUNT
+	if value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return failure("Invalid number of messages - usage: `\\history [number of messages]`")
+		}
+		count = n
+	}
+	entries := History.Recent(c.ActiveRoom(), count)
+	if len(entries) < 1 {
+		return reply(fmt.Sprintf("No messages in %s yet.", c.ActiveRoom()))
+	}
+	return reply(fmt.Sprintf("\nLast %d messages in %s:\n%s", len(entries), c.ActiveRoom(), c.formatHistory(entries)))
+}
@@ -0,0 +1,125 @@
+package clients
+
+import (
+	"bou.ke/monkey"
+	"chat-telnet/history"
+	"chat-telnet/mocks"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func useTestHistory(t *testing.T, entries ...history.Entry) *history.MemoryStore {
+	store := history.NewMemoryStore(30)
+	for _, entry := range entries {
+		store.Record(entry)
+	}
+	previous := History
+	History = store
+	t.Cleanup(func() { History = previous })
+	return store
+}
+
+func sentAt(second int) time.Time {
+	return time.Date(2022, 04, 20, 11, 00, second, 00, time.UTC)
+}
+
+func Test_broadcastToRoom_records_history(t *testing.T) {
+	historyStore := useTestHistory(t)
+	c1 := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}}
+	seedStore(c1)
+	monkey.Patch(time.Now, func() time.Time { return sentAt(0) })
+	defer monkey.Unpatch(time.Now)
+
+	c1.broadcastToRoom("test", "broom")
+	c1.broadcastToRoom("nobody home", "vroom")
+	c1.broadcastEvent(eventJoin, "Han Solo has entered: broom", "broom")
+	c1.broadcastNotice("Han Solo set the topic for broom: Home", "broom")
+
+	assert.Equal(t, []history.Entry{{Time: sentAt(0), Room: "broom", Sender: "Han Solo", Message: "test"}}, historyStore.Recent("broom", 10))
+	assert.Empty(t, historyStore.Recent("vroom", 10))
+}
+
+func Test_joinRoom_replays_history(t *testing.T) {
+	useTestHistory(t,
+		history.Entry{Time: sentAt(0), Room: "broom", Sender: "Han Solo", Message: "Chewie, we're home."},
+		history.Entry{Time: sentAt(1), Room: "broom", Sender: "Chewbacca", Message: "Rrraaaugh!"},
+		history.Entry{Time: sentAt(2), Room: "broom", Sender: "Han Solo", Message: "Punch it."},
+	)
+	previousReplay := HistoryReplay
+	HistoryReplay = 2
+	defer func() { HistoryReplay = previousReplay }()
+	w := &mocks.IoWriterMock{}
+	c1 := &Client{Id: "123", Name: "Han Solo", Writer: w}
+	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}}
+	seedStore(c1, c2)
+	monkey.Patch(time.Now, func() time.Time { return sentAt(30) })
+	defer monkey.Unpatch(time.Now)
+
+	response := c1.joinRoom("broom")
+
+	assert.Equal(t, "Han Solo has entered: broom", response.Payload)
+	assert.Equal(t, ToRoom, response.Audience)
+	assert.Equal(t, "1650452430: Server: \nCatching you up on broom:\n"+
+		"1650452401: [broom] Chewbacca: Rrraaaugh!\n"+
+		"1650452402: [broom] Han Solo> Punch it.\n", string(w.WriteCalledWith))
+}
+
+func Test_joinRoom_no_history_no_replay(t *testing.T) {
+	useTestHistory(t)
+	w := &mocks.IoWriterMock{}
+	c1 := &Client{Id: "123", Name: "Han Solo", Writer: w}
+	c2 := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "broom", Writer: &mocks.IoWriterMock{}}
+	seedStore(c1, c2)
+
+	c1.joinRoom("broom")
+
+	assert.False(t, w.WriteCalled)
+}
+
+func Test_showHistory(t *testing.T) {
+	entries := []history.Entry{}
+	for i := 0; i < 25; i++ {
+		entries = append(entries, history.Entry{Time: sentAt(i), Room: "broom", Sender: "Chewbacca", Message: fmt.Sprint(i)})
+	}
+	useTestHistory(t, entries...)
+	c := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "broom"}
+
+	response := c.showHistory("2")
+	assert.Equal(t, "\nLast 2 messages in broom:\n1650452423: [broom] Chewbacca: 23\n1650452424: [broom] Chewbacca: 24", response.Payload)
+	assert.Equal(t, eventCommandResult, response.Event)
+
+	response = c.showHistory("")
+	assert.Contains(t, response.Payload, "\nLast 20 messages in broom:\n1650452405: [broom] Chewbacca: 5\n")
+
+	response = c.showHistory("lots")
+	assert.Equal(t, "Invalid number of messages - usage: `\\history [number of messages]`", response.Payload)
+
+	response = c.showHistory("0")
+	assert.Equal(t, "Invalid number of messages - usage: `\\history [number of messages]`", response.Payload)
+
+	c.CurrentRoom = "vroom"
+	response = c.showHistory("")
+	assert.Equal(t, "No messages in vroom yet.", response.Payload)
+
+	c.CurrentRoom = ""
+	response = c.showHistory("")
+	assert.Equal(t, "You're not in a room - `\\join` one to see its history.", response.Payload)
+}
+
+// A room's history goes with it, so nobody creating a room under an old one's name can read what was said there.
+func Test_createRoom_starts_with_no_history(t *testing.T) {
+	historyStore := useTestHistory(t)
+	alice := &Client{Id: "123", Name: "Alice", Writer: &mocks.IoWriterMock{}}
+	bob := &Client{Id: "456", Name: "Bob", Writer: &mocks.IoWriterMock{}}
+	seedStore(alice, bob)
+
+	alice.deliver(alice.parseResponse("\\create den +password kessel-run"))
+	alice.broadcastToRoom("the secret plans are in R2", "den")
+	assert.Len(t, historyStore.Recent("den", 10), 1)
+	alice.deliver(alice.parseResponse("\\leave den"))
+	bob.deliver(bob.parseResponse("\\create den"))
+
+	assert.Equal(t, reply("No messages in den yet."), bob.parseResponse("\\history"))
+}
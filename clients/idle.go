@@ -0,0 +1,51 @@
+package clients
+
+import (
+	"fmt"
+	"time"
+)
+
+// How long a client can go without sending anything before they're disconnected, with `0` meaning never.  They're
+//	warned `IdleWarning` before it happens, so they have a chance to stay.
+var IdleTimeout time.Duration
+var IdleWarning = time.Minute
+
+// Connections that can time out their reads.  Telnet and TLS connections can, websockets can't (a timed out read
+//	breaks them for good), so they're never disconnected for being idle.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+func idleWarningEnabled() bool {
+	return IdleWarning > 0 && IdleWarning < IdleTimeout
+}
+
+// Push the client's read deadline back out, to the warning if they haven't had it yet or to the disconnect if they
+//	have.
+func (c *Client) extendIdleDeadline(warned bool) {
+	conn, ok := c.Conn.(readDeadliner)
+	if !ok || IdleTimeout <= 0 {
+		return
+	}
+	wait := IdleTimeout
+	if idleWarningEnabled() {
+		wait = IdleTimeout - IdleWarning
+		if warned {
+			wait = IdleWarning
+		}
+	}
+	conn.SetReadDeadline(time.Now().Add(wait))
+}
+
+// Handle a read that timed out, answering whether the client gets to stay - they do, once, if there's a warning to
+//	give them first.
+func (c *Client) idleTimedOut(warned bool) bool {
+	if !warned && idleWarningEnabled() {
+		c.WriteResponse(serverNotice(fmt.Sprintf("You've been idle for %v - say something in the next %v or you'll be disconnected.",
+			IdleTimeout-IdleWarning, IdleWarning)))
+		return true
+	}
+	c.WriteResponse(serverNotice(fmt.Sprintf("Disconnecting you after %v idle - see you next time!", IdleTimeout)))
+	c.leaveWith(fmt.Sprintf("%s has been disconnected for being idle.", c.UserName()))
+	return false
+}
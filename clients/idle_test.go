@@ -0,0 +1,67 @@
+package clients
+
+import (
+	"chat-telnet/mocks"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func useIdleTimeout(t *testing.T, timeout, warning time.Duration) {
+	previousTimeout, previousWarning := IdleTimeout, IdleWarning
+	IdleTimeout, IdleWarning = timeout, warning
+	t.Cleanup(func() { IdleTimeout, IdleWarning = previousTimeout, previousWarning })
+}
+
+// Connect a client over an in-memory pipe, which times out reads like a real connection does, join it to the room and
+//	then leave it be.  Hands back everything the client was sent up until it was hung up on.
+func connectAndIdle(t *testing.T, store *MemoryStore, roomName string) string {
+	server, client := net.Pipe()
+	output := make(chan string)
+	go func() {
+		data, _ := ioutil.ReadAll(client)
+		output <- string(data)
+	}()
+	err := GenerateNewClient(server, store)
+	assert.Nil(t, err)
+	fmt.Fprintf(client, "\\join %s\n", roomName)
+
+	select {
+	case received := <-output:
+		return received
+	case <-time.After(5 * time.Second):
+		t.Fatal("the idle client was never disconnected")
+		return ""
+	}
+}
+
+func Test_idle_client_is_warned_and_disconnected(t *testing.T) {
+	useIdleTimeout(t, 400*time.Millisecond, 200*time.Millisecond)
+	useTestHistory(t)
+	w := &mocks.IoWriterMock{}
+	bystander := &Client{Id: "123", Name: "Chewbacca", CurrentRoom: "cantina", Writer: w}
+	store := seedStore(bystander)
+
+	received := connectAndIdle(t, store, "cantina")
+
+	assert.Contains(t, received, ": Server: You've been idle for 200ms - say something in the next 200ms or you'll be disconnected.\n")
+	assert.Contains(t, received, ": Server: Disconnecting you after 400ms idle - see you next time!\n")
+	assert.Equal(t, 1, strings.Count(string(w.WriteCalledWith), "has been disconnected for being idle.\n"))
+	assert.NotContains(t, string(w.WriteCalledWith), "has gone offline")
+	assert.Equal(t, []*Client{bystander}, store.ListClients())
+}
+
+func Test_idle_client_without_warning(t *testing.T) {
+	useIdleTimeout(t, 200*time.Millisecond, 0)
+	useTestHistory(t)
+	store := seedStore(&Client{Id: "123", Name: "Chewbacca", CurrentRoom: "cantina", Writer: &mocks.IoWriterMock{}})
+
+	received := connectAndIdle(t, store, "cantina")
+
+	assert.NotContains(t, received, "You've been idle")
+	assert.Contains(t, received, ": Server: Disconnecting you after 200ms idle - see you next time!\n")
+}
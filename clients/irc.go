@@ -0,0 +1,561 @@
+package clients
+
+import (
+	"chat-telnet/events"
+	"chat-telnet/interfaces"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The name the server goes by in IRC, where it's the sender of every numeric reply and notice.
+var IRCServerName = "chattington"
+
+// What an IRC client has told us about itself.  Nobody gets into the store (or the rooms) until they've sent both a
+//	`NICK` and a `USER`, and the nick has been accepted.
+type ircSession struct {
+	nick       string
+	user       string
+	password   string
+	registered bool
+	// The id of the last `QUIT` or `NICK` the client was sent.  Unlike everything else here it's written from
+	//	whichever go routine is sending to the client, so it's only ever touched under the client's `mu`.
+	lastSeen uint64
+}
+
+type ircCommand struct {
+	minParams int
+	// Only a handful of commands make sense before the client has registered.
+	beforeRegistration bool
+	// Answers whether to carry on, which is always, other than for a `QUIT`.
+	handle func(c *Client, params []string) bool
+}
+
+// Just enough of RFC 1459/2812 for mainstream IRC clients to chat in the same rooms as everyone else, with each room
+//	going by `#<room name>`.
+var ircCommands = map[string]ircCommand{
+	"CAP":     {1, true, (*Client).ircCap},
+	"PASS":    {1, true, (*Client).ircPass},
+	"NICK":    {1, true, (*Client).ircNickCommand},
+	"USER":    {1, true, (*Client).ircUser},
+	"PING":    {1, true, (*Client).ircPing},
+	"PONG":    {0, true, func(c *Client, params []string) bool { return true }},
+	"QUIT":    {0, true, (*Client).ircQuit},
+	"JOIN":    {1, false, (*Client).ircJoin},
+	"PART":    {1, false, (*Client).ircPart},
+	"PRIVMSG": {1, false, (*Client).ircPrivmsg},
+	"NAMES":   {0, false, (*Client).ircNamesCommand},
+	"LIST":    {0, false, (*Client).ircList},
+	"TOPIC":   {1, false, (*Client).ircTopicCommand},
+	"MODE":    {1, false, (*Client).ircMode},
+	"WHO":     {1, false, (*Client).ircWho},
+}
+
+func GenerateIRCClient(conn interfaces.AbstractNetConn, store ChatStore) error {
+	log.Printf("Accepting new IRC connection from address %v\n", conn.RemoteAddr().String())
+
+	client := &Client{
+		Conn:   conn,
+		Writer: conn,
+		Id:     IdGenerator.NewId(),
+		Store:  store,
+		outbox: newOutbox(OutboundQueueSize, OutboundQueuePolicy),
+		irc:    &ircSession{},
+	}
+	// There's no intro for IRC - the client speaks first, and gets its welcome once it has registered.
+	go client.sendQueued()
+	go client.listen()
+	return nil
+}
+
+// IRC nicks can't have spaces in them, so anyone with a space in their name shows up with an underscore instead.
+func ircNick(name string) string {
+	return strings.ReplaceAll(name, " ", "_")
+}
+
+func ircPrefix(name string) string {
+	nick := ircNick(name)
+	return fmt.Sprintf("%s!%s@%s", nick, nick, IRCServerName)
+}
+
+func ircChannel(roomName string) string {
+	return "#" + roomName
+}
+
+// Rooms go by their name with a `#` in front, ex. `#cantina`, and anything without one isn't a room.
+func ircRoom(channel string) (string, bool) {
+	if len(channel) < 2 || channel[0] != '#' {
+		return "", false
+	}
+	return channel[1:], true
+}
+
+// Split a line up into its command and params, ex. `PRIVMSG #cantina :Hello there` is `PRIVMSG` with `#cantina` and
+//	`Hello there`.  Clients have no business sending a prefix, so if there is one it's ignored.
+func parseIRCLine(line string) (string, []string) {
+	if strings.HasPrefix(line, ":") {
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			return "", nil
+		}
+		line = line[i+1:]
+	}
+	params := []string{}
+	for line = strings.TrimLeft(line, " "); line != ""; line = strings.TrimLeft(line, " ") {
+		if strings.HasPrefix(line, ":") && len(params) > 0 {
+			params = append(params, line[1:])
+			break
+		}
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			params = append(params, line)
+			break
+		}
+		params = append(params, line[:i])
+		line = line[i+1:]
+	}
+	if len(params) == 0 {
+		return "", nil
+	}
+	return strings.ToUpper(params[0]), params[1:]
+}
+
+// Put a line together, making the last param a trailing one when it needs to be (ex. it has spaces in it).
+func ircLine(prefix, command string, params ...string) string {
+	parts := []string{command}
+	if prefix != "" {
+		parts = []string{prefix, command}
+	}
+	for i, param := range params {
+		// A line break would end the line early, and let whoever sent it slip their own commands in after it.
+		param = strings.NewReplacer("\r", " ", "\n", " ").Replace(param)
+		if i == len(params)-1 && (param == "" || strings.Contains(param, " ") || strings.HasPrefix(param, ":")) {
+			param = ":" + param
+		}
+		parts = append(parts, param)
+	}
+	return strings.Join(parts, " ") + "\r\n"
+}
+
+// Who messages to the client are addressed to, which is `*` until they've registered.
+func (c *Client) ircTarget() string {
+	if c.UserName() == "" {
+		return "*"
+	}
+	return ircNick(c.UserName())
+}
+
+func (c *Client) sendIRC(prefix, command string, params ...string) {
+	c.WriteString(ircLine(prefix, command, params...))
+}
+
+// Send the client a numeric reply, ex. `:chattington 001 Han :Welcome to Chattington`.
+func (c *Client) ircReply(code string, params ...string) {
+	c.sendIRC(":"+IRCServerName, code, append([]string{c.ircTarget()}, params...)...)
+}
+
+// Turn a response for the client into IRC, ex. `:Han!Han@chattington PRIVMSG #falcon :Punch it`.  IRC clients show
+//	what they send themselves, so nothing they said (or did) in a room is echoed back to them.  Anyone else coming,
+//	going or changing their name is sent as the `JOIN`, `PART`, `QUIT` or `NICK` IRC clients keep their member lists
+//	with.
+func (c *Client) formatIRC(r Response) string {
+	if r.Event == eventDirect {
+		return ircLine(":"+ircPrefix(r.Sender), "PRIVMSG", c.ircTarget(), r.Payload)
+	}
+	if r.Room != "" {
+		if r.Sender == c.UserName() {
+			return ""
+		}
+		from, channel := ":"+ircPrefix(r.Sender), ircChannel(r.Room)
+		switch {
+		case r.Event == eventJoin:
+			c.ircOnce(0, "")
+			return ircLine(from, "JOIN", channel)
+		case r.Event == eventLeave && r.Disconnect:
+			return c.ircOnce(r.id, ircLine(from, "QUIT", r.Payload))
+		case r.Event == eventLeave:
+			return ircLine(from, "PART", channel, r.Payload)
+		case r.Event == eventRename && r.OldName != "":
+			return c.ircOnce(r.id, ircLine(":"+ircPrefix(r.OldName), "NICK", ircNick(r.Sender)))
+		case r.notice():
+			return ircLine(":"+IRCServerName, "NOTICE", channel, r.Payload)
+		}
+		return ircLine(from, "PRIVMSG", channel, r.Payload)
+	}
+	// Everything else comes from the server, and can run over several lines.
+	lines := ""
+	for _, line := range strings.Split(r.Payload, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = lines + ircLine(":"+IRCServerName, "NOTICE", c.ircTarget(), line)
+		}
+	}
+	return lines
+}
+
+// Someone quitting, or changing their name, is announced in every room they're in, but IRC clients only expect to
+//	hear it the once, so leave out the line if it's another copy of the last one.  Anyone joining starts afresh.
+func (c *Client) ircOnce(id uint64, line string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id != 0 && id == c.irc.lastSeen {
+		return ""
+	}
+	c.irc.lastSeen = id
+	return line
+}
+
+// Handle one line from an IRC client, answering whether to carry on listening to them.
+func (c *Client) handleIRC(input string) bool {
+	name, params := parseIRCLine(input)
+	if name == "" {
+		return true
+	}
+	command, found := ircCommands[name]
+	if !found {
+		c.ircReply("421", name, "Unknown command")
+		return true
+	}
+	if !c.irc.registered && !command.beforeRegistration {
+		c.ircReply("451", "You have not registered")
+		return true
+	}
+	if len(params) < command.minParams {
+		c.ircReply("461", name, "Not enough parameters")
+		return true
+	}
+	return command.handle(c, params)
+}
+
+// We don't support any capabilities, but clients that ask will wait to hear that before registering.
+func (c *Client) ircCap(params []string) bool {
+	if strings.ToUpper(params[0]) == "LS" {
+		c.sendIRC(":"+IRCServerName, "CAP", "*", "LS", "")
+	}
+	return true
+}
+
+// The password for the account named after the nick, if there is one, which logs the client in as they register.
+func (c *Client) ircPass(params []string) bool {
+	if c.irc.registered {
+		c.ircReply("462", "You may not reregister")
+		return true
+	}
+	c.irc.password = params[0]
+	return true
+}
+
+func (c *Client) ircUser(params []string) bool {
+	if c.irc.registered {
+		c.ircReply("462", "You may not reregister")
+		return true
+	}
+	c.irc.user = params[0]
+	return c.ircRegister()
+}
+
+func (c *Client) ircNickCommand(params []string) bool {
+	nick := params[0]
+	if !c.irc.registered {
+		c.irc.nick = nick
+		return c.ircRegister()
+	}
+	if nick == ircNick(c.UserName()) {
+		return true
+	}
+	if other, found := c.Store.FindClientByName(nick); found && other != c {
+		c.ircReply("433", nick, "Nickname is already in use")
+		return true
+	}
+	oldName := c.UserName()
+	response := c.changeClientName(nick)
+	if response.failed() {
+		c.ircReply("432", nick, response.Payload)
+		return true
+	}
+	c.sendIRC(":"+ircPrefix(oldName), "NICK", ircNick(c.UserName()))
+	if response.Room != "" {
+		c.deliver(response)
+	}
+	return true
+}
+
+// Once the client has given both its nick and user, and the nick checks out, let them in and welcome them.
+func (c *Client) ircRegister() bool {
+	nick := c.irc.nick
+	if nick == "" || c.irc.user == "" {
+		return true
+	}
+	loggedIn := false
+	if c.irc.password != "" {
+		loggedIn = Accounts.Authenticate(nick, c.irc.password) == nil
+		if !loggedIn {
+			c.ircReply("464", "Password incorrect")
+		}
+	}
+	if err := NameRules.Validate(nick); err != nil {
+		c.ircReply("432", nick, fmt.Sprintf("Invalid name - %v.", err))
+		return true
+	}
+	if Accounts.Exists(nick) && !loggedIn {
+		c.ircReply("432", nick, fmt.Sprintf("`%s` is registered - connect with its password to claim it.", nick))
+		return true
+	}
+	// The store turns the nick down if someone else has it, in the same step as adding us, so nobody can slip in under
+	//	it in between.
+	c.setName(nick)
+	err := c.Store.AddClient(c)
+	if err == ErrNameTaken {
+		c.setName("")
+		c.ircReply("433", nick, "Nickname is already in use")
+		return true
+	}
+	if err != nil {
+		c.sendIRC("", "ERROR", err.Error())
+		return false
+	}
+	if loggedIn {
+		c.setAccount(nick)
+	}
+	c.irc.registered = true
+	c.publish(events.Event{Kind: events.Connect, Address: c.address()})
+
+	c.ircReply("001", fmt.Sprintf("Welcome to Chattington, %s", ircPrefix(c.UserName())))
+	c.ircReply("002", fmt.Sprintf("Your host is %s", IRCServerName))
+	c.ircReply("003", "Every room here is shared with the telnet and websocket users, as #<room name>")
+	c.ircReply("004", IRCServerName, "chat-telnet", "o", "o")
+	c.ircMOTD()
+	return true
+}
+
+func (c *Client) ircMOTD() {
+	message := MessageOfTheDay.Message()
+	if message == "" {
+		c.ircReply("422", "MOTD File is missing")
+		return
+	}
+	c.ircReply("375", fmt.Sprintf("- %s Message of the day -", IRCServerName))
+	for _, line := range strings.Split(message, "\n") {
+		c.ircReply("372", "- "+line)
+	}
+	c.ircReply("376", "End of /MOTD command")
+}
+
+func (c *Client) ircPing(params []string) bool {
+	c.sendIRC(":"+IRCServerName, "PONG", IRCServerName, params[0])
+	return true
+}
+
+// Every room the client is in hears they've gone once their connection is removed, along with why, if they said.
+func (c *Client) ircQuit(params []string) bool {
+	if len(params) > 0 && strings.TrimSpace(params[0]) != "" {
+		c.leaveWith(fmt.Sprintf("%s has gone offline (%s)", c.UserName(), params[0]))
+	}
+	c.sendIRC("", "ERROR", "Closing link")
+	return false
+}
+
+// The room commands are off limits until the client has logged in, when the server requires it.
+func (c *Client) ircLoggedIn() bool {
+	if RequireLogin && c.account() == "" {
+		c.WriteResponse(failure("Please connect with your account's password (`PASS`) to use the rooms."))
+		return false
+	}
+	return true
+}
+
+// Join each of the comma separated channels, creating any that don't exist yet, the same way IRC does.
+func (c *Client) ircJoin(params []string) bool {
+	if !c.ircLoggedIn() {
+		return true
+	}
+	keys := []string{}
+	if len(params) > 1 {
+		keys = strings.Split(params[1], ",")
+	}
+	for i, channel := range strings.Split(params[0], ",") {
+		roomName, ok := ircRoom(channel)
+		if !ok {
+			c.ircReply("403", channel, "No such channel")
+			continue
+		}
+		if c.inRoom(roomName) {
+			continue
+		}
+		var response Response
+		if _, found := c.Store.MembersOf(roomName); !found {
+			response = c.createRoom(roomName)
+		} else {
+			value := roomName
+			if i < len(keys) && keys[i] != "" {
+				value = value + " " + keys[i]
+			}
+			response = c.joinRoom(value)
+		}
+		if response.failed() {
+			c.WriteResponse(response)
+			continue
+		}
+		// Anyone already in the room hears about the join, but the creator of a new room has nobody to tell.
+		if response.Audience == ToRoom {
+			c.deliver(response)
+		}
+		c.sendIRC(":"+ircPrefix(c.UserName()), "JOIN", channel)
+		c.ircTopic(channel, roomName)
+		c.ircNames(channel, roomName)
+	}
+	return true
+}
+
+func (c *Client) ircPart(params []string) bool {
+	for _, channel := range strings.Split(params[0], ",") {
+		roomName, ok := ircRoom(channel)
+		if !ok || !c.inRoom(roomName) {
+			c.ircReply("442", channel, "You're not on that channel")
+			continue
+		}
+		c.leaveRoom(roomName)
+		c.sendIRC(":"+ircPrefix(c.UserName()), "PART", channel)
+	}
+	return true
+}
+
+// Talk in a room, or privately to someone by their nick.
+func (c *Client) ircPrivmsg(params []string) bool {
+	if len(params) < 2 || params[1] == "" {
+		c.ircReply("412", "No text to send")
+		return true
+	}
+	target, message := params[0], params[1]
+	if roomName, ok := ircRoom(target); ok {
+		if !c.inRoom(roomName) {
+			c.ircReply("404", target, "Cannot send to channel")
+			return true
+		}
+		if notice, muted := c.mutedIn(roomName); muted {
+			c.WriteResponse(failure(notice))
+			return true
+		}
+		c.broadcastToRoom(message, roomName)
+		return true
+	}
+	for _, client := range c.Store.ListClients() {
+		if strings.EqualFold(ircNick(client.UserName()), target) {
+			// IRC clients show what they send themselves, so there's nothing to tell this one.
+			c.deliver(Response{Audience: ToUser, Event: eventDirect, User: client.UserName(), Payload: message, recipient: client})
+			return true
+		}
+	}
+	c.ircReply("401", target, "No such nick/channel")
+	return true
+}
+
+func (c *Client) ircNamesCommand(params []string) bool {
+	channels := []string{}
+	if len(params) > 0 {
+		channels = strings.Split(params[0], ",")
+	} else {
+		for _, roomName := range c.Rooms() {
+			channels = append(channels, ircChannel(roomName))
+		}
+	}
+	for _, channel := range channels {
+		roomName, _ := ircRoom(channel)
+		c.ircNames(channel, roomName)
+	}
+	return true
+}
+
+// List who's in the room, the same as `\list` would, with the owner and moderators marked as channel operators.
+func (c *Client) ircNames(channel, roomName string) {
+	members, found := c.Store.MembersOf(roomName)
+	moderation, listed := c.Store.Moderation(roomName)
+	if found && (!listed || c.canSee(roomName, moderation)) {
+		nicks := []string{}
+		for _, member := range members {
+			nick := ircNick(member.UserName())
+			if listed && moderation.CanModerate(member) {
+				nick = "@" + nick
+			}
+			nicks = append(nicks, nick)
+		}
+		c.ircReply("353", "=", channel, strings.Join(nicks, " "))
+	}
+	c.ircReply("366", channel, "End of /NAMES list")
+}
+
+// List every room the client can see, the same as `\list-rooms` would.  Rooms with spaces in their names can't be
+//	IRC channels, so they're left out.
+func (c *Client) ircList(params []string) bool {
+	if !c.ircLoggedIn() {
+		return true
+	}
+	rooms := c.Store.ListRooms()
+	roomNames := []string{}
+	for name := range rooms {
+		if moderation, found := c.Store.Moderation(name); (found && !c.canSee(name, moderation)) ||
+			strings.Contains(name, " ") {
+			continue
+		}
+		roomNames = append(roomNames, name)
+	}
+	sort.Strings(roomNames)
+	c.ircReply("321", "Channel", "Users  Name")
+	for _, name := range roomNames {
+		moderation, _ := c.Store.Moderation(name)
+		c.ircReply("322", ircChannel(name), strconv.Itoa(len(rooms[name])), moderation.Topic)
+	}
+	c.ircReply("323", "End of /LIST")
+	return true
+}
+
+func (c *Client) ircTopicCommand(params []string) bool {
+	channel := params[0]
+	roomName, ok := ircRoom(channel)
+	if !ok || !c.inRoom(roomName) {
+		c.ircReply("442", channel, "You're not on that channel")
+		return true
+	}
+	if len(params) < 2 {
+		c.ircTopic(channel, roomName)
+		return true
+	}
+	// `\topic` works on the active room, so this is the one now.
+	if !c.talkIn(roomName) {
+		c.ircReply("442", channel, "You're not on that channel")
+		return true
+	}
+	response := c.topic(params[1])
+	if response.failed() {
+		c.WriteResponse(response)
+		return true
+	}
+	c.sendIRC(":"+ircPrefix(c.UserName()), "TOPIC", channel, params[1])
+	c.deliver(response)
+	return true
+}
+
+func (c *Client) ircTopic(channel, roomName string) {
+	moderation, _ := c.Store.Moderation(roomName)
+	if moderation.Topic == "" {
+		c.ircReply("331", channel, "No topic is set")
+		return
+	}
+	c.ircReply("332", channel, moderation.Topic)
+}
+
+// There are no modes to speak of, but clients ask after joining, so let them know.
+func (c *Client) ircMode(params []string) bool {
+	if _, ok := ircRoom(params[0]); ok {
+		c.ircReply("324", params[0], "+")
+		return true
+	}
+	c.ircReply("221", "+")
+	return true
+}
+
+func (c *Client) ircWho(params []string) bool {
+	c.ircReply("315", params[0], "End of /WHO list")
+	return true
+}
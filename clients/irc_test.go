@@ -0,0 +1,290 @@
+package clients
+
+import (
+	"bytes"
+	"chat-telnet/mocks"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// A registered IRC client, whose replies all land in the buffer.
+func newIRCClient(store *MemoryStore, name string) (*Client, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	c := &Client{Id: "irc-" + name, Name: name, Writer: out, Store: store, irc: &ircSession{registered: true}}
+	store.AddClient(c)
+	return c, out
+}
+
+func Test_parseIRCLine(t *testing.T) {
+	var tests = []struct {
+		line            string
+		expectedCommand string
+		expectedParams  []string
+	}{
+		{"NICK Lando", "NICK", []string{"Lando"}},
+		{"privmsg #cantina :Hello there, general", "PRIVMSG", []string{"#cantina", "Hello there, general"}},
+		{"USER lando 0 * :Lando Calrissian", "USER", []string{"lando", "0", "*", "Lando Calrissian"}},
+		{":Lando!lando@bespin JOIN  #cloud-city", "JOIN", []string{"#cloud-city"}},
+		{"TOPIC #falcon :", "TOPIC", []string{"#falcon", ""}},
+		{"", "", nil},
+		{":nobody", "", nil},
+	}
+	for _, tt := range tests {
+		command, params := parseIRCLine(tt.line)
+		assert.Equal(t, tt.expectedCommand, command, tt.line)
+		assert.Equal(t, tt.expectedParams, params, tt.line)
+	}
+}
+
+func Test_ircLine(t *testing.T) {
+	assert.Equal(t, ":chattington 001 Lando :Welcome to Chattington\r\n",
+		ircLine(":chattington", "001", "Lando", "Welcome to Chattington"))
+	assert.Equal(t, "PONG chattington token\r\n", ircLine("", "PONG", "chattington", "token"))
+	assert.Equal(t, ":chattington CAP * LS :\r\n", ircLine(":chattington", "CAP", "*", "LS", ""))
+	assert.Equal(t, ":Han!Han@chattington PRIVMSG #falcon :one  QUIT two\r\n",
+		ircLine(":Han!Han@chattington", "PRIVMSG", "#falcon", "one\r\nQUIT two"))
+}
+
+func Test_formatIRC(t *testing.T) {
+	c := &Client{Name: "Lando", irc: &ircSession{registered: true}}
+
+	heard := func(sender, event, payload string) Response {
+		return Response{Audience: ToRoom, Event: event, Room: "falcon", Sender: sender, Payload: payload}
+	}
+	quit := func(roomName string, id uint64) Response {
+		return Response{
+			Audience: ToRoom, Event: eventLeave, Room: roomName, Sender: "Captain Solo", Payload: "Captain Solo has gone offline",
+			Disconnect: true, id: id,
+		}
+	}
+
+	var tests = []struct {
+		response Response
+		expected string
+	}{
+		{heard("Han Solo", eventMessage, "Punch it"), ":Han_Solo!Han_Solo@chattington PRIVMSG #falcon :Punch it\r\n"},
+		{heard("Han Solo", eventJoin, "Han Solo has entered: falcon"), ":Han_Solo!Han_Solo@chattington JOIN #falcon\r\n"},
+		{heard("Han Solo", eventLeave, "Han Solo has left falcon."), ":Han_Solo!Han_Solo@chattington PART #falcon :Han Solo has left falcon.\r\n"},
+		{heard("Han Solo", eventNotice, "Greedo was kicked from falcon by Han Solo."), ":chattington NOTICE #falcon :Greedo was kicked from falcon by Han Solo.\r\n"},
+		{
+			Response{Audience: ToRoom, Event: eventRename, Room: "falcon", Sender: "Captain Solo", OldName: "Han Solo", Payload: "User: Han Solo has become -> Captain Solo", id: 1},
+			":Han_Solo!Han_Solo@chattington NICK Captain_Solo\r\n",
+		},
+		{quit("falcon", 2), ":Captain_Solo!Captain_Solo@chattington QUIT :Captain Solo has gone offline\r\n"},
+		// Every room they shared with Lando hears it, but Lando's client only needs telling the once.
+		{quit("cloud city", 2), ""},
+		// Coming back and quitting again, in the same words, is something new.
+		{heard("Captain Solo", eventJoin, "Captain Solo has entered: falcon"), ":Captain_Solo!Captain_Solo@chattington JOIN #falcon\r\n"},
+		{quit("falcon", 3), ":Captain_Solo!Captain_Solo@chattington QUIT :Captain Solo has gone offline\r\n"},
+		{heard("Lando", eventMessage, "Hello"), ""},
+		{heard("Lando", eventJoin, "Lando has entered: falcon"), ""},
+		{
+			Response{Audience: ToUser, Event: eventDirect, Sender: "Leia Organa", Payload: "Psst"},
+			":Leia_Organa!Leia_Organa@chattington PRIVMSG Lando Psst\r\n",
+		},
+		{serverNotice("\nCurrent Members:\n\tLando\n"), ":chattington NOTICE Lando :Current Members:\r\n:chattington NOTICE Lando \tLando\r\n"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, c.formatIRC(tt.response))
+	}
+}
+
+func Test_handleIRC_registration(t *testing.T) {
+	useTestAccounts(t)
+	Accounts.Register("Lando", "cloud-city")
+	store := seedStore(&Client{Id: "123", Name: "Han Solo", Writer: &mocks.IoWriterMock{}})
+	out := &bytes.Buffer{}
+	c := &Client{Id: "456", Writer: out, Store: store, irc: &ircSession{}}
+
+	assert.True(t, c.handleIRC("JOIN #falcon"))
+	assert.True(t, c.handleIRC("NICK Han!"))
+	assert.True(t, c.handleIRC("USER lando 0 * :Lando Calrissian"))
+	assert.True(t, c.handleIRC("NICK Lando"))
+	assert.True(t, c.handleIRC("PASS sabacc"))
+	assert.True(t, c.handleIRC("NICK Lando"))
+	assert.False(t, c.irc.registered)
+	assert.True(t, c.handleIRC("PASS cloud-city"))
+	assert.True(t, c.handleIRC("NICK Lando"))
+
+	lines := strings.Split(out.String(), "\r\n")
+	assert.Equal(t, ":chattington 451 * :You have not registered", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], ":chattington 432 * Han! :Invalid name - "))
+	assert.Equal(t, ":chattington 432 * Lando :`Lando` is registered - connect with its password to claim it.", lines[2])
+	assert.Equal(t, ":chattington 464 * :Password incorrect", lines[3])
+	assert.Equal(t, ":chattington 432 * Lando :`Lando` is registered - connect with its password to claim it.", lines[4])
+	assert.Equal(t, ":chattington 001 Lando :Welcome to Chattington, Lando!Lando@chattington", lines[5])
+	assert.Contains(t, out.String(), ":chattington 422 Lando :MOTD File is missing\r\n")
+	assert.True(t, c.irc.registered)
+	assert.Equal(t, "Lando", c.Account)
+	found, _ := store.FindClientByName("Lando")
+	assert.Equal(t, c, found)
+}
+
+func Test_handleIRC_nick_taken(t *testing.T) {
+	useTestAccounts(t)
+	store := seedStore(&Client{Id: "123", Name: "Han", Writer: &mocks.IoWriterMock{}})
+	out := &bytes.Buffer{}
+	c := &Client{Id: "456", Writer: out, Store: store, irc: &ircSession{}}
+
+	c.handleIRC("NICK han")
+	c.handleIRC("USER lando 0 * :Lando Calrissian")
+
+	assert.Equal(t, ":chattington 433 * han :Nickname is already in use\r\n", out.String())
+	assert.False(t, c.irc.registered)
+	assert.Equal(t, "", c.UserName())
+}
+
+func Test_handleIRC_join_and_talk(t *testing.T) {
+	useTestHistory(t)
+	w := &mocks.IoWriterMock{}
+	han := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "falcon", Writer: w}
+	store := seedStore(han)
+	han.topic("Kessel or bust")
+	c, out := newIRCClient(store, "Chewbacca")
+
+	c.handleIRC("JOIN #falcon,#cloud-city,nowhere")
+	lines := strings.SplitAfter(out.String(), "\r\n")
+	assert.Equal(t, []string{
+		":Chewbacca!Chewbacca@chattington JOIN #falcon\r\n",
+		":chattington 332 Chewbacca #falcon :Kessel or bust\r\n",
+		":chattington 353 Chewbacca = #falcon :@Han_Solo Chewbacca\r\n",
+		":chattington 366 Chewbacca #falcon :End of /NAMES list\r\n",
+	}, lines[:4])
+	assert.Contains(t, out.String(), ":Chewbacca!Chewbacca@chattington JOIN #cloud-city\r\n")
+	assert.Contains(t, out.String(), ":chattington 403 Chewbacca nowhere :No such channel\r\n")
+	assert.Contains(t, string(w.WriteCalledWith), "[falcon] Chewbacca: Chewbacca has entered: falcon\n")
+	assert.Equal(t, []string{"cloud-city", "falcon"}, c.Rooms())
+
+	out.Reset()
+	c.handleIRC("PRIVMSG #falcon :Rrraaawwr")
+	assert.Contains(t, string(w.WriteCalledWith), "[falcon] Chewbacca: Rrraaawwr\n")
+	// Nothing is echoed back.
+	assert.Equal(t, "", out.String())
+
+	han.broadcastToRoom("Punch it!", "falcon")
+	assert.Equal(t, ":Han_Solo!Han_Solo@chattington PRIVMSG #falcon :Punch it!\r\n", out.String())
+
+	out.Reset()
+	c.handleIRC("PRIVMSG han_solo :Psst")
+	assert.Contains(t, string(w.WriteCalledWith), "[DM] Chewbacca: Psst\n")
+	c.handleIRC("PRIVMSG #kessel :Hello?")
+	c.handleIRC("PART #falcon")
+	c.handleIRC("PART #falcon")
+	assert.Equal(t, ":chattington 404 Chewbacca #kessel :Cannot send to channel\r\n"+
+		":Chewbacca!Chewbacca@chattington PART #falcon\r\n"+
+		":chattington 442 Chewbacca #falcon :You're not on that channel\r\n", out.String())
+	assert.Contains(t, string(w.WriteCalledWith), "[falcon] Chewbacca: Chewbacca has left falcon.\n")
+}
+
+// Everyone else coming and going shows up the way IRC clients expect, so they can keep their member lists straight.
+func Test_handleIRC_others_join_rename_and_quit(t *testing.T) {
+	useTestHistory(t)
+	han := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "falcon", Writer: &mocks.IoWriterMock{}}
+	store := seedStore(han)
+	c, out := newIRCClient(store, "Chewbacca")
+	c.handleIRC("JOIN #falcon")
+	store.CreateRoom("cloud-city", c, RoomAccess{})
+	lando := &Client{Id: "456", Name: "Lando", Writer: &mocks.IoWriterMock{}, Conn: &mocks.NetConnMock{}}
+	store.AddClient(lando)
+	lando.Store = store
+	out.Reset()
+
+	lando.deliver(lando.joinRoom("cloud-city"))
+	lando.deliver(lando.joinRoom("falcon"))
+	lando.deliver(lando.changeClientName("Baron Administrator"))
+	lando.deliver(lando.parseResponse("\\leave cloud-city"))
+	lando.removeConnection()
+
+	assert.Equal(t, ":Lando!Lando@chattington JOIN #cloud-city\r\n"+
+		":Lando!Lando@chattington JOIN #falcon\r\n"+
+		":Lando!Lando@chattington NICK Baron_Administrator\r\n"+
+		":Baron_Administrator!Baron_Administrator@chattington PART #cloud-city :Baron Administrator has left cloud-city.\r\n"+
+		":Baron_Administrator!Baron_Administrator@chattington QUIT :Baron Administrator has gone offline\r\n", out.String())
+}
+
+// Every departure gets its own `QUIT`, even when it's the same person going in the same words as last time.
+func Test_handleIRC_same_user_quits_twice(t *testing.T) {
+	useTestHistory(t)
+	store := NewMemoryStore()
+	c, out := newIRCClient(store, "Chewbacca")
+	c.handleIRC("JOIN #falcon")
+	out.Reset()
+
+	for _, id := range []string{"123", "456"} {
+		han := &Client{Id: id, Name: "Han", Writer: &mocks.IoWriterMock{}, Conn: &mocks.NetConnMock{}, Store: store}
+		store.AddClient(han)
+		han.deliver(han.joinRoom("falcon"))
+		han.removeConnection()
+	}
+
+	assert.Equal(t, strings.Repeat(":Han!Han@chattington JOIN #falcon\r\n:Han!Han@chattington QUIT :Han has gone offline\r\n", 2), out.String())
+}
+
+// Kicked IRC clients are told the way IRC does it, so they let go of the channel.
+func Test_kick_irc_client(t *testing.T) {
+	useTestHistory(t)
+	han := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "falcon", Writer: &mocks.IoWriterMock{}}
+	store := seedStore(han)
+	c, out := newIRCClient(store, "Greedo")
+	c.handleIRC("JOIN #falcon")
+	out.Reset()
+
+	han.deliver(han.kick("Greedo"))
+
+	assert.Equal(t, ":Han_Solo!Han_Solo@chattington KICK #falcon Greedo :You've been kicked from falcon by Han Solo.\r\n", out.String())
+	assert.Equal(t, []string{}, c.Rooms())
+}
+
+func Test_handleIRC_list_and_topic(t *testing.T) {
+	store := seedStore(
+		&Client{Id: "123", Name: "Han Solo", CurrentRoom: "falcon", Writer: &mocks.IoWriterMock{}},
+		&Client{Id: "456", Name: "Greedo", CurrentRoom: "cantina", Writer: &mocks.IoWriterMock{}},
+	)
+	c, out := newIRCClient(store, "Chewbacca")
+	c.handleIRC("JOIN #falcon")
+	out.Reset()
+
+	c.handleIRC("LIST")
+	c.handleIRC("TOPIC #falcon :Kessel or bust")
+	c.handleIRC("TOPIC #cantina")
+
+	assert.Equal(t, ":chattington 321 Chewbacca Channel :Users  Name\r\n"+
+		":chattington 322 Chewbacca #cantina 1 :\r\n"+
+		":chattington 322 Chewbacca #falcon 2 :\r\n"+
+		":chattington 323 Chewbacca :End of /LIST\r\n"+
+		":chattington NOTICE Chewbacca :Only the owner and moderators of falcon can change its topic.\r\n"+
+		":chattington 442 Chewbacca #cantina :You're not on that channel\r\n", out.String())
+}
+
+func Test_handleIRC_ping_unknown_and_quit(t *testing.T) {
+	w := &mocks.IoWriterMock{}
+	store := seedStore(&Client{Id: "123", Name: "Han Solo", CurrentRoom: "falcon", Writer: w})
+	c, out := newIRCClient(store, "Chewbacca")
+	c.handleIRC("JOIN #falcon")
+	out.Reset()
+
+	assert.True(t, c.handleIRC("PING :12345"))
+	assert.True(t, c.handleIRC("KNOCK #falcon"))
+	assert.True(t, c.handleIRC("PRIVMSG"))
+	assert.False(t, c.handleIRC("QUIT :Bye"))
+
+	assert.Equal(t, ":chattington PONG chattington 12345\r\n"+
+		":chattington 421 Chewbacca KNOCK :Unknown command\r\n"+
+		":chattington 461 Chewbacca PRIVMSG :Not enough parameters\r\n"+
+		"ERROR :Closing link\r\n", out.String())
+	c.Conn = &mocks.NetConnMock{}
+	c.removeConnection()
+	assert.Contains(t, string(w.WriteCalledWith), "[falcon] Chewbacca: Chewbacca has gone offline (Bye)\n")
+}
+
+func Test_handleIRC_requires_login(t *testing.T) {
+	defer func() { RequireLogin = false }()
+	RequireLogin = true
+	c, out := newIRCClient(NewMemoryStore(), "Chewbacca")
+
+	c.handleIRC("JOIN #falcon")
+
+	assert.Contains(t, out.String(), "Please connect with your account's password (`PASS`) to use the rooms.")
+	assert.Equal(t, []string{}, c.Rooms())
+}
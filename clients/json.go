@@ -0,0 +1,183 @@
+package clients
+
+import (
+	"chat-telnet/interfaces"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// What happened, as told to clients speaking JSON.  Everything that happens in a room that isn't a join, a leave or a
+//	rename (ex. a kick or a new topic) is a notice, the same as anything from the server.
+const (
+	eventMessage       = "message"
+	eventDirect        = "dm"
+	eventJoin          = "join"
+	eventLeave         = "leave"
+	eventRename        = "rename"
+	eventNotice        = "notice"
+	eventError         = "error"
+	eventCommandResult = "command_result"
+)
+
+// Everything sent to a client speaking JSON is one of these, on a line of its own.  The room is empty for anything
+//	that didn't happen in one, ex. a DM.
+type jsonEvent struct {
+	Type      string `json:"type"`
+	Id        string `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+	Room      string `json:"room"`
+	Sender    string `json:"sender"`
+	Text      string `json:"text"`
+	Command   string `json:"command,omitempty"`    // The command a `command_result` (or `error`) is about.
+	RequestId string `json:"request_id,omitempty"` // The `id` of the request being answered, if it gave one.
+}
+
+// And everything they send us is one of these, ex. `{"type": "command", "command": "join", "args": "cantina"}` or
+//	`{"type": "message", "text": "Anyone seen Greedo?"}`.
+type jsonRequest struct {
+	Type    string `json:"type"`
+	Id      string `json:"id"`
+	Command string `json:"command"`
+	Args    string `json:"args"`
+	Room    string `json:"room"` // Where a message goes, if not the current room.
+	Text    string `json:"text"`
+}
+
+// Clients on the JSON port speak JSON lines from the very start, rather than switching with `\mode`.
+func GenerateJSONClient(conn interfaces.AbstractNetConn, store ChatStore) error {
+	log.Printf("Accepting new JSON connection from address %v\n", conn.RemoteAddr().String())
+
+	client := newClient(conn, store)
+	client.setSpeaksJSON(true)
+	return startClient(client)
+}
+
+func (c *Client) speaksJSON() bool {
+	return atomic.LoadInt32(&c.json) == 1
+}
+
+func (c *Client) setSpeaksJSON(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&c.json, value)
+}
+
+func (c *Client) setMode(value string) Response {
+	mode := strings.ToLower(value)
+	switch mode {
+	case "text":
+		c.setSpeaksJSON(false)
+	case "json":
+		c.setSpeaksJSON(true)
+	default:
+		return failure("Invalid mode - usage: `\\mode <text|json>`")
+	}
+	return reply(fmt.Sprintf("Mode set to %s.", mode))
+}
+
+// Turn a response for the client into an event, the same way `formatMessage` turns it into text.
+func (c *Client) formatJSON(sent int64, r Response) string {
+	event := jsonEvent{Type: r.Event, Timestamp: sent, Room: r.Room, Sender: r.Sender, Text: strings.Trim(r.Payload, "\n")}
+	if event.Type == "" {
+		event.Type = eventNotice
+	}
+	if event.Sender == "" {
+		event.Sender = c.UserName()
+	}
+	return encodeJSON(event)
+}
+
+func encodeJSON(event jsonEvent) string {
+	event.Id = IdGenerator.NewId()
+	// There's nothing in an event that can't be marshalled.
+	line, _ := json.Marshal(event)
+	return string(line) + "\n"
+}
+
+// Send the client an event of our own making, ex. the result of a command.
+func (c *Client) writeEvent(event jsonEvent) error {
+	event.Timestamp = time.Now().Unix()
+	if event.Sender == "" {
+		event.Sender = SERVER
+	}
+	log.Print(c.styleMessage(event.Timestamp, Response{Event: event.Type, Room: event.Room, Sender: event.Sender, Payload: event.Text}, false))
+	return c.WriteString(encodeJSON(event))
+}
+
+// Handle a line from a client speaking JSON, answering false once they're done with us.
+func (c *Client) handleJSON(input string) bool {
+	if input == "" {
+		return true
+	}
+	var request jsonRequest
+	if err := json.Unmarshal([]byte(input), &request); err != nil {
+		c.writeEvent(jsonEvent{Type: eventError, Text: fmt.Sprintf("Invalid JSON - %v.", err)})
+		return true
+	}
+	// Nothing sent over JSON gets to break up into lines of its own for anyone reading it as text.
+	request.Args = strings.Join(strings.Fields(request.Args), " ")
+	request.Text = strings.NewReplacer("\r", " ", "\n", " ").Replace(request.Text)
+
+	switch request.Type {
+	case "command":
+		return c.jsonCommand(request)
+	case eventMessage:
+		c.jsonMessage(request)
+	default:
+		c.writeEvent(jsonEvent{
+			Type: eventError, RequestId: request.Id,
+			Text: "Invalid type - requests are either a `command` or a `message`.",
+		})
+	}
+	return true
+}
+
+// Run the command just like it had been typed, ex. `{"command": "join", "args": "cantina"}` for `\join cantina`, and
+//	always answer with its result, even when the room hears about it too.
+func (c *Client) jsonCommand(request jsonRequest) bool {
+	name := "\\" + strings.TrimPrefix(strings.TrimSpace(request.Command), "\\")
+	command, value, problem := c.findCommand(strings.TrimSpace(name + " " + request.Args))
+	if command == nil {
+		c.writeEvent(jsonEvent{Type: eventError, Command: name, RequestId: request.Id, Text: problem})
+		return true
+	}
+	response := command.Handler(c, value)
+	result := jsonEvent{Type: eventCommandResult, Command: command.Name, RequestId: request.Id, Text: response.Payload}
+	if own := c.deliver(response); own.Payload != "" {
+		result.Text = own.Payload
+		if own.failed() {
+			result.Type = eventError
+		}
+	}
+	c.writeEvent(result)
+	return !response.Disconnect
+}
+
+// Say something in the room, or the current room if the request doesn't name one.
+func (c *Client) jsonMessage(request jsonRequest) {
+	roomName := request.Room
+	if roomName == "" {
+		roomName = c.ActiveRoom()
+	}
+	problem := ""
+	if roomName == "" {
+		problem = "You're not in a room - `\\join` one to talk in it."
+	} else if !c.inRoom(roomName) {
+		problem = fmt.Sprintf("You're not in %s - `\\join` it first.", roomName)
+	} else if strings.TrimSpace(request.Text) == "" {
+		problem = fmt.Sprintf("No message given for %s.", roomName)
+	} else if notice, muted := c.mutedIn(roomName); muted {
+		problem = notice
+	}
+	if problem != "" {
+		c.writeEvent(jsonEvent{Type: eventError, Room: roomName, RequestId: request.Id, Text: problem})
+		return
+	}
+	c.broadcastToRoom(request.Text, roomName)
+}
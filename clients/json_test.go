@@ -0,0 +1,185 @@
+package clients
+
+import (
+	"bytes"
+	"chat-telnet/ids"
+	"chat-telnet/mocks"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// A client speaking JSON, whose events all land in the buffer.
+func newJSONClient(name string) (*Client, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	c := &Client{Id: "json-" + name, Name: name, Writer: out}
+	c.setSpeaksJSON(true)
+	return c, out
+}
+
+// Every event written to the buffer, with the ids and timestamps that change from run to run left out.
+func readEvents(t *testing.T, out *bytes.Buffer) []jsonEvent {
+	events := []jsonEvent{}
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		var event jsonEvent
+		assert.Nil(t, json.Unmarshal([]byte(line), &event), line)
+		assert.NotEmpty(t, event.Id)
+		assert.NotZero(t, event.Timestamp)
+		event.Id, event.Timestamp = "", 0
+		events = append(events, event)
+	}
+	out.Reset()
+	return events
+}
+
+func Test_formatJSON(t *testing.T) {
+	defer func(g ids.Generator) { IdGenerator = g }(IdGenerator)
+	IdGenerator = &ids.SequenceGenerator{}
+	c := &Client{Name: "Lando"}
+
+	var tests = []struct {
+		response Response
+		expected string
+	}{
+		{
+			Response{Audience: ToRoom, Event: eventMessage, Room: "falcon", Sender: "Han Solo", Payload: "Punch it"},
+			`{"type":"message","id":"1","timestamp":1650452400,"room":"falcon","sender":"Han Solo","text":"Punch it"}`,
+		},
+		{
+			Response{Audience: ToRoom, Event: eventJoin, Room: "falcon", Sender: "Han Solo", Payload: "Han Solo has entered: falcon"},
+			`{"type":"join","id":"2","timestamp":1650452400,"room":"falcon","sender":"Han Solo","text":"Han Solo has entered: falcon"}`,
+		},
+		{
+			Response{Audience: ToUser, Event: eventDirect, Sender: "Leia Organa", Payload: "Psst"},
+			`{"type":"dm","id":"3","timestamp":1650452400,"room":"","sender":"Leia Organa","text":"Psst"}`,
+		},
+		{
+			serverNotice("\nCurrent Members:\n\tLando\n"),
+			`{"type":"notice","id":"4","timestamp":1650452400,"room":"","sender":"Server","text":"Current Members:\n\tLando"}`,
+		},
+		{
+			reply("Mode set to json."),
+			`{"type":"command_result","id":"5","timestamp":1650452400,"room":"","sender":"Lando","text":"Mode set to json."}`,
+		},
+		{
+			failure("No such room vroom!"),
+			`{"type":"error","id":"6","timestamp":1650452400,"room":"","sender":"Lando","text":"No such room vroom!"}`,
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected+"\n", c.formatJSON(1650452400, tt.response))
+	}
+}
+
+func Test_handleJSON_command(t *testing.T) {
+	han := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "falcon", Writer: &mocks.IoWriterMock{}}
+	store := seedStore(han)
+	c, out := newJSONClient("Chewbacca")
+	c.Store = store
+	store.AddClient(c)
+
+	assert.True(t, c.handleJSON(`{"type": "command", "command": "join", "args": "falcon", "id": "req-1"}`))
+	events := readEvents(t, out)
+
+	assert.Equal(t, jsonEvent{
+		Type: eventJoin, Room: "falcon", Sender: "Chewbacca", Text: "Chewbacca has entered: falcon",
+	}, events[len(events)-2])
+	assert.Equal(t, jsonEvent{
+		Type: eventCommandResult, Sender: SERVER, Text: "Chewbacca has entered: falcon",
+		Command: "\\join", RequestId: "req-1",
+	}, events[len(events)-1])
+	assert.Contains(t, string(han.Writer.(*mocks.IoWriterMock).WriteCalledWith), "[falcon] Chewbacca: Chewbacca has entered: falcon\n")
+
+	c.handleJSON(`{"type": "command", "command": "\\name", "args": "Chewie"}`)
+	events = readEvents(t, out)
+	assert.Equal(t, eventRename, events[0].Type)
+	assert.Equal(t, "User: Chewbacca has become -> Chewie", events[0].Text)
+	assert.Equal(t, eventCommandResult, events[1].Type)
+}
+
+func Test_handleJSON_message(t *testing.T) {
+	store := NewMemoryStore()
+	han, hanOut := newJSONClient("Han Solo")
+	c, out := newJSONClient("Chewbacca")
+	for _, client := range []*Client{han, c} {
+		client.Store = store
+		store.AddClient(client)
+	}
+	store.CreateRoom("falcon", han, RoomAccess{})
+	store.JoinRoom("falcon", c)
+	store.CreateRoom("cantina", c, RoomAccess{})
+	c.CurrentRoom = "cantina"
+
+	c.handleJSON(`{"type": "message", "room": "falcon", "text": "Rrraaawwr\nQUIT"}`)
+
+	expected := []jsonEvent{{Type: eventMessage, Room: "falcon", Sender: "Chewbacca", Text: "Rrraaawwr QUIT"}}
+	assert.Equal(t, expected, readEvents(t, hanOut))
+	assert.Equal(t, expected, readEvents(t, out))
+}
+
+func Test_handleJSON_errors(t *testing.T) {
+	c, out := newJSONClient("Chewbacca")
+	seedStore(c)
+
+	var tests = []struct {
+		input    string
+		expected jsonEvent
+	}{
+		{`Rrraaawwr`, jsonEvent{Type: eventError, Sender: SERVER, Text: "Invalid JSON - invalid character 'R' looking for beginning of value."}},
+		{`{"type": "shout"}`, jsonEvent{Type: eventError, Sender: SERVER, Text: "Invalid type - requests are either a `command` or a `message`."}},
+		{
+			`{"type": "command", "command": "fly", "id": "req-1"}`,
+			jsonEvent{Type: eventError, Sender: SERVER, Text: "Invalid command: `\\fly`", Command: "\\fly", RequestId: "req-1"},
+		},
+		{
+			`{"type": "command", "command": "join"}`,
+			jsonEvent{Type: eventError, Sender: SERVER, Text: "Missing value - usage: `\\join <room name> [password]`", Command: "\\join"},
+		},
+		{
+			`{"type": "command", "command": "join", "args": "nowhere", "id": "req-2"}`,
+			jsonEvent{
+				Type: eventError, Sender: SERVER, Text: "Room `nowhere` doesn't exist - try creating it with `\\create`",
+				Command: "\\join", RequestId: "req-2",
+			},
+		},
+		{
+			`{"type": "command", "command": "dm", "args": "Han Solo Punch it!"}`,
+			jsonEvent{
+				Type: eventError, Sender: SERVER, Text: "No such user to message - usage: `\\dm <user name> <message>`",
+				Command: "\\dm",
+			},
+		},
+		{`{"type": "message", "text": "Hello?"}`, jsonEvent{Type: eventError, Sender: SERVER, Text: "You're not in a room - `\\join` one to talk in it."}},
+		{
+			`{"type": "message", "room": "falcon", "text": "Hello?"}`,
+			jsonEvent{Type: eventError, Room: "falcon", Sender: SERVER, Text: "You're not in falcon - `\\join` it first."},
+		},
+	}
+	for _, tt := range tests {
+		assert.True(t, c.handleJSON(tt.input))
+		assert.Equal(t, []jsonEvent{tt.expected}, readEvents(t, out), tt.input)
+	}
+}
+
+func Test_setMode(t *testing.T) {
+	c, out := newJSONClient("Chewbacca")
+	c.setSpeaksJSON(false)
+
+	response := c.setMode("JSON")
+	c.WriteResponse(response)
+
+	assert.Equal(t, eventCommandResult, response.Event)
+	assert.True(t, c.speaksJSON())
+	assert.Equal(t, []jsonEvent{{Type: eventCommandResult, Sender: "Chewbacca", Text: "Mode set to json."}}, readEvents(t, out))
+
+	response = c.setMode("text")
+	assert.Equal(t, "Mode set to text.", response.Payload)
+	assert.False(t, c.speaksJSON())
+
+	response = c.setMode("xml")
+	assert.Equal(t, failure("Invalid mode - usage: `\\mode <text|json>`"), response)
+}
@@ -0,0 +1,362 @@
+package clients
+
+import (
+	"chat-telnet/events"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Member is who someone is as far as a room's owner, moderators, bans and mutes are concerned.  The id only lasts as
+//	long as the connection, so an account, if they've logged in to one, is what carries over between visits.
+type Member struct {
+	Id      string
+	Account string
+	Name    string
+}
+
+func MemberOf(c *Client) Member {
+	return Member{Id: c.Id, Account: c.account(), Name: c.UserName()}
+}
+
+// Whether the client is this member - the same connection, or logged in to the same account.  Names are deliberately
+//	left out, since a guest's name is up for grabs the moment they leave.
+func (m Member) Is(c *Client) bool {
+	if m.Id != "" && m.Id == c.Id {
+		return true
+	}
+	return m.Account != "" && strings.EqualFold(m.Account, c.account())
+}
+
+// Restriction is a ban or a mute, holding until `Until`, or until it's lifted if `Until` is zero.
+type Restriction struct {
+	Member
+	By    string
+	Until time.Time
+}
+
+// Bans and mutes are looser than `Member.Is`, and match on name too, so nobody can get out from under one by
+//	reconnecting as the same guest.
+func (r Restriction) Matches(c *Client) bool {
+	return r.Member.Is(c) || (r.Name != "" && strings.EqualFold(r.Name, c.UserName()))
+}
+
+func (r Restriction) ActiveAt(now time.Time) bool {
+	return r.Until.IsZero() || now.Before(r.Until)
+}
+
+// How long is left on the restriction, in a form that reads well after "banned" or "muted".
+func (r Restriction) Remaining(now time.Time) string {
+	if r.Until.IsZero() {
+		return "until further notice"
+	}
+	return fmt.Sprintf("for another %v", r.Until.Sub(now).Round(time.Second))
+}
+
+// RoomModeration is who has authority over a room, who it's being used on and who the room lets in, along with the
+//	room's other settings.  The owner is whoever created the room, and keeps it for as long as the room lasts, even if
+//	they step out for a while.
+type RoomModeration struct {
+	RoomAccess
+	Owner      Member
+	Moderators []Member
+	Bans       []Restriction
+	Mutes      []Restriction
+	// Persistent rooms are kept, along with everything here, once the last member leaves instead of being deleted.
+	Persistent bool
+	Topic      string
+}
+
+func (m RoomModeration) copy() RoomModeration {
+	m.Moderators = append([]Member{}, m.Moderators...)
+	m.Bans = append([]Restriction{}, m.Bans...)
+	m.Mutes = append([]Restriction{}, m.Mutes...)
+	m.Invites = append([]Member{}, m.Invites...)
+	return m
+}
+
+func (m RoomModeration) IsOwner(c *Client) bool {
+	return m.Owner.Is(c)
+}
+
+func (m RoomModeration) IsModerator(c *Client) bool {
+	for _, moderator := range m.Moderators {
+		if moderator.Is(c) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m RoomModeration) CanModerate(c *Client) bool {
+	return m.IsOwner(c) || m.IsModerator(c)
+}
+
+func (m RoomModeration) ActiveBan(c *Client, now time.Time) (Restriction, bool) {
+	return activeRestriction(m.Bans, c, now)
+}
+
+func (m RoomModeration) ActiveMute(c *Client, now time.Time) (Restriction, bool) {
+	return activeRestriction(m.Mutes, c, now)
+}
+
+func activeRestriction(restrictions []Restriction, c *Client, now time.Time) (Restriction, bool) {
+	for _, r := range restrictions {
+		if r.Matches(c) && r.ActiveAt(now) {
+			return r, true
+		}
+	}
+	return Restriction{}, false
+}
+
+// Everything in the list except what `remove` picks out, along with anything that has already run out.
+func pruneRestrictions(restrictions []Restriction, now time.Time, remove func(r Restriction) bool) []Restriction {
+	pruned := []Restriction{}
+	for _, r := range restrictions {
+		if r.ActiveAt(now) && !remove(r) {
+			pruned = append(pruned, r)
+		}
+	}
+	return pruned
+}
+
+var errNotModerated = errors.New("nothing to change")
+
+// `\ban` and `\mute` take `<user name> [duration]`.  User names can have spaces in them, so the duration is only
+//	split off the end if it actually reads as one, ex. `10m` or `1h30m`.
+func splitDuration(value string) (string, time.Duration, error) {
+	durationIndex := strings.LastIndexByte(value, ' ')
+	if durationIndex < 0 {
+		return value, 0, nil
+	}
+	duration, err := time.ParseDuration(value[durationIndex+1:])
+	if err != nil {
+		return value, 0, nil
+	}
+	if duration <= 0 {
+		return "", 0, fmt.Errorf("durations have to be more than nothing")
+	}
+	return strings.TrimSpace(value[:durationIndex]), duration, nil
+}
+
+func describeDuration(duration time.Duration) string {
+	if duration == 0 {
+		return "until further notice"
+	}
+	return fmt.Sprintf("for %v", duration)
+}
+
+// Check the moderator is allowed to act on the target at all - nobody can act on themselves or on the room's owner, and
+//	only the owner can act on the other moderators.
+func (c *Client) checkTarget(moderation RoomModeration, target *Client, action string) (string, bool) {
+	if target == c {
+		return fmt.Sprintf("You can't %s yourself.", action), false
+	}
+	if moderation.IsOwner(target) {
+		return fmt.Sprintf("You can't %s the owner of %s.", action, c.ActiveRoom()), false
+	}
+	if moderation.IsModerator(target) && !moderation.IsOwner(c) {
+		return fmt.Sprintf("Only the owner of %s can %s a moderator.", c.ActiveRoom(), action), false
+	}
+	return "", true
+}
+
+// Find the user named in a moderation command, who has to be in the moderator's room.
+func (c *Client) findRoomMember(name string) (*Client, string, bool) {
+	target, found := c.Store.FindClientByName(name)
+	if !found || !target.inRoom(c.ActiveRoom()) {
+		return nil, fmt.Sprintf("There's nobody called %s in %s.", name, c.ActiveRoom()), false
+	}
+	return target, "", true
+}
+
+// Take someone out of the moderator's room and let them know why.
+func (c *Client) removeFromRoom(target *Client, notice string) {
+	roomName := c.ActiveRoom()
+	c.Store.LeaveRoom(roomName, target)
+	target.droppedFrom(roomName)
+	target.publish(events.Event{Kind: events.Leave, Room: roomName, Text: notice})
+	if target.irc != nil {
+		// IRC clients hang on to the channel until they're told they've been kicked out of it.
+		target.sendIRC(":"+ircPrefix(c.UserName()), "KICK", ircChannel(roomName), ircNick(target.UserName()), notice)
+		return
+	}
+	target.WriteResponse(serverNotice(notice))
+}
+
+func (c *Client) kick(value string) Response {
+	moderation, _ := c.Store.Moderation(c.ActiveRoom())
+	target, response, ok := c.findRoomMember(value)
+	if !ok {
+		return failure(response)
+	}
+	if response, ok := c.checkTarget(moderation, target, "kick"); !ok {
+		return failure(response)
+	}
+	c.removeFromRoom(target, fmt.Sprintf("You've been kicked from %s by %s.", c.ActiveRoom(), c.UserName()))
+	return announce(c.ActiveRoom(), eventNotice, fmt.Sprintf("%s was kicked from %s by %s.", target.UserName(), c.ActiveRoom(), c.UserName()))
+}
+
+// Ban someone from the room, kicking them out first if they're in it.  Anyone who isn't online can still be banned
+//	by name, so they can't just come back later.
+func (c *Client) ban(value string) Response {
+	name, duration, err := splitDuration(value)
+	if err != nil {
+		return failure(fmt.Sprintf("Invalid ban - %v.", err))
+	}
+	ban := Restriction{Member: Member{Name: name}, By: c.UserName()}
+	target, online := c.Store.FindClientByName(name)
+	if online {
+		ban.Member = MemberOf(target)
+	}
+	if duration > 0 {
+		ban.Until = time.Now().Add(duration)
+	}
+
+	response := ""
+	err = c.Store.UpdateModeration(c.ActiveRoom(), func(moderation *RoomModeration) error {
+		if online {
+			var ok bool
+			if response, ok = c.checkTarget(*moderation, target, "ban"); !ok {
+				return errNotModerated
+			}
+		}
+		now := time.Now()
+		moderation.Bans = pruneRestrictions(moderation.Bans, now, func(r Restriction) bool {
+			return strings.EqualFold(r.Name, ban.Name)
+		})
+		moderation.Bans = append(moderation.Bans, ban)
+		return nil
+	})
+	if err != nil {
+		return failure(response)
+	}
+
+	if online && target.inRoom(c.ActiveRoom()) {
+		c.removeFromRoom(target, fmt.Sprintf("You've been banned from %s by %s %s.", c.ActiveRoom(), c.UserName(), describeDuration(duration)))
+	}
+	return announce(c.ActiveRoom(), eventNotice, fmt.Sprintf("%s was banned from %s by %s %s.", name, c.ActiveRoom(), c.UserName(), describeDuration(duration)))
+}
+
+func (c *Client) unban(value string) Response {
+	lifted := false
+	c.Store.UpdateModeration(c.ActiveRoom(), func(moderation *RoomModeration) error {
+		before := len(moderation.Bans)
+		moderation.Bans = pruneRestrictions(moderation.Bans, time.Now(), func(r Restriction) bool {
+			return strings.EqualFold(r.Name, value) || strings.EqualFold(r.Account, value)
+		})
+		lifted = len(moderation.Bans) < before
+		return nil
+	})
+	if !lifted {
+		return failure(fmt.Sprintf("%s isn't banned from %s.", value, c.ActiveRoom()))
+	}
+	if target, online := c.Store.FindClientByName(value); online {
+		target.WriteResponse(serverNotice(fmt.Sprintf("You've been unbanned from %s by %s.", c.ActiveRoom(), c.UserName())))
+	}
+	return reply(fmt.Sprintf("%s is no longer banned from %s.", value, c.ActiveRoom()))
+}
+
+func (c *Client) mute(value string) Response {
+	name, duration, err := splitDuration(value)
+	if err != nil {
+		return failure(fmt.Sprintf("Invalid mute - %v.", err))
+	}
+	target, response, ok := c.findRoomMember(name)
+	if !ok {
+		return failure(response)
+	}
+	mute := Restriction{Member: MemberOf(target), By: c.UserName()}
+	if duration > 0 {
+		mute.Until = time.Now().Add(duration)
+	}
+
+	err = c.Store.UpdateModeration(c.ActiveRoom(), func(moderation *RoomModeration) error {
+		if response, ok = c.checkTarget(*moderation, target, "mute"); !ok {
+			return errNotModerated
+		}
+		moderation.Mutes = pruneRestrictions(moderation.Mutes, time.Now(), func(r Restriction) bool {
+			return r.Matches(target)
+		})
+		moderation.Mutes = append(moderation.Mutes, mute)
+		return nil
+	})
+	if err != nil {
+		return failure(response)
+	}
+	target.WriteResponse(serverNotice(fmt.Sprintf("You've been muted in %s by %s %s.", c.ActiveRoom(), c.UserName(), describeDuration(duration))))
+	return announce(c.ActiveRoom(), eventNotice, fmt.Sprintf("%s was muted by %s %s.", target.UserName(), c.UserName(), describeDuration(duration)))
+}
+
+func (c *Client) unmute(value string) Response {
+	target, response, ok := c.findRoomMember(value)
+	if !ok {
+		return failure(response)
+	}
+	lifted := false
+	c.Store.UpdateModeration(c.ActiveRoom(), func(moderation *RoomModeration) error {
+		before := len(moderation.Mutes)
+		moderation.Mutes = pruneRestrictions(moderation.Mutes, time.Now(), func(r Restriction) bool {
+			return r.Matches(target)
+		})
+		lifted = len(moderation.Mutes) < before
+		return nil
+	})
+	if !lifted {
+		return failure(fmt.Sprintf("%s isn't muted.", target.UserName()))
+	}
+	target.WriteResponse(serverNotice(fmt.Sprintf("You've been unmuted in %s by %s.", c.ActiveRoom(), c.UserName())))
+	return announce(c.ActiveRoom(), eventNotice, fmt.Sprintf("%s was unmuted by %s.", target.UserName(), c.UserName()))
+}
+
+// Only the owner can hand out (and take back) moderator status, and only to people in the room.
+func (c *Client) setModerator(value string, moderator bool) Response {
+	target, response, ok := c.findRoomMember(value)
+	if !ok {
+		return failure(response)
+	}
+	if target == c {
+		return failure("You already own the room.")
+	}
+	err := c.Store.UpdateModeration(c.ActiveRoom(), func(moderation *RoomModeration) error {
+		if moderation.IsModerator(target) == moderator {
+			return errNotModerated
+		}
+		moderators := []Member{}
+		for _, m := range moderation.Moderators {
+			if !m.Is(target) {
+				moderators = append(moderators, m)
+			}
+		}
+		if moderator {
+			moderators = append(moderators, MemberOf(target))
+		}
+		moderation.Moderators = moderators
+		return nil
+	})
+	if moderator {
+		if err != nil {
+			return failure(fmt.Sprintf("%s is already a moderator of %s.", target.UserName(), c.ActiveRoom()))
+		}
+		return announce(c.ActiveRoom(), eventNotice, fmt.Sprintf("%s is now a moderator of %s.", target.UserName(), c.ActiveRoom()))
+	}
+	if err != nil {
+		return failure(fmt.Sprintf("%s isn't a moderator of %s.", target.UserName(), c.ActiveRoom()))
+	}
+	return announce(c.ActiveRoom(), eventNotice, fmt.Sprintf("%s is no longer a moderator of %s.", target.UserName(), c.ActiveRoom()))
+}
+
+// The message path checks this before anything goes out to the room, telling the muted user why nobody can hear them.
+func (c *Client) mutedIn(roomName string) (string, bool) {
+	moderation, found := c.Store.Moderation(roomName)
+	if !found {
+		return "", false
+	}
+	now := time.Now()
+	mute, muted := moderation.ActiveMute(c, now)
+	if !muted {
+		return "", false
+	}
+	return fmt.Sprintf("You're muted in %s %s - nobody else can see your messages.", roomName, mute.Remaining(now)), true
+}
@@ -0,0 +1,216 @@
+package clients
+
+import (
+	"bou.ke/monkey"
+	"chat-telnet/mocks"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Han creates the room, so he owns it, and Chewbacca and Greedo are in there with him.
+func seedModeratedRoom() (*Client, *Client, *Client, *mocks.IoWriterMock) {
+	w := &mocks.IoWriterMock{}
+	owner := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "cantina", Writer: &mocks.IoWriterMock{}}
+	moderator := &Client{Id: "456", Name: "Chewbacca", CurrentRoom: "cantina", Writer: &mocks.IoWriterMock{}}
+	target := &Client{Id: "789", Name: "Greedo", CurrentRoom: "cantina", Writer: w}
+	seedStore(owner, moderator, target)
+	return owner, moderator, target, w
+}
+
+func patchNow(t *testing.T, now time.Time) {
+	monkey.Patch(time.Now, func() time.Time { return now })
+	t.Cleanup(func() { monkey.Unpatch(time.Now) })
+}
+
+func Test_CreateRoom_records_owner(t *testing.T) {
+	owner, moderator, _, _ := seedModeratedRoom()
+
+	moderation, found := owner.Store.Moderation("cantina")
+
+	assert.True(t, found)
+	assert.True(t, moderation.IsOwner(owner))
+	assert.False(t, moderation.CanModerate(moderator))
+}
+
+func Test_kick_success(t *testing.T) {
+	owner, _, target, w := seedModeratedRoom()
+
+	response := owner.parseResponse("\\kick greedo")
+
+	assert.False(t, response.Disconnect)
+	assert.Equal(t, "Greedo was kicked from cantina by Han Solo.", response.Payload)
+	assert.Equal(t, ToRoom, response.Audience)
+	assert.Equal(t, "", target.CurrentRoom)
+	assert.Contains(t, string(w.WriteCalledWith), ": Server: You've been kicked from cantina by Han Solo.\n")
+	room, _ := owner.Store.MembersOf("cantina")
+	assert.NotContains(t, room, target)
+}
+
+// Kicks come from the moderator's go routine while the target carries on switching rooms in their own, so run this
+//	with `-race` too.
+func Test_kick_while_switching_rooms(t *testing.T) {
+	useTestHistory(t)
+	owner := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "cantina", Writer: ioutil.Discard}
+	target := &Client{Id: "789", Name: "Greedo", CurrentRoom: "cantina", Writer: ioutil.Discard}
+	seedStore(owner, target)
+	target.createRoom("hideout")
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			owner.kick("Greedo")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			target.joinRoom("cantina")
+			target.switchRoom("hideout")
+			target.switchRoom("cantina")
+		}
+	}()
+	wg.Wait()
+
+	assert.True(t, target.inRoom(target.ActiveRoom()), target.ActiveRoom())
+}
+
+func Test_moderation_permissions(t *testing.T) {
+	owner, moderator, target, _ := seedModeratedRoom()
+	outsider := &Client{Id: "000", Name: "Jabba", Writer: &mocks.IoWriterMock{}, Store: owner.Store}
+	owner.Store.AddClient(outsider)
+
+	var tests = []struct {
+		client   *Client
+		input    string
+		expected string
+	}{
+		{target, "\\kick Chewbacca", "Only the owner and moderators of cantina can use `\\kick`."},
+		{outsider, "\\ban Greedo", "You need to be in a room to use `\\ban`."},
+		{moderator, "\\mod Greedo", "Only the owner of cantina can use `\\mod`."},
+		{owner, "\\kick Han Solo", "You can't kick yourself."},
+		{owner, "\\kick Jabba", "There's nobody called Jabba in cantina."},
+		{owner, "\\mod Chewbacca", "Chewbacca is now a moderator of cantina."},
+		{owner, "\\mod Chewbacca", "Chewbacca is already a moderator of cantina."},
+		{moderator, "\\kick Han Solo", "You can't kick the owner of cantina."},
+		{target, "\\mute Chewbacca", "Only the owner and moderators of cantina can use `\\mute`."},
+		{owner, "\\mod Greedo", "Greedo is now a moderator of cantina."},
+		{moderator, "\\mute Greedo", "Only the owner of cantina can mute a moderator."},
+		{owner, "\\unmod Greedo", "Greedo is no longer a moderator of cantina."},
+		{owner, "\\unmod Greedo", "Greedo isn't a moderator of cantina."},
+		{moderator, "\\mute Greedo", "Greedo was muted by Chewbacca until further notice."},
+	}
+	for _, tt := range tests {
+		response := tt.client.parseResponse(tt.input).Payload
+		assert.Equal(t, tt.expected, response, tt.input)
+	}
+}
+
+func Test_ban_keeps_user_out_until_it_runs_out(t *testing.T) {
+	owner, _, target, w := seedModeratedRoom()
+	now := time.Date(2022, 04, 20, 11, 00, 00, 00, time.UTC)
+	patchNow(t, now)
+
+	response := owner.ban("Greedo 10m")
+
+	assert.Equal(t, "Greedo was banned from cantina by Han Solo for 10m0s.", response.Payload)
+	assert.Equal(t, ToRoom, response.Audience)
+	assert.Equal(t, "", target.CurrentRoom)
+	assert.Contains(t, string(w.WriteCalledWith), "You've been banned from cantina by Han Solo for 10m0s.")
+
+	patchNow(t, now.Add(4*time.Minute))
+	response = target.joinRoom("cantina")
+	assert.Equal(t, "You're banned from cantina for another 6m0s.", response.Payload)
+	assert.Equal(t, eventError, response.Event)
+	// Changing names doesn't get anyone around a ban.
+	target.Store.RenameClient(target, "Not Greedo")
+	assert.Equal(t, ErrBanned, target.Store.JoinRoom("cantina", target))
+
+	patchNow(t, now.Add(11*time.Minute))
+	response = target.joinRoom("cantina")
+	assert.Equal(t, "Not Greedo has entered: cantina", response.Payload)
+}
+
+func Test_ban_by_name_while_offline(t *testing.T) {
+	owner, _, _, _ := seedModeratedRoom()
+
+	response := owner.ban("Boba Fett")
+	assert.Equal(t, "Boba Fett was banned from cantina by Han Solo until further notice.", response.Payload)
+
+	boba := &Client{Id: "999", Name: "boba fett", Writer: &mocks.IoWriterMock{}, Store: owner.Store}
+	owner.Store.AddClient(boba)
+	response = boba.joinRoom("cantina")
+	assert.Equal(t, "You're banned from cantina until further notice.", response.Payload)
+
+	response = owner.unban("BOBA FETT")
+	assert.Equal(t, "BOBA FETT is no longer banned from cantina.", response.Payload)
+	assert.Equal(t, eventCommandResult, response.Event)
+	assert.Nil(t, owner.Store.JoinRoom("cantina", boba))
+
+	response = owner.unban("Boba Fett")
+	assert.Equal(t, "Boba Fett isn't banned from cantina.", response.Payload)
+}
+
+func Test_mute_and_unmute(t *testing.T) {
+	owner, _, target, w := seedModeratedRoom()
+	now := time.Date(2022, 04, 20, 11, 00, 00, 00, time.UTC)
+	patchNow(t, now)
+
+	response := owner.mute("Greedo 90s")
+	assert.Equal(t, "Greedo was muted by Han Solo for 1m30s.", response.Payload)
+	assert.Equal(t, ToRoom, response.Audience)
+	assert.Contains(t, string(w.WriteCalledWith), "You've been muted in cantina by Han Solo for 1m30s.")
+
+	notice, muted := target.mutedIn("cantina")
+	assert.True(t, muted)
+	assert.Equal(t, "You're muted in cantina for another 1m30s - nobody else can see your messages.", notice)
+	_, muted = owner.mutedIn("cantina")
+	assert.False(t, muted)
+
+	response = owner.unmute("Greedo")
+	assert.Equal(t, "Greedo was unmuted by Han Solo.", response.Payload)
+	assert.Equal(t, ToRoom, response.Audience)
+	assert.Contains(t, string(w.WriteCalledWith), "You've been unmuted in cantina by Han Solo.")
+	_, muted = target.mutedIn("cantina")
+	assert.False(t, muted)
+
+	response = owner.unmute("Greedo")
+	assert.Equal(t, "Greedo isn't muted.", response.Payload)
+}
+
+func Test_mute_runs_out(t *testing.T) {
+	owner, _, target, _ := seedModeratedRoom()
+	now := time.Date(2022, 04, 20, 11, 00, 00, 00, time.UTC)
+	patchNow(t, now)
+	owner.mute("Greedo 1m")
+
+	patchNow(t, now.Add(time.Minute))
+	_, muted := target.mutedIn("cantina")
+
+	assert.False(t, muted)
+}
+
+func Test_splitDuration(t *testing.T) {
+	var tests = []struct {
+		value            string
+		expectedName     string
+		expectedDuration time.Duration
+		expectedError    string
+	}{
+		{"Greedo", "Greedo", 0, "<nil>"},
+		{"Boba Fett", "Boba Fett", 0, "<nil>"},
+		{"Boba Fett 1h30m", "Boba Fett", 90 * time.Minute, "<nil>"},
+		{"Greedo -5m", "", 0, "durations have to be more than nothing"},
+	}
+	for _, tt := range tests {
+		name, duration, err := splitDuration(tt.value)
+		assert.Equal(t, tt.expectedName, name)
+		assert.Equal(t, tt.expectedDuration, duration)
+		assert.Equal(t, tt.expectedError, fmt.Sprint(err))
+	}
+}
@@ -0,0 +1,46 @@
+package clients
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// MOTD is the server-wide message of the day, shown to everyone as they connect, right after the welcome banner.  It's
+//	read from `Path`, and can be read again at any time (ex. on a `SIGHUP`) without anyone having to reconnect.
+type MOTD struct {
+	Path    string
+	mu      sync.RWMutex
+	message string
+}
+
+// The message of the day everyone is greeted with - empty, and so never shown, unless the server sets up a file.
+var MessageOfTheDay = &MOTD{}
+
+// Read the message in from `Path`.  If that fails the message we already had is kept, so a bad edit can't wipe it out.
+func (m *MOTD) Load() error {
+	data, err := ioutil.ReadFile(m.Path)
+	if err != nil {
+		return fmt.Errorf("Unable to read MOTD file %s: %v", m.Path, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.message = strings.TrimSpace(string(data))
+	return nil
+}
+
+func (m *MOTD) Message() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.message
+}
+
+// The message laid out to go under the banner, or nothing at all if there isn't one.
+func (m *MOTD) banner() string {
+	message := m.Message()
+	if message == "" {
+		return ""
+	}
+	return fmt.Sprintf("\nMessage of the Day:\n=====\n%s\n", message)
+}
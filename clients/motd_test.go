@@ -0,0 +1,67 @@
+package clients
+
+import (
+	"bou.ke/monkey"
+	"chat-telnet/interfaces"
+	"chat-telnet/mocks"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Swap in a message of the day read from a temp file for the length of a test, handing back the file's path.
+func useTestMOTD(t *testing.T, message string) string {
+	dir, _ := ioutil.TempDir("", "motd")
+	path := filepath.Join(dir, "motd.txt")
+	ioutil.WriteFile(path, []byte(message), 0600)
+	previous := MessageOfTheDay
+	MessageOfTheDay = &MOTD{Path: path}
+	MessageOfTheDay.Load()
+	t.Cleanup(func() {
+		MessageOfTheDay = previous
+		os.RemoveAll(dir)
+	})
+	return path
+}
+
+func Test_GenerateNewClient_shows_MOTD_after_banner(t *testing.T) {
+	// Kill the listen loop
+	monkey.Patch(Read, func(a interfaces.AbstractBufioReader) (string, error) {
+		return "", io.EOF
+	})
+	defer monkey.Unpatch(Read)
+	useTestMOTD(t, "Maintenance tonight at 10pm.\n\n")
+
+	conn := &mocks.NetConnMock{}
+	err := GenerateNewClient(conn, NewMemoryStore())
+
+	assert.Nil(t, err)
+	intro := string(conn.CalledWith)
+	motdIndex := strings.Index(intro, "\nMessage of the Day:\n=====\nMaintenance tonight at 10pm.\n")
+	assert.Greater(t, motdIndex, strings.Index(intro, Commands.Summary()))
+	assert.Less(t, motdIndex, strings.Index(intro, "NOTE: Your user name"))
+}
+
+func Test_MOTD_Load(t *testing.T) {
+	path := useTestMOTD(t, "  Welcome aboard!  \n")
+	assert.Equal(t, "Welcome aboard!", MessageOfTheDay.Message())
+
+	ioutil.WriteFile(path, []byte("Fresh news."), 0600)
+	assert.Nil(t, MessageOfTheDay.Load())
+	assert.Equal(t, "Fresh news.", MessageOfTheDay.Message())
+
+	// A file that's gone missing leaves the last good message in place.
+	os.Remove(path)
+	err := MessageOfTheDay.Load()
+	assert.Equal(t, fmt.Sprintf("Unable to read MOTD file %s: open %s: no such file or directory", path, path), fmt.Sprint(err))
+	assert.Equal(t, "Fresh news.", MessageOfTheDay.Message())
+}
+
+func Test_MOTD_banner_empty(t *testing.T) {
+	assert.Equal(t, "", (&MOTD{}).banner())
+}
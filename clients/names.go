@@ -0,0 +1,58 @@
+package clients
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NamePolicy is what a user name has to live up to before anyone can take it.  Letters and numbers are always fine,
+//	control characters never are, and anything in between has to be listed in `AllowedPunctuation`.
+type NamePolicy struct {
+	MinLength          int
+	MaxLength          int
+	AllowedPunctuation string
+	Reserved           []string
+}
+
+func DefaultNamePolicy() NamePolicy {
+	return NamePolicy{
+		MinLength:          2,
+		MaxLength:          32,
+		AllowedPunctuation: " -_.'",
+		Reserved:           []string{"server", "admin", "system"},
+	}
+}
+
+// The rules every `\name` is checked against.  The server overrides these from the environment on start up.
+var NameRules = DefaultNamePolicy()
+
+// Check the name against the policy, returning an error explaining what's wrong with it if it doesn't pass.  We
+//	deliberately never repeat a rejected name back, since it could be full of garbage.
+func (p NamePolicy) Validate(name string) error {
+	length := utf8.RuneCountInString(name)
+	if length < p.MinLength {
+		return fmt.Errorf("names must be at least %d characters long", p.MinLength)
+	}
+	if length > p.MaxLength {
+		return fmt.Errorf("names can be at most %d characters long", p.MaxLength)
+	}
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			continue
+		}
+		if unicode.IsControl(r) || !strings.ContainsRune(p.AllowedPunctuation, r) {
+			if p.AllowedPunctuation == "" {
+				return fmt.Errorf("names can only contain letters and numbers")
+			}
+			return fmt.Errorf("names can only contain letters, numbers and any of `%s`", p.AllowedPunctuation)
+		}
+	}
+	for _, reserved := range p.Reserved {
+		if strings.EqualFold(name, reserved) {
+			return fmt.Errorf("that name is reserved")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package clients
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func Test_NamePolicy_Validate(t *testing.T) {
+	p := DefaultNamePolicy()
+
+	var tests = []struct {
+		input         string
+		expectedError string
+	}{
+		{"Han Solo", ""},
+		{"R2-D2", ""},
+		{"Anakin_Skywalker.jr", ""},
+		{"Padmé", ""},
+		{"C", "names must be at least 2 characters long"},
+		{strings.Repeat("Jar Jar ", 1280), "names can be at most 32 characters long"},
+		{"Boba\x1b[31mFett", "names can only contain letters, numbers and any of ` -_.'`"},
+		{"Greedo!", "names can only contain letters, numbers and any of ` -_.'`"},
+		{"Han\tSolo", "names can only contain letters, numbers and any of ` -_.'`"},
+		{"SERVER", "that name is reserved"},
+		{"admin", "that name is reserved"},
+	}
+
+	for _, tt := range tests {
+		err := p.Validate(tt.input)
+		if tt.expectedError == "" {
+			assert.Nil(t, err, tt.input)
+		} else {
+			assert.Equal(t, tt.expectedError, fmt.Sprint(err))
+		}
+	}
+}
+
+func Test_NamePolicy_Validate_custom_rules(t *testing.T) {
+	p := NamePolicy{MinLength: 4, MaxLength: 8, AllowedPunctuation: "", Reserved: []string{"vader"}}
+
+	assert.Nil(t, p.Validate("Yoda"))
+	assert.Equal(t, "names can only contain letters and numbers", fmt.Sprint(p.Validate("Mace W")))
+	assert.Equal(t, "names can be at most 8 characters long", fmt.Sprint(p.Validate("Palpatine")))
+	assert.Equal(t, "that name is reserved", fmt.Sprint(p.Validate("Vader")))
+	assert.Nil(t, p.Validate("admin"))
+}
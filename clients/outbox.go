@@ -0,0 +1,131 @@
+package clients
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// QueuePolicy decides what happens when a client isn't reading fast enough to keep up with what's being sent to them,
+//	and their outbound queue fills up.
+type QueuePolicy string
+
+const (
+	// Throw away the oldest message still waiting to make room for the new one - the client misses a few messages,
+	//	but everything else carries on.
+	DropOldest QueuePolicy = "drop-oldest"
+	// Hang up on the client, who can always reconnect once they've caught up with themselves.
+	DisconnectSlow QueuePolicy = "disconnect"
+)
+
+// How many messages each client can have waiting to go out, and what to do once there are that many.
+var OutboundQueueSize = 256
+var OutboundQueuePolicy = DropOldest
+
+// How long a client's queue gets to empty out once they've gone, before we hang up regardless.
+var OUTBOX_DRAIN_TIMEOUT = 5 * time.Second
+
+var ErrQueueFull = errors.New("outbound queue full")
+var errQueueClosed = errors.New("outbound queue closed")
+
+func ParseQueuePolicy(value string) (QueuePolicy, error) {
+	for _, policy := range []QueuePolicy{DropOldest, DisconnectSlow} {
+		if QueuePolicy(value) == policy {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("must be one of: %s, %s", DropOldest, DisconnectSlow)
+}
+
+// outbox holds everything waiting to be written to a client, in the order it was sent.  Anyone can push to it without
+//	ever waiting on the client's connection, and a single go routine per client (`sendQueued`) does the writing.
+type outbox struct {
+	mu       sync.Mutex
+	messages chan string
+	policy   QueuePolicy
+	closed   bool
+	dropped  int64
+}
+
+func newOutbox(size int, policy QueuePolicy) *outbox {
+	if size < 1 {
+		size = 1
+	}
+	return &outbox{messages: make(chan string, size), policy: policy}
+}
+
+// Queue the message up, never blocking.  If the queue is full this either makes room by dropping the oldest message,
+//	or answers `ErrQueueFull` so the client can be cut off, depending on the policy.
+func (o *outbox) push(msg string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return errQueueClosed
+	}
+	select {
+	case o.messages <- msg:
+		return nil
+	default:
+	}
+	if o.policy == DisconnectSlow {
+		return ErrQueueFull
+	}
+	// Only `sendQueued` takes messages out while we hold the lock, so once one is dropped there's always room.
+	select {
+	case <-o.messages:
+		atomic.AddInt64(&o.dropped, 1)
+	default:
+	}
+	o.messages <- msg
+	return nil
+}
+
+// Stop taking messages.  Anything already queued is still handed to `sendQueued`, which stops once it's all gone.
+func (o *outbox) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.closed {
+		o.closed = true
+		close(o.messages)
+	}
+}
+
+// Write everything queued for the client out to their connection, in order, until the queue is closed, and then hang
+//	up.  Once a write fails the connection is no good, so it's closed straight away (which takes the client out through
+//	`listen`) and the rest of the queue is thrown away.
+func (c *Client) sendQueued() {
+	failed := false
+	for msg := range c.outbox.messages {
+		if failed {
+			continue
+		}
+		_, err := c.Writer.Write([]byte(msg))
+		if err != nil {
+			log.Printf("Unable to write to %s, disconnecting: %v\n", c.UserName(), err)
+			c.Conn.Close()
+			failed = true
+		}
+	}
+	if !failed {
+		c.Conn.Close()
+	}
+}
+
+// How many messages are waiting to go out to the client, for keeping an eye on anyone falling behind.
+func (c *Client) QueueDepth() int {
+	if c.outbox == nil {
+		return 0
+	}
+	return len(c.outbox.messages)
+}
+
+// How many messages the client has missed because their queue was full.
+func (c *Client) DroppedMessages() int64 {
+	if c.outbox == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&c.outbox.dropped)
+}
@@ -0,0 +1,104 @@
+package clients
+
+import (
+	"chat-telnet/mocks"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Drain everything left in the outbox, in order.
+func queued(o *outbox) []string {
+	o.close()
+	messages := []string{}
+	for msg := range o.messages {
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func Test_outbox_drop_oldest(t *testing.T) {
+	o := newOutbox(2, DropOldest)
+
+	for _, msg := range []string{"one", "two", "three", "four"} {
+		assert.Nil(t, o.push(msg))
+	}
+
+	assert.Equal(t, int64(2), o.dropped)
+	assert.Equal(t, []string{"three", "four"}, queued(o))
+	assert.Equal(t, errQueueClosed, o.push("five"))
+}
+
+func Test_WriteString_disconnects_slow_client(t *testing.T) {
+	conn := &mocks.NetConnMock{}
+	c := &Client{Id: "123", Name: "Han Solo", Conn: conn, Writer: conn, outbox: newOutbox(1, DisconnectSlow)}
+
+	assert.Nil(t, c.WriteString("one"))
+	assert.Equal(t, 1, c.QueueDepth())
+	assert.False(t, conn.CloseCalled)
+
+	assert.Equal(t, ErrQueueFull, c.WriteString("two"))
+	assert.True(t, conn.CloseCalled)
+	assert.Equal(t, []string{"one"}, queued(c.outbox))
+}
+
+func Test_sendQueued_writes_in_order(t *testing.T) {
+	written := []string{}
+	conn := &mocks.NetConnMock{WriteMock: func(p []byte) (int, error) {
+		written = append(written, string(p))
+		return len(p), nil
+	}}
+	c := &Client{Id: "123", Name: "Han Solo", Conn: conn, Writer: conn, outbox: newOutbox(10, DropOldest)}
+	for _, msg := range []string{"one", "two", "three"} {
+		c.WriteString(msg)
+	}
+	c.outbox.close()
+
+	c.sendQueued()
+
+	assert.Equal(t, []string{"one", "two", "three"}, written)
+	assert.Equal(t, 0, c.QueueDepth())
+	// The queue only closes once the client has gone, so there's nothing left to do but hang up.
+	assert.True(t, conn.CloseCalled)
+}
+
+func Test_sendQueued_gives_up_on_a_dead_connection(t *testing.T) {
+	writes := 0
+	conn := &mocks.NetConnMock{WriteMock: func(p []byte) (int, error) {
+		writes++
+		return 0, fmt.Errorf("broken pipe")
+	}}
+	c := &Client{Id: "123", Name: "Han Solo", Conn: conn, Writer: conn, outbox: newOutbox(10, DropOldest)}
+	c.WriteString("one")
+	c.WriteString("two")
+	c.outbox.close()
+
+	c.sendQueued()
+
+	assert.Equal(t, 1, writes)
+	assert.True(t, conn.CloseCalled)
+}
+
+func Test_ParseQueuePolicy(t *testing.T) {
+	var tests = []struct {
+		value          string
+		expectedPolicy QueuePolicy
+		expectedError  string
+	}{
+		{"drop-oldest", DropOldest, "<nil>"},
+		{"disconnect", DisconnectSlow, "<nil>"},
+		{"block", "", "must be one of: drop-oldest, disconnect"},
+	}
+	for _, tt := range tests {
+		policy, err := ParseQueuePolicy(tt.value)
+		assert.Equal(t, tt.expectedPolicy, policy)
+		assert.Equal(t, tt.expectedError, fmt.Sprint(err))
+	}
+}
+
+func Test_QueueDepth_without_outbox(t *testing.T) {
+	c := &Client{Id: "123", Name: "Han Solo", Writer: &mocks.IoWriterMock{}}
+
+	assert.Equal(t, 0, c.QueueDepth())
+	assert.Equal(t, int64(0), c.DroppedMessages())
+}
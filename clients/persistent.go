@@ -0,0 +1,105 @@
+package clients
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// RoomConfig is one room in the rooms file, ex.
+//	`{"name": "lobby", "topic": "Say hi!", "owner": "Admiral", "mode": "password", "password": "kessel-run"}`.
+//	The owner, moderators and invites are account names, so they only count once someone has logged in to them.
+type RoomConfig struct {
+	Name       string   `json:"name"`
+	Topic      string   `json:"topic"`
+	Owner      string   `json:"owner"`
+	Mode       string   `json:"mode"`
+	Password   string   `json:"password"`
+	Moderators []string `json:"moderators"`
+	Invites    []string `json:"invites"`
+}
+
+// Build the settings for a room from the config, which is always persistent.
+func (rc RoomConfig) moderation() (RoomModeration, error) {
+	mode := PublicRoom
+	if rc.Mode != "" {
+		var found bool
+		mode, found = parseRoomMode(rc.Mode)
+		if !found {
+			return RoomModeration{}, fmt.Errorf("mode must be one of: %s", roomModeNames())
+		}
+	}
+	access, err := newRoomAccess(mode, rc.Password)
+	if err != nil {
+		return RoomModeration{}, err
+	}
+	access.Invites = accountMembers(rc.Invites)
+	moderation := RoomModeration{
+		RoomAccess: access,
+		Moderators: accountMembers(rc.Moderators),
+		Persistent: true,
+		Topic:      rc.Topic,
+	}
+	if rc.Owner != "" {
+		moderation.Owner = Member{Account: rc.Owner, Name: rc.Owner}
+	}
+	return moderation, nil
+}
+
+func accountMembers(names []string) []Member {
+	members := []Member{}
+	for _, name := range names {
+		members = append(members, Member{Account: name, Name: name})
+	}
+	return members
+}
+
+// Seed the store with every room in the rooms file, a JSON list of `RoomConfig`s.  They're all persistent, so they
+//	show up in `\list-rooms` from the moment the server starts, even with nobody in them.
+func LoadRooms(path string, store ChatStore) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Unable to read rooms file %s: %v", path, err)
+	}
+	configs := []RoomConfig{}
+	err = json.Unmarshal(data, &configs)
+	if err != nil {
+		return fmt.Errorf("Unable to read rooms file %s: %v", path, err)
+	}
+	for _, rc := range configs {
+		if strings.TrimSpace(rc.Name) == "" {
+			return fmt.Errorf("Invalid room in rooms file %s - every room needs a name", path)
+		}
+		moderation, err := rc.moderation()
+		if err == nil {
+			err = store.SeedRoom(rc.Name, moderation)
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid room `%s` in rooms file %s - %v", rc.Name, path, err)
+		}
+	}
+	return nil
+}
+
+// Keep the room around once everyone has left, or let it close like any other.  This only lasts until the server
+//	restarts - for good, add the room to the rooms file.
+func (c *Client) setPersistent(value string) Response {
+	persistent := false
+	switch strings.ToLower(value) {
+	case "on":
+		persistent = true
+	case "off":
+	default:
+		return failure("Invalid value - usage: `\\room-persist <on|off>`")
+	}
+	roomName := c.ActiveRoom()
+	c.Store.UpdateModeration(roomName, func(moderation *RoomModeration) error {
+		moderation.Persistent = persistent
+		return nil
+	})
+	if persistent {
+		return announce(roomName, eventNotice, fmt.Sprintf("%s will stay open once everyone has left.", roomName))
+	}
+	return announce(roomName, eventNotice, fmt.Sprintf("%s will close once everyone has left.", roomName))
+}
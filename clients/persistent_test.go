@@ -0,0 +1,108 @@
+package clients
+
+import (
+	"chat-telnet/mocks"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeRoomsFile(t *testing.T, contents string) string {
+	dir, _ := ioutil.TempDir("", "rooms")
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "rooms.json")
+	ioutil.WriteFile(path, []byte(contents), 0600)
+	return path
+}
+
+func Test_LoadRooms_success(t *testing.T) {
+	useFastHashing(t)
+	path := writeRoomsFile(t, `[
+		{"name": "lobby", "topic": "Say hi!", "owner": "Admiral", "moderators": ["Han Solo"]},
+		{"name": "den", "mode": "password", "password": "kessel-run"},
+		{"name": "palace", "mode": "invite-only", "invites": ["Boba Fett"]}
+	]`)
+	store := NewMemoryStore()
+
+	err := LoadRooms(path, store)
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]*Client{"lobby": {}, "den": {}, "palace": {}}, store.ListRooms())
+	lobby, _ := store.Moderation("lobby")
+	assert.True(t, lobby.Persistent)
+	assert.Equal(t, "Say hi!", lobby.Topic)
+	assert.True(t, lobby.IsOwner(&Client{Id: "123", Account: "admiral"}))
+	assert.True(t, lobby.IsModerator(&Client{Id: "456", Account: "Han Solo"}))
+	assert.False(t, lobby.CanModerate(&Client{Id: "789"}))
+	palace, _ := store.Moderation("palace")
+	assert.True(t, palace.Invited(&Client{Id: "789", Account: "Boba Fett"}))
+	den, _ := store.Moderation("den")
+	_, allowed := (&Client{Id: "789"}).canEnter("den", den, "kessel-run")
+	assert.True(t, allowed)
+}
+
+func Test_LoadRooms_errors(t *testing.T) {
+	var tests = []struct {
+		contents string
+		expected string
+	}{
+		{`{"name": "lobby"}`, "Unable to read rooms file %s: json: cannot unmarshal object into Go value of type []clients.RoomConfig"},
+		{`[{"topic": "Nameless"}]`, "Invalid room in rooms file %s - every room needs a name"},
+		{`[{"name": "lobby", "mode": "secret"}]`, "Invalid room `lobby` in rooms file %s - mode must be one of: public, unlisted, password, invite-only"},
+		{`[{"name": "den", "mode": "password"}]`, "Invalid room `den` in rooms file %s - password rooms need a password, with no spaces in it"},
+		{`[{"name": "lobby"}, {"name": "lobby"}]`, "Invalid room `lobby` in rooms file %s - room already exists"},
+	}
+	for _, tt := range tests {
+		path := writeRoomsFile(t, tt.contents)
+		err := LoadRooms(path, NewMemoryStore())
+		assert.Equal(t, fmt.Sprintf(tt.expected, path), fmt.Sprint(err), tt.contents)
+	}
+}
+
+func Test_persistent_room_survives_everyone_leaving(t *testing.T) {
+	store := NewMemoryStore()
+	store.SeedRoom("lobby", RoomModeration{Persistent: true, Topic: "Say hi!"})
+	c := &Client{Id: "123", Name: "Han Solo", Writer: &mocks.IoWriterMock{}, Store: store}
+	store.AddClient(c)
+
+	response := c.listRooms().Payload
+	assert.Equal(t, "\nCurrent rooms: \n  Room: lobby\n  Topic: Say hi!\n  Members:\n", response)
+
+	c.joinRoom("lobby")
+	c.leaveRoom("lobby")
+
+	members, found := store.MembersOf("lobby")
+	assert.True(t, found)
+	assert.Equal(t, []*Client{}, members)
+	response = c.createRoom("lobby").Payload
+	assert.Equal(t, "Room already exists - use `\\join` to join the chat.", response)
+}
+
+func Test_setPersistent(t *testing.T) {
+	owner := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "falcon", Writer: &mocks.IoWriterMock{}}
+	seedStore(owner)
+
+	var tests = []struct {
+		input      string
+		expected   string
+		persistent bool
+	}{
+		{"\\room-persist maybe", "Invalid value - usage: `\\room-persist <on|off>`", false},
+		{"\\room-persist on", "falcon will stay open once everyone has left.", true},
+		{"\\room-persist OFF", "falcon will close once everyone has left.", false},
+	}
+	for _, tt := range tests {
+		response := owner.parseResponse(tt.input).Payload
+		assert.Equal(t, tt.expected, response, tt.input)
+		moderation, _ := owner.Store.Moderation("falcon")
+		assert.Equal(t, tt.persistent, moderation.Persistent, tt.input)
+	}
+
+	owner.parseResponse("\\room-persist on")
+	owner.leaveRoom("falcon")
+	_, found := owner.Store.MembersOf("falcon")
+	assert.True(t, found)
+}
@@ -0,0 +1,38 @@
+package clients
+
+// A renderer turns a response on its way to a client into what their connection speaks, and an empty result means
+//	there's nothing the client needs to see.
+type renderer interface {
+	render(c *Client, sent int64, r Response) string
+}
+
+// Plain text, ex. `1650575628: [cantina] Admiral: Ahoy!`, for telnet, websockets and SSH.
+type textRenderer struct{}
+
+func (textRenderer) render(c *Client, sent int64, r Response) string {
+	return c.formatMessage(sent, r)
+}
+
+// One JSON object per line, for clients that have switched with `\mode json` or connected on the JSON port.
+type jsonRenderer struct{}
+
+func (jsonRenderer) render(c *Client, sent int64, r Response) string {
+	return c.formatJSON(sent, r)
+}
+
+// IRC messages, for clients on the IRC port.
+type ircRenderer struct{}
+
+func (ircRenderer) render(c *Client, sent int64, r Response) string {
+	return c.formatIRC(r)
+}
+
+func (c *Client) renderer() renderer {
+	if c.irc != nil {
+		return ircRenderer{}
+	}
+	if c.speaksJSON() {
+		return jsonRenderer{}
+	}
+	return textRenderer{}
+}
@@ -0,0 +1,124 @@
+package clients
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Audience says who a response is for.
+type Audience int
+
+const (
+	// Just the client who ran the command.
+	ToSelf Audience = iota
+	// Everyone in the room, the client included - the current room, unless the response names another.
+	ToRoom
+	// Another user, with the client told it went out.
+	ToUser
+	// Everyone connected to the server.
+	ToEveryone
+)
+
+// Response is what a command comes back with: who should hear about it, what kind of thing happened (ex.
+//	`eventJoin`, or `eventError` when the command didn't work) and what to tell them.  It's also what each client is
+//	sent once it gets to them, and how it looks then is up to their renderer, not the command.  `Disconnect` means the
+//	client is done with us, so every room they're in is told they've gone (with the payload) once their connection is
+//	removed, instead - on the copies those rooms are sent, it marks the sender as having left the chat altogether.
+type Response struct {
+	Audience   Audience
+	Event      string
+	Room       string // The room it happened in - for `ToRoom`, the current room if it's left empty.
+	User       string // Only for `ToUser`, who it's for.
+	Sender     string // Who it's from, once it's on its way to a client - empty for the client's own.
+	OldName    string // Only for an `eventRename`, who the sender was before.
+	Payload    string
+	Disconnect bool
+	recipient  *Client // The client `User` was found as, so it can't go to whoever takes the name in the meantime.
+	// Shared by the copies of a departure or rename sent to each of the sender's rooms, so a client sitting in more
+	//	than one of them can tell it's the same thing happening.  Zero for everything else.
+	id uint64
+}
+
+// The last id handed out by `nextResponseId`.
+var lastResponseId uint64
+
+func nextResponseId() uint64 {
+	return atomic.AddUint64(&lastResponseId, 1)
+}
+
+// Tell the client and nobody else.
+func reply(payload string) Response {
+	return Response{Audience: ToSelf, Event: eventCommandResult, Payload: payload}
+}
+
+// Tell the client, and nobody else, why the command didn't work.
+func failure(payload string) Response {
+	return Response{Audience: ToSelf, Event: eventError, Payload: payload}
+}
+
+// Tell a room about something that happened in it, ex. `eventJoin`.
+func announce(roomName, event, payload string) Response {
+	return Response{Audience: ToRoom, Event: event, Room: roomName, Payload: payload}
+}
+
+// Something from the server, ex. the welcome or word that they've been kicked, sent straight to the client.
+func serverNotice(payload string) Response {
+	return Response{Audience: ToSelf, Event: eventNotice, Sender: SERVER, Payload: payload}
+}
+
+// Let the client go, with every room they're in told they've gone.
+func goodbye(payload string) Response {
+	return Response{Audience: ToRoom, Event: eventLeave, Payload: payload, Disconnect: true}
+}
+
+// Whether the command didn't work.
+func (r Response) failed() bool {
+	return r.Event == eventError
+}
+
+// Anything that happened in a room, like a join, as opposed to something somebody said.
+func (r Response) notice() bool {
+	return r.Event != "" && r.Event != eventMessage
+}
+
+// Send the response to whoever it's for, answering with anything the client still needs telling themselves -
+//	anything said to a room they're in, they hear along with everyone else.
+func (c *Client) deliver(r Response) Response {
+	if r.Payload == "" {
+		return Response{}
+	}
+	if r.Disconnect {
+		c.leaveWith(r.Payload)
+		return Response{}
+	}
+	switch r.Audience {
+	case ToRoom:
+		if r.Room == "" {
+			r.Room = c.ActiveRoom()
+		}
+		if r.Event == "" {
+			r.Event = eventNotice
+		}
+		c.broadcastResponse(r)
+		return Response{}
+	case ToUser:
+		recipient := r.recipient
+		if recipient == nil {
+			found, ok := c.Store.FindClientByName(r.User)
+			if !ok {
+				return failure(fmt.Sprintf("%s isn't online.", r.User))
+			}
+			recipient = found
+		}
+		recipient.WriteResponse(Response{
+			Audience: ToUser, Event: eventDirect, User: r.User, Sender: c.UserName(), Payload: r.Payload,
+		})
+		return reply(fmt.Sprintf("[DM to %s] %s", r.User, r.Payload))
+	case ToEveryone:
+		for _, client := range c.Store.ListClients() {
+			client.WriteResponse(Response{Audience: ToEveryone, Event: r.Event, Sender: c.UserName(), Payload: r.Payload})
+		}
+		return Response{}
+	}
+	return r
+}
@@ -0,0 +1,63 @@
+package clients
+
+import (
+	"chat-telnet/mocks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_deliver(t *testing.T) {
+	han, hanOut := newJSONClient("Han Solo")
+	han.CurrentRoom = "falcon"
+	chewie, chewieOut := newJSONClient("Chewbacca")
+	chewie.CurrentRoom = "falcon"
+	lando, landoOut := newJSONClient("Lando")
+	seedStore(han, chewie, lando)
+
+	assert.Equal(t, reply("Punch it"), han.deliver(reply("Punch it")))
+	assert.Equal(t, failure("No such room!"), han.deliver(failure("No such room!")))
+	assert.Empty(t, readEvents(t, hanOut))
+
+	assert.Equal(t, Response{}, han.deliver(announce("", eventNotice, "Han Solo set the course")))
+	expected := []jsonEvent{{Type: eventNotice, Room: "falcon", Sender: "Han Solo", Text: "Han Solo set the course"}}
+	assert.Equal(t, expected, readEvents(t, hanOut))
+	assert.Equal(t, expected, readEvents(t, chewieOut))
+	assert.Empty(t, readEvents(t, landoOut))
+
+	// A response can name a room other than the current one.
+	useTestHistory(t)
+	han.Store.CreateRoom("cloud city", lando, RoomAccess{})
+	han.Store.JoinRoom("cloud city", han)
+	han.deliver(announce("cloud city", eventMessage, "Hello, old buddy"))
+	expected = []jsonEvent{{Type: eventMessage, Room: "cloud city", Sender: "Han Solo", Text: "Hello, old buddy"}}
+	assert.Equal(t, expected, readEvents(t, landoOut))
+	assert.Empty(t, readEvents(t, chewieOut))
+	readEvents(t, hanOut)
+
+	own := han.deliver(Response{Audience: ToUser, Event: eventDirect, User: "Lando", Payload: "You owe me"})
+	assert.Equal(t, reply("[DM to Lando] You owe me"), own)
+	assert.Equal(t, []jsonEvent{{Type: eventDirect, Sender: "Han Solo", Text: "You owe me"}}, readEvents(t, landoOut))
+	own = han.deliver(Response{Audience: ToUser, User: "Greedo", Payload: "Over my dead body"})
+	assert.Equal(t, failure("Greedo isn't online."), own)
+
+	han.deliver(Response{Audience: ToEveryone, Event: eventNotice, Payload: "Jumping to lightspeed"})
+	for _, out := range []interface{ String() string }{hanOut, chewieOut, landoOut} {
+		assert.Contains(t, out.String(), "Jumping to lightspeed")
+	}
+	readEvents(t, hanOut)
+	readEvents(t, chewieOut)
+
+	assert.Equal(t, Response{}, han.deliver(goodbye("Han Solo has gone offline")))
+	assert.Empty(t, chewieOut.String(), "the room hears once the connection is removed, not before")
+	han.Conn = &mocks.NetConnMock{}
+	han.removeConnection()
+	assert.Equal(t, []jsonEvent{
+		{Type: eventLeave, Room: "falcon", Sender: "Han Solo", Text: "Han Solo has gone offline"},
+	}, readEvents(t, chewieOut))
+}
+
+func Test_Response_failed(t *testing.T) {
+	assert.True(t, failure("Room already exists - use `\\join` to join the chat.").failed())
+	assert.False(t, reply("New room created: falcon").failed())
+	assert.False(t, announce("falcon", eventJoin, "Chewbacca has entered: falcon").failed())
+}
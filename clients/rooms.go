@@ -0,0 +1,98 @@
+package clients
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Every room the client is in, sorted by name.  `CurrentRoom` is whichever one of these plain messages go to.
+func (c *Client) Rooms() []string {
+	if c.Store == nil {
+		return []string{}
+	}
+	return c.Store.RoomsOf(c)
+}
+
+func (c *Client) inRoom(roomName string) bool {
+	for _, name := range c.Rooms() {
+		if name == roomName {
+			return true
+		}
+	}
+	return false
+}
+
+// Called once the client is out of a room, whether they left or were made to.  If it was the room they were talking
+//	in, they carry on in another one they're still in, if there is one.  A moderator calls this from their own go
+//	routine, so the active room is only swapped if it's still the one they were dropped from - the store is asked
+//	first, since it takes its own lock before any client's.
+func (c *Client) droppedFrom(roomName string) {
+	next := ""
+	if rooms := c.Rooms(); len(rooms) > 0 {
+		next = rooms[0]
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.CurrentRoom == roomName {
+		c.CurrentRoom = next
+	}
+}
+
+// Make the room the one the client talks in, answering false if they turn out not to be in it.  They're only checked
+//	after the switch, so a moderator taking them out of it at the same time either sees the switch and moves them on
+//	in `droppedFrom`, or has already taken them out and we move them on here.
+func (c *Client) talkIn(roomName string) bool {
+	c.setActiveRoom(roomName)
+	if c.inRoom(roomName) {
+		return true
+	}
+	c.droppedFrom(roomName)
+	return false
+}
+
+// Let every room the client is in, other than the active one, know about something they did.
+func (c *Client) broadcastToOtherRooms(r Response) {
+	for _, roomName := range c.Rooms() {
+		if roomName != c.ActiveRoom() {
+			r.Room = roomName
+			c.broadcastResponse(r)
+		}
+	}
+}
+
+// Find which of the client's rooms the value starts with.  Room names can have spaces in them, so, like `\dm`, this
+//	takes the longest room name that matches and hands back everything after it as the rest.
+func (c *Client) splitRoomName(value string) (string, string, bool) {
+	roomName := ""
+	for _, name := range c.Rooms() {
+		if (value == name || strings.HasPrefix(value, name+" ")) && len(name) > len(roomName) {
+			roomName = name
+		}
+	}
+	if roomName == "" {
+		return "", "", false
+	}
+	return roomName, strings.TrimSpace(value[len(roomName):]), true
+}
+
+func (c *Client) switchRoom(roomName string) Response {
+	if !c.inRoom(roomName) || !c.talkIn(roomName) {
+		return failure(fmt.Sprintf("You're not in %s - `\\join` it first.", roomName))
+	}
+	return reply(fmt.Sprintf("You're now talking in %s.", roomName))
+}
+
+// Post a message to one of the client's rooms without switching to it, ex. `\say cantina Anyone seen Greedo?`.
+func (c *Client) say(value string) Response {
+	roomName, message, found := c.splitRoomName(value)
+	if !found {
+		return failure("You're not in that room - usage: `\\say <room name> <message>`")
+	}
+	if message == "" {
+		return failure(fmt.Sprintf("No message given for %s - usage: `\\say <room name> <message>`", roomName))
+	}
+	if notice, muted := c.mutedIn(roomName); muted {
+		return failure(notice)
+	}
+	return announce(roomName, eventMessage, message)
+}
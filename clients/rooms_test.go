@@ -0,0 +1,108 @@
+package clients
+
+import (
+	"bou.ke/monkey"
+	"chat-telnet/mocks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Han is in both the cantina and the falcon, talking in the falcon, with Greedo in the cantina and Chewbacca in the
+//	falcon.
+func seedTwoRooms() (*Client, *mocks.IoWriterMock, *mocks.IoWriterMock) {
+	greedo := &mocks.IoWriterMock{}
+	chewie := &mocks.IoWriterMock{}
+	han := &Client{Id: "123", Name: "Han Solo", CurrentRoom: "cantina", Writer: &mocks.IoWriterMock{}}
+	seedStore(
+		han,
+		&Client{Id: "456", Name: "Greedo", CurrentRoom: "cantina", Writer: greedo},
+		&Client{Id: "789", Name: "Chewbacca", Writer: chewie},
+	)
+	chewbacca, _ := han.Store.FindClientByName("Chewbacca")
+	chewbacca.createRoom("falcon")
+	han.joinRoom("falcon")
+	return han, greedo, chewie
+}
+
+func Test_joinRoom_keeps_other_rooms(t *testing.T) {
+	han, _, _ := seedTwoRooms()
+
+	assert.Equal(t, []string{"cantina", "falcon"}, han.Rooms())
+	assert.Equal(t, "falcon", han.CurrentRoom)
+	response := han.displayClientStats().Payload
+	assert.Equal(t, "\nClient Name: Han Solo\nCurrent Room: falcon\nAll Rooms: cantina, falcon", response)
+}
+
+func Test_switchRoom(t *testing.T) {
+	han, _, _ := seedTwoRooms()
+
+	response := han.parseResponse("\\switch cantina")
+	assert.Equal(t, "You're now talking in cantina.", response.Payload)
+	assert.Equal(t, eventCommandResult, response.Event)
+	assert.Equal(t, "cantina", han.CurrentRoom)
+
+	response = han.parseResponse("\\switch death star")
+	assert.Equal(t, "You're not in death star - `\\join` it first.", response.Payload)
+	assert.Equal(t, "cantina", han.CurrentRoom)
+}
+
+func Test_say_posts_to_another_room(t *testing.T) {
+	monkey.Patch(time.Now, func() time.Time {
+		return time.Date(2022, 04, 20, 11, 00, 00, 00, time.UTC)
+	})
+	defer monkey.Unpatch(time.Now)
+	useTestHistory(t)
+	han, greedo, chewie := seedTwoRooms()
+	chewie.WriteCalled = false
+
+	response := han.say("cantina I'm sure")
+	assert.Equal(t, announce("cantina", eventMessage, "I'm sure"), response)
+	han.deliver(response)
+
+	assert.Equal(t, "1650452400: [cantina] Han Solo: I'm sure\n", string(greedo.WriteCalledWith))
+	assert.False(t, chewie.WriteCalled)
+	assert.Equal(t, "falcon", han.CurrentRoom)
+
+	var tests = []struct {
+		input    string
+		expected string
+	}{
+		{"death star Hello?", "You're not in that room - usage: `\\say <room name> <message>`"},
+		{"cantina", "No message given for cantina - usage: `\\say <room name> <message>`"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, failure(tt.expected), han.say(tt.input), tt.input)
+	}
+}
+
+func Test_leave_named_room_and_fall_back(t *testing.T) {
+	han, _, _ := seedTwoRooms()
+
+	response := han.parseResponse("\\leave cantina").Payload
+	assert.Equal(t, "You have left room cantina", response)
+	assert.Equal(t, []string{"falcon"}, han.Rooms())
+	assert.Equal(t, "falcon", han.CurrentRoom)
+
+	response = han.parseResponse("\\leave cantina").Payload
+	assert.Equal(t, "You're not in cantina.", response)
+
+	// Leaving the room you're talking in moves you on to whatever's left.
+	han.joinRoom("cantina")
+	han.parseResponse("\\leave")
+	assert.Equal(t, "falcon", han.CurrentRoom)
+	han.parseResponse("\\leave")
+	assert.Equal(t, "", han.CurrentRoom)
+	assert.Equal(t, []string{}, han.Rooms())
+}
+
+func Test_kick_only_removes_from_one_room(t *testing.T) {
+	han, _, _ := seedTwoRooms()
+	chewbacca, _ := han.Store.FindClientByName("Chewbacca")
+
+	response := chewbacca.kick("Han Solo").Payload
+
+	assert.Equal(t, "Han Solo was kicked from falcon by Chewbacca.", response)
+	assert.Equal(t, []string{"cantina"}, han.Rooms())
+	assert.Equal(t, "cantina", han.CurrentRoom)
+}
@@ -0,0 +1,57 @@
+package clients
+
+import (
+	"chat-telnet/accounts"
+	"chat-telnet/events"
+	"chat-telnet/interfaces"
+	"fmt"
+	"log"
+)
+
+// Clients connecting over SSH have already proven who they are with their key, so rather than a random nickname they
+//	come in under the name their key is registered to.  The first time a key is seen it's registered to the name they
+//	logged in with (`ssh <name>@host`), provided that name is free.
+func GenerateSSHClient(conn interfaces.AbstractNetConn, store ChatStore, user, fingerprint string) error {
+	log.Printf("Accepting new SSH connection from address %v\n", conn.RemoteAddr().String())
+
+	client := newClient(conn, store)
+	err := addUnderNickname(client)
+	if err != nil {
+		client.Writer.Write([]byte(fmt.Sprintf("ERROR: %s\n", err)))
+		return err
+	}
+
+	client.publish(events.Event{Kind: events.Connect, Address: client.address()})
+	client.greet("\n\n" + client.claimKey(user, fingerprint) + "\n\n")
+	return nil
+}
+
+// Log the client in to the account their key belongs to, registering it first if it's new, and explain how it went.
+func (c *Client) claimKey(user, fingerprint string) string {
+	if name, found := Accounts.FindByKey(fingerprint); found {
+		if c.logInAs(name, "").failed() {
+			return fmt.Sprintf("NOTE: `%s` is already online, so your user name has been set to `%s` for now.", name, c.UserName())
+		}
+		return fmt.Sprintf("You're logged in as `%s` with your SSH key.", name)
+	}
+
+	var reason string
+	if err := NameRules.Validate(user); err != nil {
+		reason = fmt.Sprintf("`%s` isn't a valid name - %v", user, err)
+	} else if _, found := c.Store.FindClientByName(user); found {
+		reason = fmt.Sprintf("`%s` is already taken", user)
+	} else if err := Accounts.RegisterKey(user, fingerprint); err == accounts.ErrAccountExists {
+		reason = fmt.Sprintf("`%s` is already registered", user)
+	} else if err != nil {
+		reason = fmt.Sprintf("`%s` couldn't be registered - %v", user, err)
+	} else {
+		log.Printf("Registered account: %s (SSH key %s)\n", user, fingerprint)
+		if c.logInAs(user, "").failed() {
+			return fmt.Sprintf("NOTE: `%s` is already online, so your user name has been set to `%s` for now.", user, c.UserName())
+		}
+		return fmt.Sprintf("Your SSH key is now registered to `%s` - connect with it again to come back as `%s`.", user, user)
+	}
+	return fmt.Sprintf("NOTE: Your SSH key isn't registered to a name yet, as %s.\n"+
+		"Your user name has been automatically set to `%s` - to register your key, reconnect with `ssh <user name>@<host>`.",
+		reason, c.UserName())
+}
@@ -0,0 +1,72 @@
+package clients
+
+import (
+	"chat-telnet/mocks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_claimKey_registers_new_key(t *testing.T) {
+	accountStore := useTestAccounts(t)
+	c := &Client{Id: "123", Name: "guest-1"}
+	seedStore(c)
+
+	note := c.claimKey("Han", "SHA256:falcon")
+
+	assert.Equal(t, "Your SSH key is now registered to `Han` - connect with it again to come back as `Han`.", note)
+	assert.Equal(t, "Han", c.Name)
+	assert.Equal(t, "Han", c.Account)
+	name, _ := accountStore.FindByKey("SHA256:falcon")
+	assert.Equal(t, "Han", name)
+}
+
+func Test_claimKey_known_key(t *testing.T) {
+	accountStore := useTestAccounts(t)
+	accountStore.RegisterKey("Han", "SHA256:falcon")
+	c := &Client{Id: "123", Name: "guest-1"}
+	seedStore(c)
+
+	note := c.claimKey("someone-else", "SHA256:falcon")
+
+	assert.Equal(t, "You're logged in as `Han` with your SSH key.", note)
+	assert.Equal(t, "Han", c.Name)
+	assert.Equal(t, "Han", c.Account)
+	assert.False(t, accountStore.Exists("someone-else"))
+}
+
+func Test_claimKey_known_key_already_online(t *testing.T) {
+	useTestAccounts(t).RegisterKey("Han", "SHA256:falcon")
+	c := &Client{Id: "123", Name: "guest-1"}
+	seedStore(c, &Client{Id: "456", Name: "Han", Writer: &mocks.IoWriterMock{}})
+
+	note := c.claimKey("Han", "SHA256:falcon")
+
+	assert.Equal(t, "NOTE: `Han` is already online, so your user name has been set to `guest-1` for now.", note)
+	assert.Equal(t, "guest-1", c.Name)
+	assert.Equal(t, "", c.Account)
+}
+
+func Test_claimKey_name_unavailable(t *testing.T) {
+	accountStore := useTestAccounts(t)
+	accountStore.Register("Lando", "cloud-city")
+	c := &Client{Id: "123", Name: "guest-1"}
+	seedStore(c, &Client{Id: "456", Name: "Han", Writer: &mocks.IoWriterMock{}})
+
+	var tests = []struct {
+		user           string
+		expectedReason string
+	}{
+		{"Lando", "`Lando` is already registered"},
+		{"han", "`han` is already taken"},
+		{"Han!", "`Han!` isn't a valid name - "},
+	}
+	for _, tt := range tests {
+		note := c.claimKey(tt.user, "SHA256:falcon")
+
+		assert.Contains(t, note, "NOTE: Your SSH key isn't registered to a name yet, as "+tt.expectedReason)
+		assert.Contains(t, note, "Your user name has been automatically set to `guest-1`")
+		assert.Equal(t, "guest-1", c.Name)
+	}
+	_, found := accountStore.FindByKey("SHA256:falcon")
+	assert.False(t, found)
+}
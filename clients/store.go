@@ -0,0 +1,259 @@
+package clients
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoSuchRoom = errors.New("no such room")
+var ErrRoomExists = errors.New("room already exists")
+var ErrAlreadyInRoom = errors.New("already in room")
+var ErrNameTaken = errors.New("name already taken")
+var ErrBanned = errors.New("banned from room")
+var ErrNotOpen = errors.New("room needs a password or an invite")
+
+// ChatStore holds all the shared chat state - who is connected and who is in what room.  Every method here is a
+//	single atomic operation, so clients can hammer it from their own go routines without stepping on each other's
+//	updates.  The lists and maps handed back are copies, safe to range over while the store keeps changing underneath
+//	them, but the clients in them are shared - read their names and rooms with `UserName` and `ActiveRoom`.
+type ChatStore interface {
+	AddClient(client *Client) error
+	RemoveClient(client *Client)
+	ListClients() []*Client
+	FindClientByName(name string) (*Client, bool)
+	RenameClient(client *Client, name string) error
+	CreateRoom(roomName string, client *Client, access RoomAccess) error
+	// Set up a room with nobody in it yet, ex. a persistent room from the config file.
+	SeedRoom(roomName string, moderation RoomModeration) error
+	JoinRoom(roomName string, client *Client) error
+	LeaveRoom(roomName string, client *Client) error
+	MembersOf(roomName string) ([]*Client, bool)
+	RoomsOf(client *Client) []string
+	ListRooms() map[string][]*Client
+	Moderation(roomName string) (RoomModeration, bool)
+	// Change a room's moderation in one go - `update` is run under the store's lock, so it must not call back into
+	//	the store.  Whatever error `update` returns is handed straight back, and nothing it changed is kept.
+	UpdateModeration(roomName string, update func(moderation *RoomModeration) error) error
+}
+
+// MemoryStore is the default ChatStore, keeping everything in maps behind a single lock.
+// TODO - explore a cache like redis or BadgerDB?
+type MemoryStore struct {
+	mu         sync.RWMutex
+	clients    map[string]*Client
+	rooms      map[string][]*Client
+	moderation map[string]RoomModeration
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		clients:    map[string]*Client{},
+		rooms:      map[string][]*Client{},
+		moderation: map[string]RoomModeration{},
+	}
+}
+
+// Add the client, as long as nobody else already has their name - checked in the same step, ignoring case like
+//	`RenameClient`, so two clients can't both make it in under the same one.
+func (s *MemoryStore) AddClient(client *Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// If somehow we already have this client in the store return and error
+	if s.clients[client.Id] != nil {
+		return fmt.Errorf("User Conflict: %s user already in service. Please try again.", client.UserName())
+	}
+	if _, found := s.findClientByName(client.UserName()); found {
+		return ErrNameTaken
+	}
+	s.clients[client.Id] = client
+	return nil
+}
+
+// Drop the client from the store entirely, including any rooms they were still sitting in so nobody keeps writing to
+//	a dead connection.
+func (s *MemoryStore) RemoveClient(client *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, client.Id)
+	for roomName := range s.rooms {
+		s.removeMember(roomName, client)
+	}
+}
+
+func (s *MemoryStore) ListClients() []*Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	clientList := make([]*Client, 0, len(s.clients))
+	for _, client := range s.clients {
+		clientList = append(clientList, client)
+	}
+	return clientList
+}
+
+// Look a client up by name, ignoring case.
+func (s *MemoryStore) FindClientByName(name string) (*Client, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.findClientByName(name)
+}
+
+// Give the client a new name, as long as nobody else already has it.  This ignores case, so nobody can pass
+//	themselves off as someone else with a capital letter or two.
+func (s *MemoryStore) RenameClient(client *Client, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if other, found := s.findClientByName(name); found && other != client {
+		return ErrNameTaken
+	}
+	client.setName(name)
+	return nil
+}
+
+// Create a new room with the given client as its only member, and its owner.  The room's access is set up in the same
+//	step, so a private room is never open to anyone, even for a moment.
+func (s *MemoryStore) CreateRoom(roomName string, client *Client, access RoomAccess) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.rooms[roomName]; found {
+		return ErrRoomExists
+	}
+	s.rooms[roomName] = []*Client{client}
+	s.moderation[roomName] = RoomModeration{RoomAccess: access, Owner: MemberOf(client)}
+	return nil
+}
+
+func (s *MemoryStore) SeedRoom(roomName string, moderation RoomModeration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.rooms[roomName]; found {
+		return ErrRoomExists
+	}
+	s.rooms[roomName] = []*Client{}
+	s.moderation[roomName] = moderation.copy()
+	return nil
+}
+
+func (s *MemoryStore) JoinRoom(roomName string, client *Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	room, found := s.rooms[roomName]
+	if !found {
+		return ErrNoSuchRoom
+	}
+	for _, member := range room {
+		if member == client {
+			return ErrAlreadyInRoom
+		}
+	}
+	if _, banned := s.moderation[roomName].ActiveBan(client, time.Now()); banned {
+		return ErrBanned
+	}
+	s.rooms[roomName] = append(room, client)
+	return nil
+}
+
+// Take the client out of the room, deleting the room if they were the last one in it (unless it's persistent).
+func (s *MemoryStore) LeaveRoom(roomName string, client *Client) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.rooms[roomName]; !found {
+		return ErrNoSuchRoom
+	}
+	s.removeMember(roomName, client)
+	return nil
+}
+
+// Return a copy of the room's members and a bool indicating whether or not the room exists.
+func (s *MemoryStore) MembersOf(roomName string) ([]*Client, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	room, found := s.rooms[roomName]
+	if !found {
+		return nil, false
+	}
+	return append([]*Client{}, room...), true
+}
+
+// Every room the client is a member of, sorted by name.
+func (s *MemoryStore) RoomsOf(client *Client) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	roomNames := []string{}
+	for roomName, room := range s.rooms {
+		for _, member := range room {
+			if member == client {
+				roomNames = append(roomNames, roomName)
+				break
+			}
+		}
+	}
+	sort.Strings(roomNames)
+	return roomNames
+}
+
+func (s *MemoryStore) ListRooms() map[string][]*Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rooms := make(map[string][]*Client, len(s.rooms))
+	for roomName, room := range s.rooms {
+		rooms[roomName] = append([]*Client{}, room...)
+	}
+	return rooms
+}
+
+// Return a copy of who owns, moderates, is banned from and is muted in the room, and whether or not it exists.
+func (s *MemoryStore) Moderation(roomName string) (RoomModeration, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, found := s.rooms[roomName]; !found {
+		return RoomModeration{}, false
+	}
+	return s.moderation[roomName].copy(), true
+}
+
+func (s *MemoryStore) UpdateModeration(roomName string, update func(moderation *RoomModeration) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, found := s.rooms[roomName]; !found {
+		return ErrNoSuchRoom
+	}
+	moderation := s.moderation[roomName].copy()
+	err := update(&moderation)
+	if err != nil {
+		return err
+	}
+	s.moderation[roomName] = moderation
+	return nil
+}
+
+// Callers must hold the lock.
+func (s *MemoryStore) findClientByName(name string) (*Client, bool) {
+	for _, client := range s.clients {
+		if strings.EqualFold(client.UserName(), name) {
+			return client, true
+		}
+	}
+	return nil, false
+}
+
+// Re-create the list of clients in the given room, minus the one that's leaving.  Callers must hold the lock.
+func (s *MemoryStore) removeMember(roomName string, client *Client) {
+	prunedList := []*Client{}
+	for _, member := range s.rooms[roomName] {
+		if member != client {
+			prunedList = append(prunedList, member)
+		}
+	}
+	// If the room no longer has anyone in it after this user has been removed then delete it, unless it's meant to
+	//	stick around.
+	if len(prunedList) == 0 && !s.moderation[roomName].Persistent {
+		delete(s.rooms, roomName)
+		delete(s.moderation, roomName)
+	} else {
+		s.rooms[roomName] = prunedList
+	}
+}
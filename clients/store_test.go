@@ -0,0 +1,371 @@
+package clients
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func Test_MemoryStore_AddClient_success(t *testing.T) {
+	s := NewMemoryStore()
+	c := &Client{Id: "123", Name: "Han Solo"}
+
+	err := s.AddClient(c)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []*Client{c}, s.ListClients())
+}
+
+func Test_MemoryStore_AddClient_client_already_in_store(t *testing.T) {
+	s := NewMemoryStore()
+	c := &Client{Id: "123", Name: "Han Solo"}
+	s.AddClient(c)
+
+	err := s.AddClient(&Client{Id: "123", Name: "Lando Calrissian"})
+
+	assert.Equal(t, "User Conflict: Lando Calrissian user already in service. Please try again.", fmt.Sprint(err))
+	assert.Equal(t, []*Client{c}, s.ListClients())
+}
+
+// Whoever gets there first has the name, however many clients try for it at once.
+func Test_MemoryStore_AddClient_name_taken(t *testing.T) {
+	s := NewMemoryStore()
+	added := make(chan *Client, 10)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := &Client{Id: fmt.Sprint(i), Name: "Han Solo"}
+			if err := s.AddClient(c); err == nil {
+				added <- c
+			} else {
+				assert.Equal(t, ErrNameTaken, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(added)
+
+	assert.Len(t, added, 1)
+	assert.Equal(t, []*Client{<-added}, s.ListClients())
+	assert.Equal(t, ErrNameTaken, s.AddClient(&Client{Id: "456", Name: "han solo"}))
+}
+
+func Test_MemoryStore_RemoveClient_success(t *testing.T) {
+	s := NewMemoryStore()
+	c1 := &Client{Id: "123", Name: "Han Solo"}
+	c2 := &Client{Id: "456", Name: "Chewbacca"}
+	s.AddClient(c1)
+	s.AddClient(c2)
+	s.CreateRoom("broom", c1, RoomAccess{})
+	s.JoinRoom("broom", c2)
+	s.CreateRoom("vroom", c1, RoomAccess{})
+
+	s.RemoveClient(c1)
+
+	assert.Equal(t, []*Client{c2}, s.ListClients())
+	assert.Equal(t, map[string][]*Client{"broom": {c2}}, s.ListRooms())
+}
+
+func Test_MemoryStore_RemoveClient_not_in_store(t *testing.T) {
+	s := NewMemoryStore()
+	c := &Client{Id: "123", Name: "Han Solo"}
+	s.AddClient(c)
+
+	s.RemoveClient(&Client{Id: "456", Name: "Chewbacca"})
+
+	assert.Equal(t, []*Client{c}, s.ListClients())
+}
+
+func Test_MemoryStore_FindClientByName_ignores_case(t *testing.T) {
+	s := NewMemoryStore()
+	c := &Client{Id: "123", Name: "Han Solo"}
+	s.AddClient(c)
+
+	found, ok := s.FindClientByName("HAN SOLO")
+	_, notOk := s.FindClientByName("Han")
+
+	assert.True(t, ok)
+	assert.Equal(t, c, found)
+	assert.False(t, notOk)
+}
+
+func Test_MemoryStore_RenameClient_success(t *testing.T) {
+	s := NewMemoryStore()
+	c := &Client{Id: "123", Name: "Han Solo"}
+	s.AddClient(c)
+
+	err := s.RenameClient(c, "Captain Solo")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Captain Solo", c.Name)
+}
+
+func Test_MemoryStore_RenameClient_own_name_different_case(t *testing.T) {
+	s := NewMemoryStore()
+	c := &Client{Id: "123", Name: "Han Solo"}
+	s.AddClient(c)
+
+	err := s.RenameClient(c, "HAN SOLO")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "HAN SOLO", c.Name)
+}
+
+func Test_MemoryStore_RenameClient_name_taken(t *testing.T) {
+	s := NewMemoryStore()
+	c1 := &Client{Id: "123", Name: "Han Solo"}
+	c2 := &Client{Id: "456", Name: "Chewbacca"}
+	s.AddClient(c1)
+	s.AddClient(c2)
+
+	err := s.RenameClient(c2, "han solo")
+
+	assert.Equal(t, ErrNameTaken, err)
+	assert.Equal(t, "Chewbacca", c2.Name)
+}
+
+func Test_MemoryStore_RenameClient_concurrent_claims(t *testing.T) {
+	s := NewMemoryStore()
+	clientCount := 100
+	clientList := []*Client{}
+	for i := 0; i < clientCount; i++ {
+		c := &Client{Id: fmt.Sprint(i), Name: fmt.Sprint(i)}
+		s.AddClient(c)
+		clientList = append(clientList, c)
+	}
+
+	wins := make(chan *Client, clientCount)
+	wg := sync.WaitGroup{}
+	for _, c := range clientList {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			if s.RenameClient(c, "Luke Skywalker") == nil {
+				wins <- c
+			}
+		}(c)
+	}
+	wg.Wait()
+	close(wins)
+
+	assert.Len(t, wins, 1)
+}
+
+func Test_MemoryStore_CreateRoom_success(t *testing.T) {
+	s := NewMemoryStore()
+	c := &Client{Id: "123", Name: "Han Solo"}
+
+	err := s.CreateRoom("broom", c, RoomAccess{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]*Client{"broom": {c}}, s.ListRooms())
+}
+
+func Test_MemoryStore_CreateRoom_room_already_exists(t *testing.T) {
+	s := NewMemoryStore()
+	c1 := &Client{Id: "123", Name: "Han Solo"}
+	c2 := &Client{Id: "456", Name: "Chewbacca"}
+	s.CreateRoom("broom", c1, RoomAccess{})
+
+	err := s.CreateRoom("broom", c2, RoomAccess{})
+
+	assert.Equal(t, ErrRoomExists, err)
+	assert.Equal(t, map[string][]*Client{"broom": {c1}}, s.ListRooms())
+}
+
+func Test_MemoryStore_JoinRoom_success(t *testing.T) {
+	s := NewMemoryStore()
+	c1 := &Client{Id: "123", Name: "Han Solo"}
+	c2 := &Client{Id: "456", Name: "Chewbacca"}
+	s.CreateRoom("broom", c1, RoomAccess{})
+
+	err := s.JoinRoom("broom", c2)
+
+	assert.Nil(t, err)
+	room, found := s.MembersOf("broom")
+	assert.True(t, found)
+	assert.Equal(t, []*Client{c1, c2}, room)
+}
+
+func Test_MemoryStore_JoinRoom_no_such_room(t *testing.T) {
+	s := NewMemoryStore()
+
+	err := s.JoinRoom("broom", &Client{Id: "123", Name: "Han Solo"})
+
+	assert.Equal(t, ErrNoSuchRoom, err)
+	assert.Empty(t, s.ListRooms())
+}
+
+func Test_MemoryStore_JoinRoom_already_in_room(t *testing.T) {
+	s := NewMemoryStore()
+	c := &Client{Id: "123", Name: "Han Solo"}
+	s.CreateRoom("broom", c, RoomAccess{})
+
+	err := s.JoinRoom("broom", c)
+
+	assert.Equal(t, ErrAlreadyInRoom, err)
+	room, _ := s.MembersOf("broom")
+	assert.Equal(t, []*Client{c}, room)
+}
+
+func Test_MemoryStore_LeaveRoom_success(t *testing.T) {
+	s := NewMemoryStore()
+	c1 := &Client{Id: "123", Name: "Han Solo"}
+	c2 := &Client{Id: "456", Name: "Chewbacca"}
+	s.CreateRoom("broom", c1, RoomAccess{})
+	s.JoinRoom("broom", c2)
+
+	err := s.LeaveRoom("broom", c1)
+
+	assert.Nil(t, err)
+	room, _ := s.MembersOf("broom")
+	assert.Equal(t, []*Client{c2}, room)
+}
+
+func Test_MemoryStore_LeaveRoom_last_member_deletes_room(t *testing.T) {
+	s := NewMemoryStore()
+	c := &Client{Id: "123", Name: "Han Solo"}
+	s.CreateRoom("broom", c, RoomAccess{})
+
+	err := s.LeaveRoom("broom", c)
+
+	assert.Nil(t, err)
+	_, found := s.MembersOf("broom")
+	assert.False(t, found)
+}
+
+func Test_MemoryStore_LeaveRoom_no_such_room(t *testing.T) {
+	s := NewMemoryStore()
+
+	err := s.LeaveRoom("broom", &Client{Id: "123", Name: "Han Solo"})
+
+	assert.Equal(t, ErrNoSuchRoom, err)
+}
+
+func Test_MemoryStore_MembersOf_returns_copy(t *testing.T) {
+	s := NewMemoryStore()
+	c1 := &Client{Id: "123", Name: "Han Solo"}
+	c2 := &Client{Id: "456", Name: "Chewbacca"}
+	s.CreateRoom("broom", c1, RoomAccess{})
+
+	room, _ := s.MembersOf("broom")
+	room[0] = c2
+	rooms := s.ListRooms()
+	rooms["broom"][0] = c2
+
+	room, _ = s.MembersOf("broom")
+	assert.Equal(t, []*Client{c1}, room)
+}
+
+func Test_MemoryStore_RoomsOf_sorted(t *testing.T) {
+	s := NewMemoryStore()
+	c1 := &Client{Id: "123", Name: "Han Solo"}
+	c2 := &Client{Id: "456", Name: "Chewbacca"}
+	s.CreateRoom("vroom", c1, RoomAccess{})
+	s.CreateRoom("broom", c2, RoomAccess{})
+	s.JoinRoom("broom", c1)
+	s.CreateRoom("mushroom", c2, RoomAccess{})
+
+	assert.Equal(t, []string{"broom", "vroom"}, s.RoomsOf(c1))
+	assert.Equal(t, []string{"broom", "mushroom"}, s.RoomsOf(c2))
+	assert.Equal(t, []string{}, s.RoomsOf(&Client{Id: "789"}))
+}
+
+func Test_MemoryStore_UpdateModeration_error_keeps_nothing(t *testing.T) {
+	s := NewMemoryStore()
+	c := &Client{Id: "123", Name: "Han Solo"}
+	s.CreateRoom("broom", c, RoomAccess{})
+
+	err := s.UpdateModeration("broom", func(moderation *RoomModeration) error {
+		moderation.Bans = append(moderation.Bans, Restriction{Member: Member{Name: "Greedo"}})
+		return fmt.Errorf("changed my mind")
+	})
+
+	assert.Equal(t, "changed my mind", fmt.Sprint(err))
+	moderation, _ := s.Moderation("broom")
+	assert.Empty(t, moderation.Bans)
+	assert.Equal(t, ErrNoSuchRoom, s.UpdateModeration("vroom", func(moderation *RoomModeration) error { return nil }))
+}
+
+func Test_MemoryStore_empty_room_forgets_moderation(t *testing.T) {
+	s := NewMemoryStore()
+	c1 := &Client{Id: "123", Name: "Han Solo"}
+	c2 := &Client{Id: "456", Name: "Greedo"}
+	s.CreateRoom("broom", c1, RoomAccess{})
+	s.UpdateModeration("broom", func(moderation *RoomModeration) error {
+		moderation.Bans = append(moderation.Bans, Restriction{Member: MemberOf(c2)})
+		return nil
+	})
+
+	s.LeaveRoom("broom", c1)
+	err := s.CreateRoom("broom", c2, RoomAccess{})
+
+	assert.Nil(t, err)
+	moderation, found := s.Moderation("broom")
+	assert.True(t, found)
+	assert.True(t, moderation.IsOwner(c2))
+	assert.Empty(t, moderation.Bans)
+}
+
+// Run with `go test -race` - every client here is hopping in and out of the same few rooms at once, which is
+//	exactly what used to lose updates back when we read, changed and wrote the whole map each time.
+func Test_MemoryStore_concurrent_access(t *testing.T) {
+	s := NewMemoryStore()
+	roomNames := []string{"broom", "vroom", "mushroom"}
+	clientCount := 200
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < clientCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := &Client{Id: fmt.Sprint(i), Name: fmt.Sprint(i)}
+			s.AddClient(c)
+			for j := 0; j < 50; j++ {
+				roomName := roomNames[(i+j)%len(roomNames)]
+				if s.JoinRoom(roomName, c) == ErrNoSuchRoom {
+					s.CreateRoom(roomName, c, RoomAccess{})
+				}
+				// Everyone keeps changing their name while the others are reading them.
+				s.RenameClient(c, fmt.Sprintf("%d-%d", i, j))
+				members, _ := s.MembersOf(roomName)
+				for _, member := range members {
+					member.UserName()
+				}
+				s.FindClientByName(fmt.Sprintf("%d-%d", i+1, j))
+				s.ListRooms()
+				s.ListClients()
+				s.LeaveRoom(roomName, c)
+			}
+			// Everyone finishes sitting in a room, so we can count them all at the end.
+			if s.JoinRoom("broom", c) == ErrNoSuchRoom {
+				if s.CreateRoom("broom", c, RoomAccess{}) == ErrRoomExists {
+					s.JoinRoom("broom", c)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Len(t, s.ListClients(), clientCount)
+	for _, c := range s.ListClients() {
+		assert.True(t, strings.HasSuffix(c.UserName(), "-49"), c.UserName())
+	}
+	room, found := s.MembersOf("broom")
+	assert.True(t, found)
+	assert.Len(t, room, clientCount)
+	assert.Equal(t, []string{"broom"}, roomKeys(s.ListRooms()))
+}
+
+func roomKeys(rooms map[string][]*Client) []string {
+	keys := []string{}
+	for k := range rooms {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,19 @@
+package clients
+
+// How wide to assume a client's terminal is when their connection can't tell us.
+var DEFAULT_TERMINAL_WIDTH = 80
+
+// Connections that know how big the client's terminal is, like telnet once the client has answered `NAWS`.
+type terminalSizer interface {
+	TerminalWidth() int
+}
+
+// How many columns the client has to fit output into, for formatting it to suit.
+func (c *Client) TerminalWidth() int {
+	if conn, ok := c.Conn.(terminalSizer); ok {
+		if width := conn.TerminalWidth(); width > 0 {
+			return width
+		}
+	}
+	return DEFAULT_TERMINAL_WIDTH
+}
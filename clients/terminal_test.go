@@ -0,0 +1,31 @@
+package clients
+
+import (
+	"chat-telnet/mocks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type sizedConnMock struct {
+	mocks.NetConnMock
+	width int
+}
+
+func (m *sizedConnMock) TerminalWidth() int {
+	return m.width
+}
+
+func Test_TerminalWidth(t *testing.T) {
+	var tests = []struct {
+		name     string
+		client   *Client
+		expected int
+	}{
+		{"told us", &Client{Conn: &sizedConnMock{width: 132}}, 132},
+		{"hasn't told us yet", &Client{Conn: &sizedConnMock{}}, DEFAULT_TERMINAL_WIDTH},
+		{"can't tell us", &Client{Conn: &mocks.NetConnMock{}}, DEFAULT_TERMINAL_WIDTH},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, tt.client.TerminalWidth(), tt.name)
+	}
+}
@@ -0,0 +1,38 @@
+package clients
+
+import (
+	"fmt"
+)
+
+// View the topic of the client's room, or change it if they're one of its moderators.
+func (c *Client) topic(value string) Response {
+	roomName := c.ActiveRoom()
+	moderation, found := c.Store.Moderation(roomName)
+	if !found {
+		return failure("You're not in a room - `\\join` one to see its topic.")
+	}
+	if value == "" {
+		if moderation.Topic == "" {
+			return reply(fmt.Sprintf("%s has no topic yet.", roomName))
+		}
+		return reply(fmt.Sprintf("The topic for %s is: %s", roomName, moderation.Topic))
+	}
+	if !moderation.CanModerate(c) {
+		return failure(fmt.Sprintf("Only the owner and moderators of %s can change its topic.", roomName))
+	}
+	c.Store.UpdateModeration(roomName, func(moderation *RoomModeration) error {
+		moderation.Topic = value
+		return nil
+	})
+	return announce(roomName, eventNotice, fmt.Sprintf("%s set the topic for %s: %s", c.UserName(), roomName, value))
+}
+
+// Let someone who has just joined know what the room is for, if it says.
+func (c *Client) showTopic(roomName string) {
+	moderation, found := c.Store.Moderation(roomName)
+	// IRC clients get the topic as part of joining, see `ircJoin`.
+	if !found || moderation.Topic == "" || c.irc != nil {
+		return
+	}
+	c.WriteResponse(serverNotice(fmt.Sprintf("The topic for %s is: %s", roomName, moderation.Topic)))
+}
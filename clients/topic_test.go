@@ -0,0 +1,45 @@
+package clients
+
+import (
+	"chat-telnet/mocks"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_topic(t *testing.T) {
+	owner, moderator, target, _ := seedModeratedRoom()
+	owner.setModerator("Chewbacca", true)
+	outsider := &Client{Id: "000", Name: "Jabba", Writer: &mocks.IoWriterMock{}, Store: owner.Store}
+	owner.Store.AddClient(outsider)
+
+	var tests = []struct {
+		client    *Client
+		input     string
+		expected  string
+		broadcast bool
+	}{
+		{outsider, "\\topic", "You're not in a room - `\\join` one to see its topic.", false},
+		{target, "\\topic", "cantina has no topic yet.", false},
+		{target, "\\topic Greedo shot first", "Only the owner and moderators of cantina can change its topic.", false},
+		{moderator, "\\topic Wretched hive of scum and villainy", "Chewbacca set the topic for cantina: Wretched hive of scum and villainy", true},
+		{target, "\\topic", "The topic for cantina is: Wretched hive of scum and villainy", false},
+	}
+	for _, tt := range tests {
+		response := tt.client.parseResponse(tt.input)
+		assert.Equal(t, tt.expected, response.Payload, tt.input)
+		assert.Equal(t, tt.broadcast, response.Audience == ToRoom, tt.input)
+	}
+}
+
+func Test_joinRoom_shows_topic(t *testing.T) {
+	useTestHistory(t)
+	owner, _, _, _ := seedModeratedRoom()
+	owner.topic("No droids")
+	w := &mocks.IoWriterMock{}
+	newcomer := &Client{Id: "000", Name: "Luke", Writer: w, Store: owner.Store}
+	owner.Store.AddClient(newcomer)
+
+	newcomer.joinRoom("cantina")
+
+	assert.Contains(t, string(w.WriteCalledWith), ": Server: The topic for cantina is: No droids\n")
+}
@@ -0,0 +1,122 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Kind says what happened.
+type Kind string
+
+const (
+	Connect     Kind = "connect"
+	Disconnect  Kind = "disconnect"
+	Join        Kind = "join"
+	Leave       Kind = "leave"
+	Rename      Kind = "rename"
+	RoomCreated Kind = "room_created"
+	// Something somebody said in a room.
+	Message Kind = "message"
+	// Anything else a room hears about, ex. `Han Solo has entered: falcon` or a kick.
+	Notice   Kind = "notice"
+	Shutdown Kind = "shutdown"
+)
+
+// Event is one thing that happened in the chat.  Only the fields that make sense for its kind are set.
+type Event struct {
+	Kind    Kind
+	Time    time.Time
+	User    string // Who did it - after a rename, their new name.
+	OldName string // Only for a `Rename`.
+	Room    string
+	Text    string // What a `Message` or `Notice` said, or why it happened, ex. a kick.
+	Address string // Only for a `Connect` or `Disconnect`, where they connected from.
+}
+
+// Handler is called with every event it subscribed to.
+type Handler func(event Event)
+
+type subscriber struct {
+	id     int
+	kinds  map[Kind]bool // Empty for everything.
+	handle Handler
+}
+
+// Bus hands every event published to it to whoever has subscribed.  Publishers don't need to know who's listening,
+//	or whether anybody is at all.
+type Bus struct {
+	mu          sync.RWMutex
+	nextId      int
+	subscribers []subscriber
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Have the handler called with every event of the given kinds, or every event if it isn't given any.  Call the
+//	function handed back to stop.
+func (b *Bus) Subscribe(handler Handler, kinds ...Kind) func() {
+	sub := subscriber{kinds: map[Kind]bool{}, handle: handler}
+	for _, kind := range kinds {
+		sub.kinds[kind] = true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextId++
+	sub.id = b.nextId
+	b.subscribers = append(b.subscribers, sub)
+	return func() { b.unsubscribe(sub.id) }
+}
+
+func (b *Bus) unsubscribe(id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, sub := range b.subscribers {
+		if sub.id == id {
+			b.subscribers = append(b.subscribers[:i:i], b.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Hand the event to each subscriber in turn, in the order they subscribed, stamping it with the time if the
+//	publisher didn't.  Everything happens before `Publish` returns, so anything slow (ex. a webhook) should hand the
+//	event off to a goroutine of its own rather than hold up the chat.
+func (b *Bus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	// Handlers are called without the lock held, so they're free to publish or (un)subscribe themselves.
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+	for _, sub := range subscribers {
+		if len(sub.kinds) == 0 || sub.kinds[event.Kind] {
+			sub.handle(event)
+		}
+	}
+}
+
+// Log is a Handler that writes a line about each event to the server log.
+func Log(event Event) {
+	switch event.Kind {
+	case Connect:
+		log.Printf("%s connected from %s\n", event.User, event.Address)
+	case Disconnect:
+		log.Printf("%s disconnected from %s\n", event.User, event.Address)
+	case Join:
+		log.Printf("%s joined room: %s\n", event.User, event.Room)
+	case Leave:
+		log.Printf("%s left room: %s\n", event.User, event.Room)
+	case Rename:
+		log.Printf("%s is now known as %s\n", event.OldName, event.User)
+	case RoomCreated:
+		log.Printf("%s created room: %s\n", event.User, event.Room)
+	case Shutdown:
+		log.Printf("Shutting down chat-telnet server, %s", event.Text)
+	default:
+		log.Printf("%s: [%s] %s: %s\n", event.Kind, event.Room, event.User, event.Text)
+	}
+}
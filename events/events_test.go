@@ -0,0 +1,94 @@
+package events
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_Bus_Publish(t *testing.T) {
+	bus := NewBus()
+	calls := []string{}
+	bus.Subscribe(func(event Event) { calls = append(calls, "all: "+string(event.Kind)) })
+	bus.Subscribe(func(event Event) { calls = append(calls, "rooms: "+string(event.Kind)) }, Join, Leave)
+
+	bus.Publish(Event{Kind: Join, User: "Han Solo", Room: "falcon"})
+	bus.Publish(Event{Kind: Rename, User: "Captain Solo", OldName: "Han Solo"})
+
+	assert.Equal(t, []string{"all: join", "rooms: join", "all: rename"}, calls)
+}
+
+func Test_Bus_Publish_stamps_the_time(t *testing.T) {
+	bus := NewBus()
+	var received []Event
+	bus.Subscribe(func(event Event) { received = append(received, event) })
+	sent := time.Date(2022, 04, 20, 11, 00, 00, 00, time.UTC)
+
+	bus.Publish(Event{Kind: Message, Time: sent})
+	bus.Publish(Event{Kind: Message})
+
+	assert.Equal(t, sent, received[0].Time)
+	assert.False(t, received[1].Time.IsZero())
+}
+
+func Test_Bus_unsubscribe(t *testing.T) {
+	bus := NewBus()
+	first, second := 0, 0
+	stop := bus.Subscribe(func(event Event) { first++ })
+	bus.Subscribe(func(event Event) { second++ })
+
+	bus.Publish(Event{Kind: Connect})
+	stop()
+	stop()
+	bus.Publish(Event{Kind: Disconnect})
+
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 2, second)
+}
+
+// Handlers can publish in turn without deadlocking the bus.
+func Test_Bus_Publish_from_a_handler(t *testing.T) {
+	bus := NewBus()
+	kinds := []Kind{}
+	bus.Subscribe(func(event Event) {
+		kinds = append(kinds, event.Kind)
+		if event.Kind == RoomCreated {
+			bus.Publish(Event{Kind: Join, Room: event.Room})
+		}
+	})
+
+	bus.Publish(Event{Kind: RoomCreated, Room: "falcon"})
+
+	assert.Equal(t, []Kind{RoomCreated, Join}, kinds)
+}
+
+func Test_Log(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+
+	var tests = []struct {
+		event    Event
+		expected string
+	}{
+		{Event{Kind: Connect, User: "guest-0001", Address: "127.0.0.1:5000"}, "guest-0001 connected from 127.0.0.1:5000\n"},
+		{Event{Kind: Rename, User: "Han Solo", OldName: "guest-0001"}, "guest-0001 is now known as Han Solo\n"},
+		{Event{Kind: RoomCreated, User: "Han Solo", Room: "falcon"}, "Han Solo created room: falcon\n"},
+		{Event{Kind: Join, User: "Chewbacca", Room: "falcon"}, "Chewbacca joined room: falcon\n"},
+		{Event{Kind: Message, User: "Chewbacca", Room: "falcon", Text: "Rrraaawwr"}, "message: [falcon] Chewbacca: Rrraaawwr\n"},
+		{Event{Kind: Leave, User: "Chewbacca", Room: "falcon"}, "Chewbacca left room: falcon\n"},
+		{Event{Kind: Shutdown, Text: "disconnecting clients in 5s"}, "Shutting down chat-telnet server, disconnecting clients in 5s\n"},
+	}
+	for _, tt := range tests {
+		Log(tt.event)
+		assert.Equal(t, tt.expected, out.String())
+		out.Reset()
+	}
+}
@@ -4,6 +4,7 @@ go 1.16
 
 require (
 	bou.ke/monkey v1.0.2
-	github.com/patrickmn/go-cache v2.1.0+incompatible
+	github.com/gorilla/websocket v1.5.0
 	github.com/stretchr/testify v1.7.1
+	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
 )
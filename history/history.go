@@ -0,0 +1,207 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// How many messages each room keeps, if the server isn't told otherwise.
+var DEFAULT_SIZE = 100
+
+// Entry is one message as it went out to a room.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Room    string    `json:"room"`
+	Sender  string    `json:"sender"`
+	Message string    `json:"message"`
+	// Only in the file, where it marks the point the room's history was cleared - `Recent` never hands one back.
+	Cleared bool `json:"cleared,omitempty"`
+}
+
+// Store keeps the most recent messages sent to each room, so people joining late can catch up.
+type Store interface {
+	Record(entry Entry) error
+	// The last `n` messages sent to the room, oldest first.
+	Recent(room string, n int) []Entry
+	// Forget everything sent to the room, ex. when a new room is created under the name of an old one.
+	Clear(room string) error
+}
+
+// MemoryStore is the default history Store.  Each room holds on to at most `Size` messages, dropping the oldest as
+//	new ones come in, and they only live as long as the server does.
+type MemoryStore struct {
+	Size  int
+	mu    sync.RWMutex
+	rooms map[string][]Entry
+}
+
+func NewMemoryStore(size int) *MemoryStore {
+	return &MemoryStore{
+		Size:  size,
+		rooms: map[string][]Entry{},
+	}
+}
+
+func (s *MemoryStore) Record(entry Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.record(entry)
+	return nil
+}
+
+func (s *MemoryStore) record(entry Entry) {
+	if s.Size < 1 {
+		return
+	}
+	entries := append(s.rooms[entry.Room], entry)
+	// Slide the window forward rather than copying - `append` leaves the dropped messages behind the next time it
+	//	has to grow the slice.
+	if len(entries) > s.Size {
+		entries = entries[len(entries)-s.Size:]
+	}
+	s.rooms[entry.Room] = entries
+}
+
+func (s *MemoryStore) Clear(room string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rooms, room)
+	return nil
+}
+
+func (s *MemoryStore) Recent(room string, n int) []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := s.rooms[room]
+	if n < len(entries) {
+		entries = entries[len(entries)-n:]
+	}
+	// Hand back a copy, so nobody can change the history out from under the store.
+	return append([]Entry{}, entries...)
+}
+
+// FileStore is a MemoryStore that also appends every message to a file, one JSON entry per line, and reads them back
+//	in when it is created so history survives a restart.  Only the last `size` messages in each room are kept, and the
+//	file is rewritten with just those on start up, so it never grows much past what we actually keep.
+type FileStore struct {
+	*MemoryStore
+	Path    string
+	writeMu sync.Mutex
+	file    *os.File
+}
+
+func NewFileStore(path string, size int) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(size), Path: path}
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	err = s.compact()
+	if err != nil {
+		return nil, err
+	}
+	s.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) Record(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// Hold the lock across both, so the file and memory always agree on the order messages came in.
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.MemoryStore.Record(entry)
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+// Clear the room here and in the file, where a marker is written so the messages before it aren't read back in on
+//	the next start up.
+func (s *FileStore) Clear(room string) error {
+	data, err := json.Marshal(Entry{Time: time.Now(), Room: room, Cleared: true})
+	if err != nil {
+		return err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.MemoryStore.Clear(room)
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+func (s *FileStore) Close() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.file.Close()
+}
+
+func (s *FileStore) load() error {
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := Entry{}
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return fmt.Errorf("Unable to read history file %s, line %d: %v", s.Path, line, err)
+		}
+		if entry.Cleared {
+			delete(s.rooms, entry.Room)
+			continue
+		}
+		s.record(entry)
+	}
+	return scanner.Err()
+}
+
+// Write what we've kept out to a temp file and then move it over the real one, so a crash halfway through can never
+//	leave us with a half written history file.
+func (s *FileStore) compact() error {
+	data := []byte{}
+	for _, entries := range s.rooms {
+		for _, entry := range entries {
+			line, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			data = append(append(data, line...), '\n')
+		}
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
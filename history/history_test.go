@@ -0,0 +1,133 @@
+package history
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func entry(room string, i int) Entry {
+	return Entry{
+		Time:    time.Date(2022, 04, 20, 11, 00, i, 00, time.UTC),
+		Room:    room,
+		Sender:  "Han Solo",
+		Message: fmt.Sprintf("message %d", i),
+	}
+}
+
+func messages(entries []Entry) []string {
+	list := []string{}
+	for _, e := range entries {
+		list = append(list, e.Message)
+	}
+	return list
+}
+
+func Test_MemoryStore_Recent_oldest_first(t *testing.T) {
+	s := NewMemoryStore(10)
+	for i := 1; i <= 3; i++ {
+		s.Record(entry("broom", i))
+	}
+	s.Record(entry("vroom", 4))
+
+	assert.Equal(t, []string{"message 2", "message 3"}, messages(s.Recent("broom", 2)))
+	assert.Equal(t, []string{"message 1", "message 2", "message 3"}, messages(s.Recent("broom", 50)))
+	assert.Equal(t, []string{"message 4"}, messages(s.Recent("vroom", 50)))
+	assert.Empty(t, s.Recent("mushroom", 50))
+}
+
+func Test_MemoryStore_Record_drops_oldest_past_size(t *testing.T) {
+	s := NewMemoryStore(3)
+	for i := 1; i <= 5; i++ {
+		s.Record(entry("broom", i))
+	}
+
+	assert.Equal(t, []string{"message 3", "message 4", "message 5"}, messages(s.Recent("broom", 50)))
+}
+
+func Test_MemoryStore_Recent_returns_copy(t *testing.T) {
+	s := NewMemoryStore(3)
+	s.Record(entry("broom", 1))
+
+	s.Recent("broom", 1)[0].Message = "changed"
+
+	assert.Equal(t, []string{"message 1"}, messages(s.Recent("broom", 1)))
+}
+
+func Test_MemoryStore_Clear(t *testing.T) {
+	s := NewMemoryStore(10)
+	s.Record(entry("broom", 1))
+	s.Record(entry("vroom", 2))
+
+	assert.Nil(t, s.Clear("broom"))
+	s.Record(entry("broom", 3))
+
+	assert.Equal(t, []string{"message 3"}, messages(s.Recent("broom", 10)))
+	assert.Equal(t, []string{"message 2"}, messages(s.Recent("vroom", 10)))
+}
+
+func Test_FileStore_persists_history(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s, err := NewFileStore(path, 10)
+	assert.Nil(t, err)
+	for i := 1; i <= 3; i++ {
+		assert.Nil(t, s.Record(entry("broom", i)))
+	}
+	s.Close()
+
+	reloaded, err := NewFileStore(path, 10)
+	assert.Nil(t, err)
+	defer reloaded.Close()
+
+	assert.Equal(t, s.Recent("broom", 10), reloaded.Recent("broom", 10))
+}
+
+func Test_FileStore_compacts_on_start_up(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s, _ := NewFileStore(path, 10)
+	for i := 1; i <= 5; i++ {
+		s.Record(entry("broom", i))
+	}
+	s.Close()
+
+	reloaded, err := NewFileStore(path, 2)
+	assert.Nil(t, err)
+	defer reloaded.Close()
+	data, _ := ioutil.ReadFile(path)
+
+	assert.Equal(t, []string{"message 4", "message 5"}, messages(reloaded.Recent("broom", 10)))
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+}
+
+// Nothing from before a room was cleared comes back after a restart, and the marker is compacted away with it.
+func Test_FileStore_Clear_survives_restart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s, _ := NewFileStore(path, 10)
+	s.Record(entry("broom", 1))
+	s.Record(entry("vroom", 2))
+	assert.Nil(t, s.Clear("broom"))
+	s.Record(entry("broom", 3))
+	s.Close()
+
+	reloaded, err := NewFileStore(path, 10)
+	assert.Nil(t, err)
+	defer reloaded.Close()
+	data, _ := ioutil.ReadFile(path)
+
+	assert.Equal(t, []string{"message 3"}, messages(reloaded.Recent("broom", 10)))
+	assert.Equal(t, []string{"message 2"}, messages(reloaded.Recent("vroom", 10)))
+	assert.NotContains(t, string(data), "cleared")
+}
+
+func Test_FileStore_bad_file(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	ioutil.WriteFile(path, []byte("{\"room\": \"broom\"}\nnot json\n"), 0600)
+
+	_, err := NewFileStore(path, 10)
+
+	assert.Contains(t, fmt.Sprint(err), "Unable to read history file "+path+", line 2:")
+}
@@ -0,0 +1,52 @@
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+)
+
+// Generator hands out the ids clients are tracked by, along with a friendlier nickname for them to start off with.
+//	Ids have to be unique - nobody should ever read them - but nicknames are just a starting point, users are free
+//	to change them.
+type Generator interface {
+	NewId() string
+	NewNickname() string
+}
+
+// RandomGenerator is the default Generator, using crypto/rand so two connections landing at the same instant still
+//	get their own ids.
+type RandomGenerator struct{}
+
+func (g *RandomGenerator) NewId() string {
+	b := make([]byte, 16)
+	// crypto/rand only fails if the OS can't give us any randomness, at which point we have much bigger problems.
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("unable to generate client id: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+func (g *RandomGenerator) NewNickname() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(10000))
+	if err != nil {
+		panic(fmt.Sprintf("unable to generate nickname: %v", err))
+	}
+	return fmt.Sprintf("guest-%04d", n.Int64())
+}
+
+// SequenceGenerator counts up from 1, so it hands out predictable ids and nicknames - handy for tests.
+type SequenceGenerator struct {
+	ids       int64
+	nicknames int64
+}
+
+func (g *SequenceGenerator) NewId() string {
+	return fmt.Sprint(atomic.AddInt64(&g.ids, 1))
+}
+
+func (g *SequenceGenerator) NewNickname() string {
+	return fmt.Sprintf("guest-%d", atomic.AddInt64(&g.nicknames, 1))
+}
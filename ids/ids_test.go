@@ -0,0 +1,58 @@
+package ids
+
+import (
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func Test_RandomGenerator_NewId_unique(t *testing.T) {
+	g := &RandomGenerator{}
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id := g.NewId()
+		assert.Len(t, id, 32)
+		assert.False(t, seen[id])
+		seen[id] = true
+	}
+}
+
+func Test_RandomGenerator_NewNickname_format(t *testing.T) {
+	g := &RandomGenerator{}
+
+	nickname := g.NewNickname()
+
+	assert.Regexp(t, regexp.MustCompile(`^guest-\d{4}$`), nickname)
+}
+
+func Test_SequenceGenerator_counts_up(t *testing.T) {
+	g := &SequenceGenerator{}
+
+	assert.Equal(t, "1", g.NewId())
+	assert.Equal(t, "2", g.NewId())
+	assert.Equal(t, "guest-1", g.NewNickname())
+	assert.Equal(t, "guest-2", g.NewNickname())
+}
+
+func Test_SequenceGenerator_NewId_concurrent(t *testing.T) {
+	g := &SequenceGenerator{}
+	ids := make(chan string, 100)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids <- g.NewId()
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := map[string]bool{}
+	for id := range ids {
+		assert.False(t, seen[id])
+		seen[id] = true
+	}
+	assert.Len(t, seen, 100)
+}
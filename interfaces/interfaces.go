@@ -3,7 +3,6 @@ package interfaces
 import (
 	"io"
 	"net"
-	"time"
 )
 
 // bufio.Reader doesn't implement it's own interface so we will do that for testing really.
@@ -14,12 +13,6 @@ type AbstractBufioReader interface {
 
 type AbstractClient interface {
 	WriteString(msg string) error
-	WriteResponse(msg string, sendingClient interface{}) error
-}
-
-type AbstractCache interface {
-	Get(k string) (interface{}, bool)
-	Set(k string, x interface{}, d time.Duration)
 }
 
 type AbstractIoWriter interface {
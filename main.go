@@ -3,6 +3,9 @@ package main
 import (
 	"chat-telnet/servers"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
@@ -10,10 +13,30 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer s.Close()
+
+	// Docker's stop sends a SIGTERM, and `cntrl + c` a SIGINT - either way give everyone a heads-up and a moment to
+	//	wrap up before we hang up on them.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		sig := <-signals
+		log.Printf("Received %v", sig)
+		s.Shutdown()
+		close(done)
+	}()
+	// A SIGHUP re-reads the message of the day without a restart, ex. `docker kill --signal=HUP chat`.
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	go func() {
+		for range reloads {
+			s.Reload()
+		}
+	}()
 
 	err = s.Start()
 	if err != nil {
 		log.Fatal(err)
 	}
+	<-done
 }
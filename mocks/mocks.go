@@ -31,6 +31,10 @@ func (m *NetListenerMock) Accept() (net.Conn, error) {
 	if m.AcceptMock != nil {
 		return m.AcceptMock()
 	}
+	// Just like the real thing, stop handing out connections once we're closed.
+	if m.CloseCalled {
+		return nil, net.ErrClosed
+	}
 	return &NetConnMock{}, nil
 }
 
@@ -131,37 +135,3 @@ func (m *IoWriterMock) Write(p []byte) (n int, err error) {
 	}
 	return 0, nil
 }
-
-type CacheMock struct {
-	GetCalled              bool
-	GetCallCount           int
-	GetCalledWithKey       string
-	SetCalled              bool
-	SetCallCount           int
-	SetCalledWithKey       string
-	SetCalledWithInterface interface{}
-	SetCalledWithDuration  time.Duration
-	GetMock                func(k string) (interface{}, bool)
-	SetMock                func(k string, x interface{}, d time.Duration)
-}
-
-func (m *CacheMock) Get(k string) (interface{}, bool) {
-	m.GetCalled = true
-	m.GetCalledWithKey = k
-	m.GetCallCount++
-	if m.GetMock != nil {
-		return m.GetMock(k)
-	}
-	return nil, false
-}
-
-func (m *CacheMock) Set(k string, x interface{}, d time.Duration) {
-	m.SetCalled = true
-	m.SetCalledWithKey = k
-	m.SetCalledWithInterface = x
-	m.SetCalledWithDuration = d
-	m.SetCallCount++
-	if m.SetMock != nil {
-		m.SetMock(k, x, d)
-	}
-}
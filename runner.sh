@@ -5,7 +5,7 @@ IMAGE_TAG="chat"
 ENV_FILE="${DIR}/app.env"
 
 read_variable() {
-    VAR=$(grep $1 $2 | xargs)
+    VAR=$(grep "^$1=" $2 | xargs)
     IFS="=" read -ra VAR <<< "$VAR"
     echo ${VAR[1]}
 }
@@ -17,8 +17,34 @@ post_process(){
 trap post_process SIGINT
 
 PORT=$(read_variable PORT "${ENV_FILE}")
+WEBSOCKET_PORT=$(read_variable WEBSOCKET_PORT "${ENV_FILE}")
+API_PORT=$(read_variable API_PORT "${ENV_FILE}")
+API_PORT_MAPPING=""
+if [ -n "${API_PORT}" ]; then
+  API_PORT_MAPPING="-p=${API_PORT}:${API_PORT}"
+fi
+TLS_PORT=$(read_variable TLS_PORT "${ENV_FILE}")
+TLS_PORT_MAPPING=""
+if [ -n "${TLS_PORT}" ]; then
+  TLS_PORT_MAPPING="-p=${TLS_PORT}:${TLS_PORT}"
+fi
+IRC_PORT=$(read_variable IRC_PORT "${ENV_FILE}")
+IRC_PORT_MAPPING=""
+if [ -n "${IRC_PORT}" ]; then
+  IRC_PORT_MAPPING="-p=${IRC_PORT}:${IRC_PORT}"
+fi
+JSON_PORT=$(read_variable JSON_PORT "${ENV_FILE}")
+JSON_PORT_MAPPING=""
+if [ -n "${JSON_PORT}" ]; then
+  JSON_PORT_MAPPING="-p=${JSON_PORT}:${JSON_PORT}"
+fi
+SSH_PORT=$(read_variable SSH_PORT "${ENV_FILE}")
+SSH_PORT_MAPPING=""
+if [ -n "${SSH_PORT}" ]; then
+  SSH_PORT_MAPPING="-p=${SSH_PORT}:${SSH_PORT}"
+fi
 
 docker build --no-cache -t $IMAGE_TAG .
-docker run --rm -d --name="${IMAGE_TAG}" -v "${DIR}/log:/app/log" -p="${PORT}":"${PORT}" --env-file="${ENV_FILE}" "${IMAGE_TAG}"
+docker run --rm -d --name="${IMAGE_TAG}" -v "${DIR}/log:/app/log" -p="${PORT}":"${PORT}" -p="${WEBSOCKET_PORT}":"${WEBSOCKET_PORT}" ${API_PORT_MAPPING} ${TLS_PORT_MAPPING} ${IRC_PORT_MAPPING} ${JSON_PORT_MAPPING} ${SSH_PORT_MAPPING} --env-file="${ENV_FILE}" "${IMAGE_TAG}"
 
 tail -F "${DIR}/log/chat.log"
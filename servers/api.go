@@ -0,0 +1,203 @@
+package servers
+
+import (
+	"chat-telnet/clients"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+type roomResponse struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+type userResponse struct {
+	Name       string   `json:"name"`
+	Room       string   `json:"room"` // The room they're talking in.
+	Rooms      []string `json:"rooms"`
+	QueueDepth int      `json:"queue_depth"` // How many messages are waiting to go out to them.
+	Dropped    int64    `json:"dropped"`     // How many they've missed for not keeping up.
+}
+
+type messageRequest struct {
+	Sender  string `json:"sender"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// The HTTP API gives our tooling the same view of the chat that `\list-rooms` and `\list` give anyone who isn't in
+//	a room, and lets scripts post into rooms anyone could join.  Every route lives under `/rooms` or `/users`:
+//		GET		/rooms
+//		GET		/rooms/{name}/members
+//		POST	/rooms/{name}/messages		{"sender": "deploy-bot", "message": "Shipped!"}
+//		GET		/users
+func (s *Server) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rooms", s.handleRooms)
+	mux.HandleFunc("/rooms/", s.handleRoom)
+	mux.HandleFunc("/users", s.handleUsers)
+	return s.requireAPIToken(mux)
+}
+
+// Every request has to carry the `API_TOKEN` as a bearer token - `NewServer` won't start the API without one.
+func (s *Server) requireAPIToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.APIToken != "" && r.Header.Get("Authorization") != "Bearer "+s.APIToken {
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "missing or invalid API token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleRooms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		return
+	}
+	rooms := s.Store.ListRooms()
+	roomList := []roomResponse{}
+	for name, members := range rooms {
+		if s.listed(name) {
+			roomList = append(roomList, roomResponse{Name: name, Members: memberNames(members)})
+		}
+	}
+	sort.Slice(roomList, func(i, j int) bool { return roomList[i].Name < roomList[j].Name })
+	writeJSON(w, http.StatusOK, roomList)
+}
+
+// Handles everything under `/rooms/{name}/`.  Room names can have spaces or even slashes in them, so we split the
+//	still escaped path and unescape the name ourselves.
+func (s *Server) handleRoom(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/rooms/"), "/")
+	if len(parts) != 2 {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not found"})
+		return
+	}
+	roomName, err := url.PathUnescape(parts[0])
+	if err != nil || roomName == "" {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not found"})
+		return
+	}
+
+	switch {
+	case parts[1] == "members" && r.Method == http.MethodGet:
+		s.handleRoomMembers(w, roomName)
+	case parts[1] == "messages" && r.Method == http.MethodPost:
+		s.handleRoomMessage(w, r, roomName)
+	case parts[1] == "members" || parts[1] == "messages":
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+	default:
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not found"})
+	}
+}
+
+func (s *Server) handleRoomMembers(w http.ResponseWriter, roomName string) {
+	members, found := s.Store.MembersOf(roomName)
+	// Like `\list`, rooms that aren't listed don't exist as far as outsiders are concerned.
+	if !found || !s.listed(roomName) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "no such room"})
+		return
+	}
+	writeJSON(w, http.StatusOK, roomResponse{Name: roomName, Members: memberNames(members)})
+}
+
+func (s *Server) handleRoomMessage(w http.ResponseWriter, r *http.Request, roomName string) {
+	body := messageRequest{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid JSON body"})
+		return
+	}
+	body.Message = strings.TrimSpace(body.Message)
+	if body.Message == "" || strings.ContainsAny(body.Message, "\r\n") {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "message must be a single, non-empty line"})
+		return
+	}
+	if body.Sender == "" {
+		body.Sender = clients.SERVER
+	}
+
+	err = clients.PostToRoom(s.Store, body.Sender, roomName, body.Message)
+	if err == clients.ErrNoSuchRoom {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "no such room"})
+		return
+	}
+	if err == clients.ErrNotOpen {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	log.Printf("API: %s posted to room %s", body.Sender, roomName)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		return
+	}
+	userList := []userResponse{}
+	for _, client := range s.Store.ListClients() {
+		// Nobody gets found out to be in a room that isn't listed by way of who they are, either.
+		rooms := []string{}
+		for _, roomName := range client.Rooms() {
+			if s.listed(roomName) {
+				rooms = append(rooms, roomName)
+			}
+		}
+		room := client.ActiveRoom()
+		if !s.listed(room) {
+			room = ""
+		}
+		userList = append(userList, userResponse{
+			Name:       client.UserName(),
+			Room:       room,
+			Rooms:      rooms,
+			QueueDepth: client.QueueDepth(),
+			Dropped:    client.DroppedMessages(),
+		})
+	}
+	sort.Slice(userList, func(i, j int) bool { return userList[i].Name < userList[j].Name })
+	writeJSON(w, http.StatusOK, userList)
+}
+
+func (s *Server) serveAPI() error {
+	err := http.Serve(s.APIListener, s.apiHandler())
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// Is the room there for anyone to see, ex. in `\list-rooms`?
+func (s *Server) listed(roomName string) bool {
+	moderation, found := s.Store.Moderation(roomName)
+	return found && moderation.Listed()
+}
+
+func memberNames(members []*clients.Client) []string {
+	names := []string{}
+	for _, member := range members {
+		names = append(names, member.UserName())
+	}
+	return names
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
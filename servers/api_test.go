@@ -0,0 +1,218 @@
+package servers_test
+
+import (
+	"bufio"
+	"chat-telnet/clients"
+	"chat-telnet/servers"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Spin up a real server with an HTTP API listener, plus a telnet listener for anyone the tests need sitting in a room.
+func startTestAPIServer(t *testing.T, token string) (*servers.Server, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	apil, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := &servers.Server{Listener: l, APIListener: apil, APIToken: token, Store: servers.NewChatStore()}
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	return s, fmt.Sprintf("http://%s", apil.Addr())
+}
+
+// Connect over telnet, take a name and sit in a room.
+func joinOverTelnet(t *testing.T, s *servers.Server, name, room string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	assert.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+	r := bufio.NewReader(conn)
+	readTelnetUntil(t, conn, r, "If you'd like to reset it")
+	fmt.Fprintf(conn, "\\name %s\n", name)
+	readTelnetUntil(t, conn, r, "has become -> "+name)
+	fmt.Fprintf(conn, "\\join %s\n", room)
+	response := readTelnetUntil(t, conn, r, room)
+	if strings.Contains(response, "doesn't exist") {
+		fmt.Fprintf(conn, "\\create %s\n", room)
+		readTelnetUntil(t, conn, r, room)
+	}
+	return conn, r
+}
+
+func getJSON(t *testing.T, url string, body interface{}) int {
+	resp, err := http.Get(url)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(body))
+	return resp.StatusCode
+}
+
+func Test_API_rooms_and_users(t *testing.T) {
+	s, base := startTestAPIServer(t, "")
+	joinOverTelnet(t, s, "Han Solo", "cantina")
+	joinOverTelnet(t, s, "Chewbacca", "cantina")
+
+	rooms := []map[string]interface{}{}
+	status := getJSON(t, base+"/rooms", &rooms)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []map[string]interface{}{
+		{"name": "cantina", "members": []interface{}{"Han Solo", "Chewbacca"}},
+	}, rooms)
+
+	users := []map[string]interface{}{}
+	status = getJSON(t, base+"/users", &users)
+	assert.Equal(t, http.StatusOK, status)
+	// Whatever is still on its way out to them depends on timing, so just check it's there.
+	for _, user := range users {
+		assert.Contains(t, user, "queue_depth")
+		assert.Equal(t, float64(0), user["dropped"])
+		delete(user, "queue_depth")
+		delete(user, "dropped")
+	}
+	assert.Equal(t, []map[string]interface{}{
+		{"name": "Chewbacca", "room": "cantina", "rooms": []interface{}{"cantina"}},
+		{"name": "Han Solo", "room": "cantina", "rooms": []interface{}{"cantina"}},
+	}, users)
+}
+
+func Test_API_room_members(t *testing.T) {
+	s, base := startTestAPIServer(t, "")
+	joinOverTelnet(t, s, "Han Solo", "mos eisley")
+
+	members := map[string]interface{}{}
+	status := getJSON(t, base+"/rooms/mos%20eisley/members", &members)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, map[string]interface{}{"name": "mos eisley", "members": []interface{}{"Han Solo"}}, members)
+
+	missing := map[string]string{}
+	status = getJSON(t, base+"/rooms/hoth/members", &missing)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, map[string]string{"error": "no such room"}, missing)
+}
+
+// The API only sees what anyone outside a room would - no unlisted rooms, or who's in them, and no posting into rooms
+//	that need a password or an invite.
+func Test_API_respects_room_access(t *testing.T) {
+	s, base := startTestAPIServer(t, "")
+	for name, mode := range map[string]clients.RoomMode{
+		"hideout": clients.UnlistedRoom, "den": clients.PasswordRoom, "palace": clients.InviteOnlyRoom,
+	} {
+		s.Store.SeedRoom(name, clients.RoomModeration{RoomAccess: clients.RoomAccess{Mode: mode}})
+	}
+	joinOverTelnet(t, s, "Han Solo", "cantina")
+	joinOverTelnet(t, s, "Greedo", "hideout")
+
+	rooms := []map[string]interface{}{}
+	getJSON(t, base+"/rooms", &rooms)
+	assert.Equal(t, []map[string]interface{}{{"name": "cantina", "members": []interface{}{"Han Solo"}}}, rooms)
+
+	missing := map[string]string{}
+	status := getJSON(t, base+"/rooms/hideout/members", &missing)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	users := []map[string]interface{}{}
+	getJSON(t, base+"/users", &users)
+	assert.Equal(t, "Greedo", users[0]["name"])
+	assert.Equal(t, "", users[0]["room"])
+	assert.Equal(t, []interface{}{}, users[0]["rooms"])
+
+	for path, expected := range map[string]int{
+		"/rooms/hideout/messages": http.StatusNoContent,
+		"/rooms/den/messages":     http.StatusForbidden,
+		"/rooms/palace/messages":  http.StatusForbidden,
+	} {
+		resp, err := http.Post(base+path, "application/json", strings.NewReader(`{"message": "Anyone home?"}`))
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, expected, resp.StatusCode, path)
+	}
+}
+
+func Test_NewServer_api_needs_token(t *testing.T) {
+	setEnv(t, "PORT", "0")
+	setEnv(t, "API_PORT", "0")
+
+	_, err := servers.NewServer()
+
+	assert.Equal(t, "API_PORT needs API_TOKEN to be set", fmt.Sprint(err))
+}
+
+func Test_API_post_message_reaches_telnet(t *testing.T) {
+	s, base := startTestAPIServer(t, "")
+	conn, r := joinOverTelnet(t, s, "Han Solo", "cantina")
+
+	resp, err := http.Post(base+"/rooms/cantina/messages", "application/json",
+		strings.NewReader(`{"sender": "deploy-bot", "message": "Shipped!"}`))
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	line := readTelnetUntil(t, conn, r, "Shipped!")
+	assert.True(t, strings.HasSuffix(line, ": [cantina] [deploy-bot]: Shipped!\n"))
+}
+
+func Test_API_post_message_errors(t *testing.T) {
+	s, base := startTestAPIServer(t, "")
+	joinOverTelnet(t, s, "Han Solo", "cantina")
+
+	tests := []struct {
+		path     string
+		body     string
+		status   int
+		expected string
+	}{
+		{"/rooms/hoth/messages", `{"message": "Anyone out there?"}`, http.StatusNotFound, "no such room"},
+		{"/rooms/cantina/messages", `not json`, http.StatusBadRequest, "invalid JSON body"},
+		{"/rooms/cantina/messages", `{"message": "  "}`, http.StatusBadRequest, "message must be a single, non-empty line"},
+		{"/rooms/cantina/messages", `{"message": "one\ntwo"}`, http.StatusBadRequest, "message must be a single, non-empty line"},
+		{"/rooms/cantina/messages", `{"sender": "x", "message": "hi"}`, http.StatusBadRequest, "Invalid sender - names must be at least 2 characters long"},
+	}
+	for _, test := range tests {
+		resp, err := http.Post(base+test.path, "application/json", strings.NewReader(test.body))
+		assert.Nil(t, err)
+		body := map[string]string{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+
+		assert.Equal(t, test.status, resp.StatusCode, test.body)
+		assert.Equal(t, test.expected, body["error"], test.body)
+	}
+}
+
+func Test_API_wrong_method_and_unknown_route(t *testing.T) {
+	_, base := startTestAPIServer(t, "")
+
+	resp, err := http.Post(base+"/users", "application/json", strings.NewReader("{}"))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = http.Get(base + "/rooms/cantina/droids")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func Test_API_token_required(t *testing.T) {
+	_, base := startTestAPIServer(t, "sekrit")
+
+	resp, err := http.Get(base + "/rooms")
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "{\"error\":\"missing or invalid API token\"}\n", string(body))
+
+	req, _ := http.NewRequest(http.MethodGet, base+"/rooms", nil)
+	req.Header.Set("Authorization", "Bearer sekrit")
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,16 @@
+package servers
+
+import (
+	"chat-telnet/clients"
+	"log"
+	"net"
+)
+
+// IRC clients do all the talking at first, so there's nothing to negotiate - just hand them straight to the clients.
+func (s *Server) acceptIRC(conn net.Conn) {
+	err := clients.GenerateIRCClient(conn, s.Store)
+	if err != nil {
+		log.Println(err)
+		conn.Close()
+	}
+}
@@ -0,0 +1,57 @@
+package servers_test
+
+import (
+	"bufio"
+	"chat-telnet/servers"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strings"
+	"testing"
+)
+
+func Test_IRC_shares_rooms_with_telnet(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	il, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := &servers.Server{Listener: l, IRCListener: il, Store: servers.NewChatStore()}
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+
+	telnet, err := net.Dial("tcp", s.Listener.Addr().String())
+	assert.Nil(t, err)
+	defer telnet.Close()
+	r := bufio.NewReader(telnet)
+	readTelnetUntil(t, telnet, r, "If you'd like to reset it")
+	fmt.Fprint(telnet, "\\name Han Solo\n")
+	readTelnetUntil(t, telnet, r, "has become -> Han Solo")
+	fmt.Fprint(telnet, "\\create falcon\n")
+	readTelnetUntil(t, telnet, r, "New room created: falcon")
+
+	irc, err := net.Dial("tcp", s.IRCListener.Addr().String())
+	assert.Nil(t, err)
+	defer irc.Close()
+	ir := bufio.NewReader(irc)
+	fmt.Fprint(irc, "NICK Chewbacca\r\nUSER chewie 0 * :Chewbacca\r\n")
+	readTelnetUntil(t, irc, ir, " 001 Chewbacca :Welcome to Chattington")
+	fmt.Fprint(irc, "JOIN #falcon\r\n")
+	readTelnetUntil(t, irc, ir, ":Chewbacca!Chewbacca@chattington JOIN #falcon")
+	names := readTelnetUntil(t, irc, ir, " 353 ")
+	assert.Equal(t, ":chattington 353 Chewbacca = #falcon :@Han_Solo Chewbacca\r\n", names)
+	readTelnetUntil(t, telnet, r, "Chewbacca has entered: falcon")
+
+	fmt.Fprint(telnet, "Punch it, Chewie!\n")
+	msg := readTelnetUntil(t, irc, ir, "Punch it")
+	assert.Equal(t, ":Han_Solo!Han_Solo@chattington PRIVMSG #falcon :Punch it, Chewie!\r\n", msg)
+
+	fmt.Fprint(irc, "PRIVMSG #falcon :Rrraaawwr\r\n")
+	line := readTelnetUntil(t, telnet, r, "Rrraaawwr")
+	assert.True(t, strings.HasSuffix(line, ": [falcon] Chewbacca: Rrraaawwr\n"))
+
+	fmt.Fprint(irc, "PING :are-you-there\r\n")
+	readTelnetUntil(t, irc, ir, "PONG chattington are-you-there")
+	fmt.Fprint(irc, "QUIT :Bye\r\n")
+	readTelnetUntil(t, irc, ir, "ERROR :Closing link")
+	readTelnetUntil(t, telnet, r, "Chewbacca has gone offline")
+}
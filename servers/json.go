@@ -0,0 +1,16 @@
+package servers
+
+import (
+	"chat-telnet/clients"
+	"log"
+	"net"
+)
+
+// The JSON port is plain TCP with a JSON object on every line, so there's no telnet to negotiate either.
+func (s *Server) acceptJSON(conn net.Conn) {
+	err := clients.GenerateJSONClient(conn, s.Store)
+	if err != nil {
+		log.Println(err)
+		conn.Close()
+	}
+}
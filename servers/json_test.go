@@ -0,0 +1,61 @@
+package servers_test
+
+import (
+	"bufio"
+	"chat-telnet/servers"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+// Read JSON lines until one of them contains `expected`, and decode it.
+func readJSONUntil(t *testing.T, conn net.Conn, r *bufio.Reader, expected string) map[string]interface{} {
+	event := map[string]interface{}{}
+	line := readTelnetUntil(t, conn, r, expected)
+	assert.Nil(t, json.Unmarshal([]byte(line), &event), line)
+	return event
+}
+
+func Test_JSON_port_and_mode(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	jl, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := &servers.Server{Listener: l, JSONListener: jl, Store: servers.NewChatStore()}
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+
+	bot, err := net.Dial("tcp", s.JSONListener.Addr().String())
+	assert.Nil(t, err)
+	defer bot.Close()
+	br := bufio.NewReader(bot)
+	welcome := readJSONUntil(t, bot, br, "Welcome to Chattington!")
+	assert.Equal(t, "notice", welcome["type"])
+	fmt.Fprint(bot, `{"type": "command", "command": "name", "args": "R2-D2"}`+"\n")
+	readJSONUntil(t, bot, br, `"command_result"`)
+	fmt.Fprint(bot, `{"type": "command", "command": "create", "args": "falcon", "id": "1"}`+"\n")
+	created := readJSONUntil(t, bot, br, `"request_id":"1"`)
+	assert.Equal(t, "New room created: falcon", created["text"])
+
+	// A telnet user can switch over too.
+	telnet, err := net.Dial("tcp", s.Listener.Addr().String())
+	assert.Nil(t, err)
+	defer telnet.Close()
+	r := bufio.NewReader(telnet)
+	readTelnetUntil(t, telnet, r, "If you'd like to reset it")
+	fmt.Fprint(telnet, "\\name C-3PO\n\\join falcon\n\\mode json\n")
+	readJSONUntil(t, telnet, r, "Mode set to json.")
+
+	joined := readJSONUntil(t, bot, br, `"type":"join"`)
+	assert.Equal(t, "falcon", joined["room"])
+	assert.Equal(t, "C-3PO", joined["sender"])
+	fmt.Fprint(bot, `{"type": "message", "text": "Beep boop"}`+"\n")
+	msg := readJSONUntil(t, telnet, r, "Beep boop")
+	assert.Equal(t, "message", msg["type"])
+	assert.Equal(t, "R2-D2", msg["sender"])
+	assert.Equal(t, "falcon", msg["room"])
+	assert.NotEmpty(t, msg["id"])
+	assert.NotZero(t, msg["timestamp"])
+}
@@ -0,0 +1,72 @@
+package servers
+
+import (
+	"chat-telnet/clients"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// How often the OS checks in on a quiet connection, if the `TCP_KEEPALIVE` environment variable isn't set.
+var DEFAULT_KEEPALIVE = 15 * time.Second
+
+// keepAliveListener turns on TCP keepalives for every connection it accepts, so connections to peers that have gone
+//	away without saying goodbye (a dropped wifi, a sleeping laptop) get noticed and closed instead of hanging around.
+type keepAliveListener struct {
+	net.Listener
+	period time.Duration
+}
+
+func (l keepAliveListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetKeepAlive(l.period > 0)
+		if l.period > 0 {
+			tcpConn.SetKeepAlivePeriod(l.period)
+		}
+	}
+	return conn, nil
+}
+
+// `TCP_KEEPALIVE` is how often to check in on quiet connections, ex. `30s`, with `0` turning keepalives off.
+func keepAliveFromEnv() (time.Duration, error) {
+	value := os.Getenv("TCP_KEEPALIVE")
+	if value == "" {
+		return DEFAULT_KEEPALIVE, nil
+	}
+	period, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid TCP_KEEPALIVE `%s`: %v", value, err)
+	}
+	return period, nil
+}
+
+// Clients who don't send anything for `IDLE_TIMEOUT` (ex. `30m`) are disconnected, after a warning `IDLE_WARNING`
+//	before it happens.  Leave `IDLE_TIMEOUT` unset, or `0`, to let them sit there forever.
+func configureIdleFromEnv() error {
+	for _, setting := range []struct {
+		key   string
+		value *time.Duration
+	}{
+		{"IDLE_TIMEOUT", &clients.IdleTimeout},
+		{"IDLE_WARNING", &clients.IdleWarning},
+	} {
+		value := os.Getenv(setting.key)
+		if value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err == nil && duration < 0 {
+			err = fmt.Errorf("can't be negative")
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid %s `%s`: %v", setting.key, value, err)
+		}
+		*setting.value = duration
+	}
+	return nil
+}
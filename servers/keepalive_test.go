@@ -0,0 +1,75 @@
+package servers_test
+
+import (
+	"bou.ke/monkey"
+	"chat-telnet/clients"
+	"chat-telnet/mocks"
+	"chat-telnet/servers"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_NewServer_keepalive_on_accepted_connections(t *testing.T) {
+	setEnv(t, "PORT", "0")
+	setEnv(t, "TCP_KEEPALIVE", "30s")
+	s, err := servers.NewServer()
+	assert.Nil(t, err)
+	defer s.Close()
+	go func() {
+		conn, err := net.Dial("tcp", localAddr(s.Listener))
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	conn, err := s.Listener.Accept()
+
+	assert.Nil(t, err)
+	assert.IsType(t, &net.TCPConn{}, conn)
+	conn.Close()
+}
+
+func Test_NewServer_idle_timeout_from_env(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+	defer func(timeout, warning time.Duration) {
+		clients.IdleTimeout, clients.IdleWarning = timeout, warning
+	}(clients.IdleTimeout, clients.IdleWarning)
+	setEnv(t, "IDLE_TIMEOUT", "30m")
+	setEnv(t, "IDLE_WARNING", "2m")
+
+	_, err := servers.NewServer()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 30*time.Minute, clients.IdleTimeout)
+	assert.Equal(t, 2*time.Minute, clients.IdleWarning)
+}
+
+func Test_NewServer_invalid_idle_and_keepalive(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+
+	var tests = []struct {
+		key      string
+		value    string
+		expected string
+	}{
+		{"IDLE_TIMEOUT", "forever", "Invalid IDLE_TIMEOUT `forever`: time: invalid duration \"forever\""},
+		{"IDLE_WARNING", "-1m", "Invalid IDLE_WARNING `-1m`: can't be negative"},
+		{"TCP_KEEPALIVE", "often", "Invalid TCP_KEEPALIVE `often`: time: invalid duration \"often\""},
+	}
+	for _, tt := range tests {
+		os.Setenv(tt.key, tt.value)
+		_, err := servers.NewServer()
+		os.Unsetenv(tt.key)
+		assert.Equal(t, tt.expected, fmt.Sprint(err), tt.value)
+	}
+}
@@ -1,58 +1,467 @@
 package servers
 
 import (
+	"chat-telnet/accounts"
 	"chat-telnet/clients"
+	"chat-telnet/events"
+	"chat-telnet/history"
+	"crypto/tls"
 	"fmt"
-	cache2 "github.com/patrickmn/go-cache"
+	"golang.org/x/crypto/ssh"
 	"log"
 	"net"
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// How long we give clients to finish up after they've been told the server is going down, if the
+//	`SHUTDOWN_GRACE_PERIOD` environment variable isn't set.
+var DEFAULT_GRACE_PERIOD = 5 * time.Second
+
 type Server struct {
-	Listener net.Listener
+	Listener          net.Listener // Plaintext telnet, left unset when `TLS_ONLY` is.
+	TLSListener       net.Listener // Only set when `TLS_PORT` is.
+	WebSocketListener net.Listener // Only set when `WEBSOCKET_PORT` is.
+	IRCListener       net.Listener // Only set when `IRC_PORT` is.
+	JSONListener      net.Listener // Only set when `JSON_PORT` is.
+	SSHListener       net.Listener // Only set when `SSH_PORT` is, along with `SSHConfig`.
+	SSHConfig         *ssh.ServerConfig
+	APIListener       net.Listener // Only set when `API_PORT` is.
+	APIToken          string
+	Store             clients.ChatStore
+	GracePeriod       time.Duration
+	shuttingDown      int32
 }
 
 func NewServer() (Server, error) {
 	port := os.Getenv("PORT")
-	l, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	gracePeriod, err := gracePeriodFromEnv()
+	if err != nil {
+		return Server{}, err
+	}
+	clients.NameRules, err = nameRulesFromEnv()
+	if err != nil {
+		return Server{}, err
+	}
+	err = configureAccountsFromEnv()
+	if err != nil {
+		return Server{}, err
+	}
+	err = configureHistoryFromEnv()
+	if err != nil {
+		return Server{}, err
+	}
+	err = configureMOTDFromEnv()
+	if err != nil {
+		return Server{}, err
+	}
+	err = configureQueueFromEnv()
+	if err != nil {
+		return Server{}, err
+	}
+	err = configureIdleFromEnv()
+	if err != nil {
+		return Server{}, err
+	}
+	keepAlive, err := keepAliveFromEnv()
+	if err != nil {
+		return Server{}, err
+	}
+	tlsConfig, tlsOnly, err := tlsConfigFromEnv()
+	if err != nil {
+		return Server{}, err
+	}
+	sshConfig, err := sshConfigFromEnv()
 	if err != nil {
 		return Server{}, err
 	}
 	server := Server{
-		Listener: l,
+		Store:       NewChatStore(),
+		GracePeriod: gracePeriod,
+	}
+	err = configureRoomsFromEnv(server.Store)
+	if err != nil {
+		return Server{}, err
+	}
+	if !tlsOnly {
+		server.Listener, err = net.Listen("tcp", fmt.Sprintf(":%s", port))
+		if err != nil {
+			return Server{}, err
+		}
+		server.Listener = keepAliveListener{server.Listener, keepAlive}
+		log.Printf("Starting chat-telnet server on port: %s", port)
+	}
+	if tlsConfig != nil {
+		tlsPort := os.Getenv("TLS_PORT")
+		server.TLSListener, err = listenTLS(tlsPort, tlsConfig, keepAlive)
+		if err != nil {
+			server.Close()
+			return Server{}, err
+		}
+		log.Printf("Starting chat-telnet TLS server on port: %s", tlsPort)
+	}
+
+	// Browsers can't speak telnet, so give them a websocket to connect to instead - they all end up in the same rooms.
+	if wsPort := os.Getenv("WEBSOCKET_PORT"); wsPort != "" {
+		server.WebSocketListener, err = net.Listen("tcp", fmt.Sprintf(":%s", wsPort))
+		if err != nil {
+			server.Close()
+			return Server{}, err
+		}
+		server.WebSocketListener = keepAliveListener{server.WebSocketListener, keepAlive}
+		log.Printf("Starting websocket listener on port: %s", wsPort)
+	}
+	// And IRC clients get a port of their own, speaking IRC instead of telnet.
+	if ircPort := os.Getenv("IRC_PORT"); ircPort != "" {
+		server.IRCListener, err = net.Listen("tcp", fmt.Sprintf(":%s", ircPort))
+		if err != nil {
+			server.Close()
+			return Server{}, err
+		}
+		server.IRCListener = keepAliveListener{server.IRCListener, keepAlive}
+		log.Printf("Starting IRC listener on port: %s", ircPort)
+	}
+	// Bots and scripts can skip `\mode json` by connecting here, where everything is JSON lines from the start.
+	if jsonPort := os.Getenv("JSON_PORT"); jsonPort != "" {
+		server.JSONListener, err = net.Listen("tcp", fmt.Sprintf(":%s", jsonPort))
+		if err != nil {
+			server.Close()
+			return Server{}, err
+		}
+		server.JSONListener = keepAliveListener{server.JSONListener, keepAlive}
+		log.Printf("Starting JSON listener on port: %s", jsonPort)
+	}
+	// SSH clients are who their key says they are, with no passwords to send at all.
+	if sshConfig != nil {
+		sshPort := os.Getenv("SSH_PORT")
+		server.SSHListener, err = net.Listen("tcp", fmt.Sprintf(":%s", sshPort))
+		if err != nil {
+			server.Close()
+			return Server{}, err
+		}
+		server.SSHListener = keepAliveListener{server.SSHListener, keepAlive}
+		server.SSHConfig = sshConfig
+		log.Printf("Starting SSH listener on port: %s", sshPort)
+	}
+	if apiPort := os.Getenv("API_PORT"); apiPort != "" {
+		// Anyone who can reach the port could read and post in every room, so it's never left open.
+		if os.Getenv("API_TOKEN") == "" {
+			server.Close()
+			return Server{}, fmt.Errorf("API_PORT needs API_TOKEN to be set")
+		}
+		server.APIListener, err = net.Listen("tcp", fmt.Sprintf(":%s", apiPort))
+		if err != nil {
+			server.Close()
+			return Server{}, err
+		}
+		server.APIToken = os.Getenv("API_TOKEN")
+		log.Printf("Starting HTTP API on port: %s", apiPort)
 	}
-	log.Printf("Starting chat-telnet server on port: %s", port)
 	return server, nil
 }
 
 func (s *Server) Close() {
-	s.Listener.Close()
+	if s.Listener != nil {
+		s.Listener.Close()
+	}
+	if s.TLSListener != nil {
+		s.TLSListener.Close()
+	}
+	if s.WebSocketListener != nil {
+		s.WebSocketListener.Close()
+	}
+	if s.IRCListener != nil {
+		s.IRCListener.Close()
+	}
+	if s.JSONListener != nil {
+		s.JSONListener.Close()
+	}
+	if s.SSHListener != nil {
+		s.SSHListener.Close()
+	}
+	if s.APIListener != nil {
+		s.APIListener.Close()
+	}
+}
+
+// Stop taking new connections, warn everyone still connected and then hang up on them once the grace period is up.
+func (s *Server) Shutdown() {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+	clients.Events.Publish(events.Event{
+		Kind: events.Shutdown, Text: fmt.Sprintf("disconnecting clients in %v", s.GracePeriod),
+	})
+	s.Close()
+	if s.Store != nil {
+		clients.DisconnectAll(s.Store, s.GracePeriod)
+	}
+	log.Println("All clients disconnected")
 }
 
 func (s *Server) Start() error {
-	cache := NewChatCache() // pointer to our global cache
+	if s.Store == nil {
+		s.Store = NewChatStore() // pointer to our global chat state
+	}
+	if s.WebSocketListener != nil {
+		go func() {
+			err := s.serveWebSockets()
+			if err != nil {
+				log.Printf("Websocket listener stopped: %v", err)
+			}
+		}()
+	}
+	if s.IRCListener != nil {
+		go func() {
+			err := s.acceptConnections(s.IRCListener, s.acceptIRC)
+			if err != nil {
+				log.Printf("IRC listener stopped: %v", err)
+			}
+		}()
+	}
+	if s.JSONListener != nil {
+		go func() {
+			err := s.acceptConnections(s.JSONListener, s.acceptJSON)
+			if err != nil {
+				log.Printf("JSON listener stopped: %v", err)
+			}
+		}()
+	}
+	if s.SSHListener != nil {
+		go func() {
+			err := s.acceptConnections(s.SSHListener, s.acceptSSH)
+			if err != nil {
+				log.Printf("SSH listener stopped: %v", err)
+			}
+		}()
+	}
+	if s.APIListener != nil {
+		go func() {
+			err := s.serveAPI()
+			if err != nil {
+				log.Printf("HTTP API stopped: %v", err)
+			}
+		}()
+	}
+	// With `TLS_ONLY` there's no plaintext listener, so the TLS one gets to hold `Start` open instead.
+	if s.TLSListener != nil {
+		if s.Listener == nil {
+			return s.acceptConnections(s.TLSListener, s.acceptTelnet)
+		}
+		go func() {
+			err := s.acceptConnections(s.TLSListener, s.acceptTelnet)
+			if err != nil {
+				log.Printf("TLS listener stopped: %v", err)
+			}
+		}()
+	}
+	return s.acceptConnections(s.Listener, s.acceptTelnet)
+}
+
+// Hand every connection that comes in on the listener off to `accept`, until the listener is closed.
+func (s *Server) acceptConnections(l net.Listener, accept func(conn net.Conn)) error {
 	for {
 		// Wait for a connection.
-		conn, err := s.Listener.Accept()
+		conn, err := l.Accept()
+		if err != nil {
+			// Closing the listener in `Shutdown` is what gets us out of here, so that's not really an error.
+			if atomic.LoadInt32(&s.shuttingDown) == 1 {
+				return nil
+			}
+			return err
+		}
+
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			go s.acceptTLS(tlsConn)
+			continue
+		}
+
+		accept(conn)
+	}
+}
+
+// Wrap the connection up so the telnet negotiation never reaches the clients, and hand it off to them.
+func (s *Server) acceptTelnet(conn net.Conn) {
+	telnet := NewTelnetConn(conn)
+	err := telnet.Negotiate()
+	// If we fail to generate a client when the user connects log and close the connection, letting them try again.
+	//	Keep the server going though to continue listening.
+	if err == nil {
+		err = clients.GenerateNewClient(telnet, s.Store)
+	}
+	if err != nil {
+		log.Println(err)
+		conn.Close()
+	}
+}
+
+// This should create a thread-safe store so we should be about to pound it with go routines all we want.
+func NewChatStore() clients.ChatStore {
+	return clients.NewMemoryStore()
+}
+
+func gracePeriodFromEnv() (time.Duration, error) {
+	value := os.Getenv("SHUTDOWN_GRACE_PERIOD")
+	if value == "" {
+		return DEFAULT_GRACE_PERIOD, nil
+	}
+	gracePeriod, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid SHUTDOWN_GRACE_PERIOD `%s`: %v", value, err)
+	}
+	return gracePeriod, nil
+}
+
+// Start from the default name rules and override whichever of them are set in the environment.  An empty
+//	`NAME_ALLOWED_PUNCTUATION` or `NAME_RESERVED` is taken at its word, and allows no punctuation or reserves no names.
+func nameRulesFromEnv() (clients.NamePolicy, error) {
+	rules := clients.DefaultNamePolicy()
+	var err error
+	if value, found := os.LookupEnv("NAME_MIN_LENGTH"); found {
+		rules.MinLength, err = strconv.Atoi(value)
+		if err != nil {
+			return rules, fmt.Errorf("Invalid NAME_MIN_LENGTH `%s`: %v", value, err)
+		}
+	}
+	if value, found := os.LookupEnv("NAME_MAX_LENGTH"); found {
+		rules.MaxLength, err = strconv.Atoi(value)
+		if err != nil {
+			return rules, fmt.Errorf("Invalid NAME_MAX_LENGTH `%s`: %v", value, err)
+		}
+	}
+	if value, found := os.LookupEnv("NAME_ALLOWED_PUNCTUATION"); found {
+		rules.AllowedPunctuation = value
+	}
+	if value, found := os.LookupEnv("NAME_RESERVED"); found {
+		rules.Reserved = []string{}
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				rules.Reserved = append(rules.Reserved, name)
+			}
+		}
+	}
+	// Otherwise no name could ever pass, and nobody would find out until they tried one.
+	if rules.MinLength > rules.MaxLength {
+		return rules, fmt.Errorf("Invalid NAME_MIN_LENGTH `%d`: can't be more than NAME_MAX_LENGTH `%d`", rules.MinLength, rules.MaxLength)
+	}
+	return rules, nil
+}
+
+// Keep accounts in `ACCOUNTS_FILE` if one is given, otherwise they only last as long as the server does.
+//	`REQUIRE_LOGIN=true` keeps everyone out of the rooms until they've logged in.
+func configureAccountsFromEnv() error {
+	if path := os.Getenv("ACCOUNTS_FILE"); path != "" {
+		store, err := accounts.NewFileStore(path)
 		if err != nil {
 			return err
 		}
+		clients.Accounts = store
+		log.Printf("Loaded accounts from %s", path)
+	}
+	if value := os.Getenv("REQUIRE_LOGIN"); value != "" {
+		requireLogin, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("Invalid REQUIRE_LOGIN `%s`: %v", value, err)
+		}
+		clients.RequireLogin = requireLogin
+	}
+	return nil
+}
 
-		// If we fail to generate a client when the user connects log and close the connection, letting them try again.
-		//	Keep the server going though to continue listening.
-		err = clients.GenerateNewClient(conn, cache)
+// Every client can have up to `OUTBOUND_QUEUE_SIZE` messages waiting to go out to them, and once they have that many
+//	`OUTBOUND_QUEUE_POLICY` decides whether the oldest are dropped (`drop-oldest`) or they're hung up on (`disconnect`).
+func configureQueueFromEnv() error {
+	if value := os.Getenv("OUTBOUND_QUEUE_SIZE"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err == nil && size < 1 {
+			err = fmt.Errorf("must be at least 1")
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid OUTBOUND_QUEUE_SIZE `%s`: %v", value, err)
+		}
+		clients.OutboundQueueSize = size
+	}
+	if value := os.Getenv("OUTBOUND_QUEUE_POLICY"); value != "" {
+		policy, err := clients.ParseQueuePolicy(value)
 		if err != nil {
-			log.Println(err)
-			conn.Close()
+			return fmt.Errorf("Invalid OUTBOUND_QUEUE_POLICY `%s`: %v", value, err)
 		}
+		clients.OutboundQueuePolicy = policy
 	}
+	return nil
 }
 
-// This should create a thread-safe cache so we should be about to pound it with go routines all we want.
-func NewChatCache() *cache2.Cache {
-	c := cache2.New(cache2.NoExpiration, cache2.NoExpiration)
-	c.Set(clients.CLIENTS, map[string]*clients.Client{}, cache2.NoExpiration)
-	c.Set(clients.ROOMS, map[string][]*clients.Client{}, cache2.NoExpiration)
-	return c
+// Greet everyone with the message of the day in `MOTD_FILE`, if there is one.
+func configureMOTDFromEnv() error {
+	path := os.Getenv("MOTD_FILE")
+	if path == "" {
+		return nil
+	}
+	motd := &clients.MOTD{Path: path}
+	err := motd.Load()
+	if err != nil {
+		return err
+	}
+	clients.MessageOfTheDay = motd
+	return nil
+}
+
+// Re-read anything that can change without a restart, which for now is just the message of the day.  Anything that
+//	goes wrong is logged and the old settings are kept, so the server carries on regardless.
+func (s *Server) Reload() {
+	if clients.MessageOfTheDay.Path == "" {
+		return
+	}
+	err := clients.MessageOfTheDay.Load()
+	if err != nil {
+		log.Printf("Unable to reload: %v", err)
+		return
+	}
+	log.Printf("Reloaded the message of the day from %s", clients.MessageOfTheDay.Path)
+}
+
+// Seed the store with the persistent rooms in `ROOMS_FILE`, if there is one.
+func configureRoomsFromEnv(store clients.ChatStore) error {
+	path := os.Getenv("ROOMS_FILE")
+	if path == "" {
+		return nil
+	}
+	err := clients.LoadRooms(path, store)
+	if err != nil {
+		return err
+	}
+	log.Printf("Loaded rooms from %s", path)
+	return nil
+}
+
+// Each room keeps its last `HISTORY_SIZE` messages, written to `HISTORY_FILE` if one is given so they survive a
+//	restart.  `HISTORY_REPLAY` of them are replayed to anyone joining the room, and `0` turns that off.
+func configureHistoryFromEnv() error {
+	size := history.DEFAULT_SIZE
+	if value := os.Getenv("HISTORY_SIZE"); value != "" {
+		var err error
+		size, err = strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("Invalid HISTORY_SIZE `%s`: %v", value, err)
+		}
+	}
+	if value := os.Getenv("HISTORY_REPLAY"); value != "" {
+		replay, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("Invalid HISTORY_REPLAY `%s`: %v", value, err)
+		}
+		clients.HistoryReplay = replay
+	}
+	if path := os.Getenv("HISTORY_FILE"); path != "" {
+		store, err := history.NewFileStore(path, size)
+		if err != nil {
+			return err
+		}
+		clients.History = store
+		log.Printf("Loaded message history from %s", path)
+		return nil
+	}
+	clients.History = history.NewMemoryStore(size)
+	return nil
 }
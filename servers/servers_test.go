@@ -2,14 +2,21 @@ package servers_test
 
 import (
 	"bou.ke/monkey"
+	"chat-telnet/accounts"
 	"chat-telnet/clients"
+	"chat-telnet/events"
+	"chat-telnet/history"
 	"chat-telnet/interfaces"
 	"chat-telnet/mocks"
 	"chat-telnet/servers"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -53,26 +60,26 @@ func Test_Start_success(t *testing.T) {
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 
-	patchCalled := false
-	monkey.Patch(clients.GenerateNewClient, func(conn interfaces.AbstractNetConn, cache interfaces.AbstractCache) error {
+	// Counted atomically, since the patch runs on the accept loop's go routine while the test reads it on its own.
+	var patchCalled int32
+	monkey.Patch(clients.GenerateNewClient, func(conn interfaces.AbstractNetConn, store clients.ChatStore) error {
 		// This gets called in a loop that would, in real life hang, waiting for a connection.  So we'll hit the wg
 		//a bunch of times before we finish waiting.  So just make sure we hit it at LEAST once, and simulate
 		//the "hang" below.
-		if !patchCalled {
+		if atomic.AddInt32(&patchCalled, 1) == 1 {
 			wg.Done()
 		}
-		patchCalled = true
 		time.Sleep(1 * time.Second)
 		return nil
 	})
-	defer monkey.Unpatch(net.Listen)
+	defer monkey.Unpatch(clients.GenerateNewClient)
 
 	go m.Start()
 	wg.Wait()
 	m.Close()
 
 	assert.True(t, l.AcceptCalled)
-	assert.True(t, patchCalled)
+	assert.NotZero(t, atomic.LoadInt32(&patchCalled))
 }
 
 func Test_Start_Accept_raises_error(t *testing.T) {
@@ -92,19 +99,19 @@ func Test_Start_GenerateNewClient_raises_error(t *testing.T) {
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 
-	patchCalled := false
-	monkey.Patch(clients.GenerateNewClient, func(conn interfaces.AbstractNetConn, cache interfaces.AbstractCache) error {
+	// Counted atomically, since the patch runs on the accept loop's go routine while the test reads it on its own.
+	var patchCalled int32
+	monkey.Patch(clients.GenerateNewClient, func(conn interfaces.AbstractNetConn, store clients.ChatStore) error {
 		// This gets called in a loop that would, in real life hang, waiting for a connection.  So we'll hit the wg
 		//a bunch of times before we finish waiting.  So just make sure we hit it at LEAST once, and simulate
 		//the "hang" below.
-		if !patchCalled {
+		if atomic.AddInt32(&patchCalled, 1) == 1 {
 			wg.Done()
 		}
-		patchCalled = true
 		time.Sleep(1 * time.Second)
 		return fmt.Errorf("boom")
 	})
-	defer monkey.Unpatch(net.Listen)
+	defer monkey.Unpatch(clients.GenerateNewClient)
 
 	l := &mocks.NetListenerMock{}
 	m := servers.Server{
@@ -115,6 +122,297 @@ func Test_Start_GenerateNewClient_raises_error(t *testing.T) {
 	wg.Wait()
 	m.Close()
 
-	assert.True(t, patchCalled)
+	assert.NotZero(t, atomic.LoadInt32(&patchCalled))
+	assert.True(t, l.CloseCalled)
+}
+
+func Test_NewServer_invalid_grace_period(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+	os.Setenv("SHUTDOWN_GRACE_PERIOD", "whenever")
+	defer os.Unsetenv("SHUTDOWN_GRACE_PERIOD")
+
+	_, err := servers.NewServer()
+
+	assert.Equal(t, "Invalid SHUTDOWN_GRACE_PERIOD `whenever`: time: invalid duration \"whenever\"", fmt.Sprint(err))
+}
+
+func Test_NewServer_grace_period_from_env(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+	os.Setenv("SHUTDOWN_GRACE_PERIOD", "2s")
+	defer os.Unsetenv("SHUTDOWN_GRACE_PERIOD")
+
+	s, err := servers.NewServer()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2*time.Second, s.GracePeriod)
+}
+
+func Test_Shutdown_success(t *testing.T) {
+	l := &mocks.NetListenerMock{}
+	m := servers.Server{
+		Listener: l,
+		Store:    servers.NewChatStore(),
+	}
+	patchCalled := false
+	monkey.Patch(clients.DisconnectAll, func(store clients.ChatStore, gracePeriod time.Duration) {
+		patchCalled = true
+	})
+	defer monkey.Unpatch(clients.DisconnectAll)
+	defer func(bus *events.Bus) { clients.Events = bus }(clients.Events)
+	clients.Events = events.NewBus()
+	published := []events.Kind{}
+	clients.Events.Subscribe(func(event events.Event) { published = append(published, event.Kind) })
+
+	m.Shutdown()
+
 	assert.True(t, l.CloseCalled)
+	assert.True(t, patchCalled)
+	assert.Equal(t, []events.Kind{events.Shutdown}, published)
+}
+
+func Test_Start_returns_nil_after_Shutdown(t *testing.T) {
+	closed := make(chan struct{})
+	l := &mocks.NetListenerMock{}
+	l.AcceptMock = func() (net.Conn, error) {
+		<-closed
+		return nil, fmt.Errorf("use of closed network connection")
+	}
+	l.CloseMock = func() error {
+		close(closed)
+		return nil
+	}
+	m := servers.Server{
+		Listener: l,
+		Store:    servers.NewChatStore(),
+	}
+
+	errs := make(chan error)
+	go func() {
+		errs <- m.Start()
+	}()
+	m.Shutdown()
+
+	assert.Nil(t, <-errs)
+}
+
+func Test_NewServer_name_rules_from_env(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+	defer func(rules clients.NamePolicy) { clients.NameRules = rules }(clients.NameRules)
+	os.Setenv("NAME_MAX_LENGTH", "12")
+	defer os.Unsetenv("NAME_MAX_LENGTH")
+	os.Setenv("NAME_RESERVED", "vader, palpatine")
+	defer os.Unsetenv("NAME_RESERVED")
+
+	_, err := servers.NewServer()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, clients.NameRules.MinLength)
+	assert.Equal(t, 12, clients.NameRules.MaxLength)
+	assert.Equal(t, []string{"vader", "palpatine"}, clients.NameRules.Reserved)
+}
+
+func Test_NewServer_invalid_name_rules(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+	defer func(rules clients.NamePolicy) { clients.NameRules = rules }(clients.NameRules)
+	os.Setenv("NAME_MIN_LENGTH", "short")
+	defer os.Unsetenv("NAME_MIN_LENGTH")
+
+	_, err := servers.NewServer()
+
+	assert.Equal(t, "Invalid NAME_MIN_LENGTH `short`: strconv.Atoi: parsing \"short\": invalid syntax", fmt.Sprint(err))
+
+	setEnv(t, "NAME_MIN_LENGTH", "20")
+	setEnv(t, "NAME_MAX_LENGTH", "12")
+
+	_, err = servers.NewServer()
+
+	assert.Equal(t, "Invalid NAME_MIN_LENGTH `20`: can't be more than NAME_MAX_LENGTH `12`", fmt.Sprint(err))
+}
+
+func Test_NewServer_accounts_from_env(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+	defer func(store accounts.Store, requireLogin bool) {
+		clients.Accounts = store
+		clients.RequireLogin = requireLogin
+	}(clients.Accounts, clients.RequireLogin)
+	dir, _ := ioutil.TempDir("", "accounts")
+	defer os.RemoveAll(dir)
+	os.Setenv("ACCOUNTS_FILE", filepath.Join(dir, "accounts.json"))
+	defer os.Unsetenv("ACCOUNTS_FILE")
+	os.Setenv("REQUIRE_LOGIN", "true")
+	defer os.Unsetenv("REQUIRE_LOGIN")
+
+	_, err := servers.NewServer()
+
+	assert.Nil(t, err)
+	assert.IsType(t, &accounts.FileStore{}, clients.Accounts)
+	assert.True(t, clients.RequireLogin)
+}
+
+func Test_NewServer_invalid_require_login(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+	os.Setenv("REQUIRE_LOGIN", "sometimes")
+	defer os.Unsetenv("REQUIRE_LOGIN")
+
+	_, err := servers.NewServer()
+
+	assert.Equal(t, "Invalid REQUIRE_LOGIN `sometimes`: strconv.ParseBool: parsing \"sometimes\": invalid syntax", fmt.Sprint(err))
+}
+
+func Test_NewServer_history_from_env(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+	defer func(store history.Store, replay int) {
+		clients.History = store
+		clients.HistoryReplay = replay
+	}(clients.History, clients.HistoryReplay)
+	dir, _ := ioutil.TempDir("", "history")
+	defer os.RemoveAll(dir)
+	os.Setenv("HISTORY_FILE", filepath.Join(dir, "history.jsonl"))
+	defer os.Unsetenv("HISTORY_FILE")
+	os.Setenv("HISTORY_SIZE", "50")
+	defer os.Unsetenv("HISTORY_SIZE")
+	os.Setenv("HISTORY_REPLAY", "0")
+	defer os.Unsetenv("HISTORY_REPLAY")
+
+	_, err := servers.NewServer()
+
+	assert.Nil(t, err)
+	assert.IsType(t, &history.FileStore{}, clients.History)
+	assert.Equal(t, 50, clients.History.(*history.FileStore).Size)
+	assert.Equal(t, 0, clients.HistoryReplay)
+}
+
+func Test_NewServer_invalid_history_size(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+	os.Setenv("HISTORY_SIZE", "lots")
+	defer os.Unsetenv("HISTORY_SIZE")
+
+	_, err := servers.NewServer()
+
+	assert.Equal(t, "Invalid HISTORY_SIZE `lots`: strconv.Atoi: parsing \"lots\": invalid syntax", fmt.Sprint(err))
+}
+
+func Test_NewServer_seeds_rooms_from_file(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+	dir, _ := ioutil.TempDir("", "rooms")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rooms.json")
+	ioutil.WriteFile(path, []byte(`[{"name": "lobby", "topic": "Say hi!"}, {"name": "ops", "mode": "unlisted"}]`), 0600)
+	os.Setenv("ROOMS_FILE", path)
+	defer os.Unsetenv("ROOMS_FILE")
+
+	s, err := servers.NewServer()
+
+	assert.Nil(t, err)
+	rooms := s.Store.ListRooms()
+	assert.Equal(t, map[string][]*clients.Client{"lobby": {}, "ops": {}}, rooms)
+	lobby, _ := s.Store.Moderation("lobby")
+	assert.True(t, lobby.Persistent)
+	assert.Equal(t, "Say hi!", lobby.Topic)
+}
+
+func Test_NewServer_missing_rooms_file(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+	os.Setenv("ROOMS_FILE", "/nowhere/rooms.json")
+	defer os.Unsetenv("ROOMS_FILE")
+
+	_, err := servers.NewServer()
+
+	assert.Equal(t, "Unable to read rooms file /nowhere/rooms.json: open /nowhere/rooms.json: no such file or directory", fmt.Sprint(err))
+}
+
+func Test_NewServer_MOTD_from_env_and_reload(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+	defer func(motd *clients.MOTD) { clients.MessageOfTheDay = motd }(clients.MessageOfTheDay)
+	dir, _ := ioutil.TempDir("", "motd")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "motd.txt")
+	ioutil.WriteFile(path, []byte("Welcome!"), 0600)
+	os.Setenv("MOTD_FILE", path)
+	defer os.Unsetenv("MOTD_FILE")
+
+	s, err := servers.NewServer()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Welcome!", clients.MessageOfTheDay.Message())
+	ioutil.WriteFile(path, []byte("Welcome back!"), 0600)
+	s.Reload()
+	assert.Equal(t, "Welcome back!", clients.MessageOfTheDay.Message())
+}
+
+func Test_NewServer_outbound_queue_from_env(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+	defer func(size int, policy clients.QueuePolicy) {
+		clients.OutboundQueueSize = size
+		clients.OutboundQueuePolicy = policy
+	}(clients.OutboundQueueSize, clients.OutboundQueuePolicy)
+	os.Setenv("OUTBOUND_QUEUE_SIZE", "16")
+	defer os.Unsetenv("OUTBOUND_QUEUE_SIZE")
+	os.Setenv("OUTBOUND_QUEUE_POLICY", "disconnect")
+	defer os.Unsetenv("OUTBOUND_QUEUE_POLICY")
+
+	_, err := servers.NewServer()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 16, clients.OutboundQueueSize)
+	assert.Equal(t, clients.DisconnectSlow, clients.OutboundQueuePolicy)
+}
+
+func Test_NewServer_invalid_outbound_queue(t *testing.T) {
+	monkey.Patch(net.Listen, func(a, b string) (net.Listener, error) {
+		return &mocks.NetListenerMock{}, nil
+	})
+	defer monkey.Unpatch(net.Listen)
+
+	var tests = []struct {
+		key      string
+		value    string
+		expected string
+	}{
+		{"OUTBOUND_QUEUE_SIZE", "0", "Invalid OUTBOUND_QUEUE_SIZE `0`: must be at least 1"},
+		{"OUTBOUND_QUEUE_SIZE", "lots", "Invalid OUTBOUND_QUEUE_SIZE `lots`: strconv.Atoi: parsing \"lots\": invalid syntax"},
+		{"OUTBOUND_QUEUE_POLICY", "block", "Invalid OUTBOUND_QUEUE_POLICY `block`: must be one of: drop-oldest, disconnect"},
+	}
+	for _, tt := range tests {
+		os.Setenv(tt.key, tt.value)
+		_, err := servers.NewServer()
+		os.Unsetenv(tt.key)
+		assert.Equal(t, tt.expected, fmt.Sprint(err), tt.value)
+	}
 }
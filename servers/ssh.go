@@ -0,0 +1,261 @@
+package servers
+
+import (
+	"bytes"
+	"chat-telnet/clients"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// How long a client gets to finish the SSH handshake before we give up on them.
+var SSH_HANDSHAKE_TIMEOUT = 10 * time.Second
+
+// Where the fingerprint of the key a client authenticated with is kept in their connection's permissions.
+const sshFingerprint = "fingerprint"
+
+// Build the SSH config from the host key in `SSH_HOST_KEY_FILE` if `SSH_PORT` is set, returning nil when it isn't.
+func sshConfigFromEnv() (*ssh.ServerConfig, error) {
+	if os.Getenv("SSH_PORT") == "" {
+		return nil, nil
+	}
+	keyFile := os.Getenv("SSH_HOST_KEY_FILE")
+	if keyFile == "" {
+		return nil, fmt.Errorf("SSH_PORT needs SSH_HOST_KEY_FILE to be set")
+	}
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	hostKey, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid SSH host key `%s`: %v", keyFile, err)
+	}
+	return NewSSHConfig(hostKey), nil
+}
+
+// Any public key gets in, since who a client is gets worked out from their key once they're through - see
+//	`clients.GenerateSSHClient`.  The key's fingerprint is only handed on once the client has proven they hold it.
+func NewSSHConfig(hostKey ssh.Signer) *ssh.ServerConfig {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return &ssh.Permissions{Extensions: map[string]string{sshFingerprint: ssh.FingerprintSHA256(key)}}, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+	return config
+}
+
+// The handshake happens off the accept loop, the same as TLS, so someone who connects and never says anything can't
+//	hold up everyone else.
+func (s *Server) acceptSSH(conn net.Conn) {
+	go s.serveSSH(conn)
+}
+
+func (s *Server) serveSSH(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(SSH_HANDSHAKE_TIMEOUT))
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, s.SSHConfig)
+	if err != nil {
+		log.Printf("SSH handshake with %s failed: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			log.Printf("Unable to accept SSH session from %s: %v", conn.RemoteAddr(), err)
+			continue
+		}
+		go s.serveSSHSession(sshConn, channel, channelRequests)
+	}
+}
+
+// Each session becomes a client once it asks for a shell.  Before that it can ask for a terminal, and once it has one
+//	it keeps telling us whenever the window changes size.  Running commands, setting the environment and everything
+//	else are turned down.
+func (s *Server) serveSSHSession(sshConn *ssh.ServerConn, channel ssh.Channel, requests <-chan *ssh.Request) {
+	conn := &SSHConn{channel: channel, remoteAddr: sshConn.RemoteAddr()}
+	started := false
+	for req := range requests {
+		ok := false
+		switch req.Type {
+		case "pty-req":
+			var pty struct {
+				Term                                   string
+				Width, Height, PixelWidth, PixelHeight uint32
+				Modes                                  string
+			}
+			if !started && ssh.Unmarshal(req.Payload, &pty) == nil {
+				conn.pty = true
+				conn.setWidth(pty.Width)
+				ok = true
+			}
+		case "window-change":
+			var size struct{ Width, Height, PixelWidth, PixelHeight uint32 }
+			if ssh.Unmarshal(req.Payload, &size) == nil {
+				conn.setWidth(size.Width)
+				ok = true
+			}
+		case "shell":
+			ok = !started
+		}
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+		if req.Type != "shell" || !ok {
+			continue
+		}
+
+		started = true
+		err := clients.GenerateSSHClient(conn, s.Store, sshConn.User(), sshConn.Permissions.Extensions[sshFingerprint])
+		if err != nil {
+			log.Println(err)
+			conn.Close()
+		}
+	}
+}
+
+// Where `SSHConn` is in skipping over an escape sequence, like the ones the arrow keys send.
+const (
+	escapeNone = iota
+	escapeStart
+	escapeSequence
+)
+
+// SSHConn adapts a session's channel to a connection the clients can use.  With a terminal there's nobody but us to
+//	echo what's typed or handle backspace, so we do just enough of that to put together a line at a time, and turn
+//	newlines into the carriage return and newline the terminal expects.  Without one it's passed straight through.
+//	There's no read deadline on a channel, so SSH clients are never disconnected for being idle.
+type SSHConn struct {
+	channel    ssh.Channel
+	remoteAddr net.Addr
+	pty        bool // Only set before the client starts reading.
+	writeMu    sync.Mutex
+	line       []byte
+	lines      []byte // Finished lines, waiting to be read.
+	escape     int
+	afterCR    bool
+	sizeMu     sync.Mutex
+	width      int
+}
+
+func (c *SSHConn) Read(b []byte) (int, error) {
+	if !c.pty {
+		return c.channel.Read(b)
+	}
+	buf := make([]byte, 256)
+	for len(c.lines) == 0 {
+		n, err := c.channel.Read(buf)
+		if n > 0 && !c.edit(buf[:n]) {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, c.lines)
+	c.lines = c.lines[n:]
+	return n, nil
+}
+
+// Work what was typed into the line, echoing it back as we go.  Ctrl-C or Ctrl-D mean the client is done.
+func (c *SSHConn) edit(input []byte) bool {
+	echo := []byte{}
+	defer func() {
+		if len(echo) > 0 {
+			c.write(echo)
+		}
+	}()
+	for _, b := range input {
+		afterCR := c.afterCR
+		c.afterCR = b == '\r'
+		switch {
+		case c.escape == escapeStart:
+			c.escape = escapeNone
+			if b == '[' || b == 'O' {
+				c.escape = escapeSequence
+			}
+		case c.escape == escapeSequence:
+			if b >= 0x40 && b <= 0x7e {
+				c.escape = escapeNone
+			}
+		case b == 0x1b:
+			c.escape = escapeStart
+		case b == 0x03 || b == 0x04:
+			return false
+		case b == '\n' && afterCR:
+			// Terminals send a carriage return for Enter, which some follow with a newline.
+		case b == '\r' || b == '\n':
+			echo = append(echo, '\r', '\n')
+			c.lines = append(append(c.lines, c.line...), '\n')
+			c.line = c.line[:0]
+		case b == 0x7f || b == '\b':
+			if len(c.line) == 0 {
+				continue
+			}
+			_, size := utf8.DecodeLastRune(c.line)
+			c.line = c.line[:len(c.line)-size]
+			echo = append(echo, '\b', ' ', '\b')
+		case b < 0x20:
+			// Tabs, NULs and the rest of the control characters have no place in a chat message.
+		default:
+			c.line = append(c.line, b)
+			echo = append(echo, b)
+		}
+	}
+	return true
+}
+
+func (c *SSHConn) Write(b []byte) (int, error) {
+	if !c.pty {
+		return c.write(b)
+	}
+	_, err := c.write(bytes.ReplaceAll(b, []byte("\n"), []byte("\r\n")))
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *SSHConn) write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.channel.Write(b)
+}
+
+// Let the client know the session is over, the way it would hear about a shell exiting.
+func (c *SSHConn) Close() error {
+	c.channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+	return c.channel.Close()
+}
+
+func (c *SSHConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// How wide the client's terminal is, or 0 if they didn't ask for one.
+func (c *SSHConn) TerminalWidth() int {
+	c.sizeMu.Lock()
+	defer c.sizeMu.Unlock()
+	return c.width
+}
+
+func (c *SSHConn) setWidth(width uint32) {
+	c.sizeMu.Lock()
+	defer c.sizeMu.Unlock()
+	c.width = int(width)
+}
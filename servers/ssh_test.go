@@ -0,0 +1,209 @@
+package servers_test
+
+import (
+	"bufio"
+	"chat-telnet/accounts"
+	"chat-telnet/clients"
+	"chat-telnet/servers"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Give the test its own accounts, so the keys it registers don't leak into anything else.
+func useSSHAccounts(t *testing.T) {
+	previous := clients.Accounts
+	clients.Accounts = accounts.NewMemoryStore()
+	t.Cleanup(func() { clients.Accounts = previous })
+}
+
+func newSSHSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.Nil(t, err)
+	return signer
+}
+
+func startSSHServer(t *testing.T) *servers.Server {
+	useSSHAccounts(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	sl, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := &servers.Server{
+		Listener:    l,
+		SSHListener: sl,
+		SSHConfig:   servers.NewSSHConfig(newSSHSigner(t)),
+		Store:       servers.NewChatStore(),
+	}
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+type sshSession struct {
+	*ssh.Session
+	stdin io.Writer
+	out   *bufio.Reader
+}
+
+// Connect as `user` with the key and start a shell, with a terminal if `pty` is set.
+func dialSSH(t *testing.T, addr, user string, key ssh.Signer, pty bool) *sshSession {
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(key)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { client.Close() })
+	session, err := client.NewSession()
+	assert.Nil(t, err)
+	stdin, _ := session.StdinPipe()
+	stdout, _ := session.StdoutPipe()
+	if pty {
+		assert.Nil(t, session.RequestPty("xterm", 24, 100, ssh.TerminalModes{}))
+	}
+	assert.Nil(t, session.Shell())
+	return &sshSession{session, stdin, bufio.NewReader(stdout)}
+}
+
+// Keep reading lines from the session until one of them contains `expected`.
+func readSSHUntil(t *testing.T, s *sshSession, expected string) string {
+	found := make(chan string, 1)
+	go func() {
+		for {
+			line, err := s.out.ReadString('\n')
+			if err != nil || strings.Contains(line, expected) {
+				found <- line
+				return
+			}
+		}
+	}()
+	select {
+	case line := <-found:
+		assert.Contains(t, line, expected)
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting on %q", expected)
+		return ""
+	}
+}
+
+func Test_SSH_key_keeps_its_name(t *testing.T) {
+	s := startSSHServer(t)
+	addr := s.SSHListener.Addr().String()
+	key := newSSHSigner(t)
+
+	han := dialSSH(t, addr, "Han", key, true)
+	line := readSSHUntil(t, han, "Your SSH key is now registered to `Han`")
+	assert.True(t, strings.HasSuffix(line, "\r\n"))
+	// Typos get backspaced over, arrow keys are ignored and everything is echoed back as it's typed.
+	fmt.Fprint(han.stdin, "\\whoamx\x7fi\x1b[A\r")
+	assert.Equal(t, "\\whoamx\b \bi\r\n", readSSHUntil(t, han, "\\whoam"))
+	readSSHUntil(t, han, "Client Name: Han\r\n")
+
+	// The key is already online under its name, so a second session has to make do with a guest name.
+	again := dialSSH(t, addr, "someone-else", key, true)
+	readSSHUntil(t, again, "NOTE: `Han` is already online, so your user name has been set to `guest-")
+
+	fmt.Fprint(han.stdin, "\x04")
+	assert.Nil(t, han.Wait())
+	back := dialSSH(t, addr, "someone-else", key, false)
+	readSSHUntil(t, back, "You're logged in as `Han` with your SSH key.")
+	assert.False(t, clients.Accounts.Exists("someone-else"))
+}
+
+func Test_SSH_name_already_registered(t *testing.T) {
+	s := startSSHServer(t)
+	addr := s.SSHListener.Addr().String()
+	dialSSH(t, addr, "Han", newSSHSigner(t), false)
+
+	greedo := dialSSH(t, addr, "han", newSSHSigner(t), false)
+	line := readSSHUntil(t, greedo, "NOTE: Your SSH key isn't registered to a name yet")
+
+	assert.Contains(t, line, "`han` is already")
+	// Without a terminal, nothing gets echoed or has its newlines changed.
+	assert.False(t, strings.HasSuffix(line, "\r\n"))
+	fmt.Fprint(greedo.stdin, "\\whoami\n")
+	readSSHUntil(t, greedo, "Client Name: guest-")
+}
+
+func Test_SSH_rejects_unknown_requests(t *testing.T) {
+	s := startSSHServer(t)
+	client, err := ssh.Dial("tcp", s.SSHListener.Addr().String(), &ssh.ClientConfig{
+		User:            "Han",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(newSSHSigner(t))},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	assert.Nil(t, err)
+
+	assert.NotNil(t, session.Run("rm -rf /"))
+	_, err = client.Dial("tcp", "127.0.0.1:22")
+	assert.NotNil(t, err)
+	assert.False(t, clients.Accounts.Exists("Han"))
+}
+
+func Test_SSH_rejects_passwords(t *testing.T) {
+	s := startSSHServer(t)
+
+	_, err := ssh.Dial("tcp", s.SSHListener.Addr().String(), &ssh.ClientConfig{
+		User:            "Han",
+		Auth:            []ssh.AuthMethod{ssh.Password("kessel-run")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+
+	assert.Contains(t, fmt.Sprint(err), "unable to authenticate")
+}
+
+func Test_NewServer_ssh_from_env(t *testing.T) {
+	useSSHAccounts(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	keyFile := filepath.Join(t.TempDir(), "ssh_host_key")
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	setEnv(t, "PORT", "0")
+	setEnv(t, "SSH_PORT", "0")
+	setEnv(t, "SSH_HOST_KEY_FILE", keyFile)
+	s := startTLSServer(t)
+
+	leia := dialSSH(t, localAddr(s.SSHListener), "Leia", newSSHSigner(t), false)
+
+	readSSHUntil(t, leia, "Your SSH key is now registered to `Leia`")
+}
+
+func Test_NewServer_invalid_ssh_config(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "ssh_host_key")
+	ioutil.WriteFile(keyFile, []byte("not a key"), 0600)
+	setEnv(t, "SSH_PORT", "0")
+
+	_, err := servers.NewServer()
+	assert.Equal(t, "SSH_PORT needs SSH_HOST_KEY_FILE to be set", fmt.Sprint(err))
+
+	setEnv(t, "SSH_HOST_KEY_FILE", keyFile)
+	_, err = servers.NewServer()
+	assert.Equal(t, fmt.Sprintf("Invalid SSH host key `%s`: ssh: no key found", keyFile), fmt.Sprint(err))
+}
@@ -0,0 +1,234 @@
+package servers
+
+import (
+	"bytes"
+	"chat-telnet/interfaces"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// The bits of the telnet protocol (RFC 854) we need to understand, or at least recognise well enough to throw away.
+const (
+	telnetSE   byte = 240 // End of subnegotiation.
+	telnetSB   byte = 250 // Start of subnegotiation.
+	telnetWILL byte = 251
+	telnetWONT byte = 252
+	telnetDO   byte = 253
+	telnetDONT byte = 254
+	telnetIAC  byte = 255 // "Interpret as command" - everything between these and the end of the command isn't text.
+
+	telnetECHO byte = 1  // RFC 857
+	telnetSGA  byte = 3  // Suppress go ahead, RFC 858
+	telnetNAWS byte = 31 // Negotiate about window size, RFC 1073
+)
+
+// Subnegotiations we care about are only a few bytes long, so anything longer than this is just thrown away.
+const maxSubnegotiation = 64
+
+// Where the parser is up to in the stream, which can split a command across any number of reads.
+type telnetState int
+
+const (
+	stateData telnetState = iota
+	stateIAC
+	stateOption
+	stateSubnegotiation
+	stateSubnegotiationIAC
+)
+
+// How far an option has got, on either side of the connection.
+type optionState int
+
+const (
+	optionOff optionState = iota
+	optionAsked
+	optionOn
+)
+
+// TelnetConn wraps a connection from a telnet client, stripping the option negotiation (the `IAC` sequences) out of
+//	everything read so `listen` only ever sees the text that was typed, and answering it as it goes.  We stay in line
+//	mode, letting the client echo and edit the line itself, so `ECHO` and `SGA` are refused on our side.  The client
+//	is asked for `NAWS` so we can learn how wide their terminal is.
+type TelnetConn struct {
+	conn    interfaces.AbstractNetConn
+	writeMu sync.Mutex // Negotiation is answered from `Read`, while messages are written from the client's outbox.
+
+	// Only touched from `Read`, which there's only ever one of at a time.
+	state  telnetState
+	verb   byte
+	sb     []byte
+	remote map[byte]optionState // What we've asked or agreed for the client to do.
+
+	sizeMu sync.Mutex
+	width  int
+	height int
+}
+
+func NewTelnetConn(conn interfaces.AbstractNetConn) *TelnetConn {
+	return &TelnetConn{
+		conn:   conn,
+		remote: map[byte]optionState{},
+	}
+}
+
+// Open the negotiation by asking the client for their window size.  Clients that don't speak telnet (ex. netcat) will
+//	see a few stray characters, and never answer.
+func (c *TelnetConn) Negotiate() error {
+	c.remote[telnetNAWS] = optionAsked
+	return c.command(telnetDO, telnetNAWS)
+}
+
+func (c *TelnetConn) Read(b []byte) (int, error) {
+	for {
+		n, err := c.conn.Read(b)
+		n = c.strip(b[:n])
+		// A read that was nothing but negotiation has no text for the caller, so wait for some.
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// Filter the telnet commands out of `b` in place, handling each one as it's found, and answer how much text is left.
+func (c *TelnetConn) strip(b []byte) int {
+	n := 0
+	for _, ch := range b {
+		switch c.state {
+		case stateData:
+			if ch == telnetIAC {
+				c.state = stateIAC
+			} else if ch != 0 { // Telnet sends a bare carriage return as `\r\0`.
+				b[n] = ch
+				n++
+			}
+		case stateIAC:
+			c.state = stateData
+			switch ch {
+			case telnetIAC: // An escaped 255 is just text.
+				b[n] = ch
+				n++
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				c.verb = ch
+				c.state = stateOption
+			case telnetSB:
+				c.sb = c.sb[:0]
+				c.state = stateSubnegotiation
+			}
+			// Anything else (ex. a go ahead, or an interrupt) has no meaning in a chat, so it's dropped.
+		case stateOption:
+			c.state = stateData
+			c.negotiate(c.verb, ch)
+		case stateSubnegotiation:
+			if ch == telnetIAC {
+				c.state = stateSubnegotiationIAC
+			} else if len(c.sb) < maxSubnegotiation {
+				c.sb = append(c.sb, ch)
+			}
+		case stateSubnegotiationIAC:
+			if ch == telnetIAC {
+				c.state = stateSubnegotiation
+				if len(c.sb) < maxSubnegotiation {
+					c.sb = append(c.sb, ch)
+				}
+				continue
+			}
+			// Should be the end of the subnegotiation, and if it isn't the client has lost track, so call it one anyway.
+			c.state = stateData
+			c.subnegotiation(c.sb)
+		}
+	}
+	return n
+}
+
+// Answer an option request, only replying when it changes something so the two sides never loop (RFC 854 and 1143).
+func (c *TelnetConn) negotiate(verb, option byte) {
+	switch verb {
+	case telnetDO:
+		// There's nothing we're willing to do on our side - we don't echo, and we leave line editing to the client.
+		//	Since we never agree to anything, a `DONT` never needs answering either.
+		c.command(telnetWONT, option)
+	case telnetWILL:
+		switch {
+		case c.remote[option] == optionAsked:
+			c.remote[option] = optionOn
+		case c.remote[option] == optionOn:
+		case option == telnetNAWS || option == telnetSGA:
+			c.remote[option] = optionOn
+			c.command(telnetDO, option)
+		default:
+			c.command(telnetDONT, option)
+		}
+	case telnetWONT:
+		state := c.remote[option]
+		c.remote[option] = optionOff
+		// A refusal of something we asked for needs no answer.
+		if state == optionOn {
+			c.command(telnetDONT, option)
+		}
+	}
+}
+
+func (c *TelnetConn) subnegotiation(sb []byte) {
+	// NAWS sends the width and height as two 16 bit numbers, and zero means the client doesn't know.
+	if len(sb) != 5 || sb[0] != telnetNAWS {
+		return
+	}
+	c.sizeMu.Lock()
+	defer c.sizeMu.Unlock()
+	c.width = int(binary.BigEndian.Uint16(sb[1:3]))
+	c.height = int(binary.BigEndian.Uint16(sb[3:5]))
+}
+
+func (c *TelnetConn) command(verb, option byte) error {
+	return c.write([]byte{telnetIAC, verb, option})
+}
+
+func (c *TelnetConn) write(b []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// Any 255 in the text would start a command on the client's side, so it's escaped by doubling it.
+func (c *TelnetConn) Write(b []byte) (int, error) {
+	err := c.write(bytes.ReplaceAll(b, []byte{telnetIAC}, []byte{telnetIAC, telnetIAC}))
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *TelnetConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *TelnetConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Pass deadlines through, so idle clients can still be timed out.
+func (c *TelnetConn) SetReadDeadline(t time.Time) error {
+	conn, ok := c.conn.(interface{ SetReadDeadline(time.Time) error })
+	if !ok {
+		return fmt.Errorf("connection doesn't support deadlines")
+	}
+	return conn.SetReadDeadline(t)
+}
+
+// How many columns wide the client's terminal is, or 0 if they haven't told us.
+func (c *TelnetConn) TerminalWidth() int {
+	c.sizeMu.Lock()
+	defer c.sizeMu.Unlock()
+	return c.width
+}
+
+// How many rows tall the client's terminal is, or 0 if they haven't told us.
+func (c *TelnetConn) TerminalHeight() int {
+	c.sizeMu.Lock()
+	defer c.sizeMu.Unlock()
+	return c.height
+}
@@ -0,0 +1,117 @@
+package servers_test
+
+import (
+	"bufio"
+	"chat-telnet/servers"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+const (
+	IAC  = 255
+	NOP  = 241
+	SB   = 250
+	SE   = 240
+	WILL = 251
+	WONT = 252
+	DO   = 253
+	DONT = 254
+	ECHO = 1
+	SGA  = 3
+	NAWS = 31
+)
+
+// Wrap one end of an in-memory pipe up as a telnet connection, handing back the other end for the client to use along
+//	with everything the server will end up sending back to it.
+func pipeTelnet(t *testing.T) (*servers.TelnetConn, net.Conn, chan []byte) {
+	server, client := net.Pipe()
+	sent := make(chan []byte, 1)
+	go func() {
+		data, _ := ioutil.ReadAll(client)
+		sent <- data
+	}()
+	t.Cleanup(func() { server.Close() })
+	return servers.NewTelnetConn(server), client, sent
+}
+
+func Test_TelnetConn_strips_negotiation(t *testing.T) {
+	conn, client, sent := pipeTelnet(t)
+	go func() {
+		// Split a command across writes, to make sure the parser keeps its place between reads.
+		client.Write([]byte{'h', 'e', IAC, WILL})
+		client.Write([]byte{NAWS, 'l', IAC, SB, NAWS, 0, 132, 0, 40, IAC, SE, 'l'})
+		client.Write([]byte{IAC, DO, ECHO, 'o', IAC, IAC, '\r', 0, '\n'})
+	}()
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	conn.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "hello\xff\r\n", line)
+	assert.Equal(t, 132, conn.TerminalWidth())
+	assert.Equal(t, 40, conn.TerminalHeight())
+	assert.Equal(t, []byte{IAC, DO, NAWS, IAC, WONT, ECHO}, <-sent)
+}
+
+func Test_TelnetConn_answers_only_once(t *testing.T) {
+	conn, client, sent := pipeTelnet(t)
+	go func() {
+		conn.Negotiate()
+		// Asked for, so it needs no answer, and neither does saying it again.
+		client.Write([]byte{IAC, WILL, NAWS, IAC, WILL, NAWS})
+		client.Write([]byte{IAC, WILL, SGA, IAC, WILL, SGA, IAC, WILL, ECHO})
+		client.Write([]byte{IAC, WONT, SGA, IAC, WONT, SGA, IAC, DO, SGA, IAC, DONT, SGA, '\n'})
+	}()
+
+	_, err := bufio.NewReader(conn).ReadString('\n')
+	conn.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		IAC, DO, NAWS,
+		IAC, DO, SGA,
+		IAC, DONT, ECHO,
+		IAC, DONT, SGA,
+		IAC, WONT, SGA,
+	}, <-sent)
+	assert.Equal(t, 0, conn.TerminalWidth())
+}
+
+func Test_TelnetConn_escapes_writes(t *testing.T) {
+	conn, _, sent := pipeTelnet(t)
+
+	n, err := conn.Write([]byte("a\xffb\n"))
+	conn.Close()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, []byte("a\xff\xffb\n"), <-sent)
+}
+
+func Test_TelnetConn_deadlines(t *testing.T) {
+	conn, _, _ := pipeTelnet(t)
+	conn.SetReadDeadline(time.Now().Add(-time.Second))
+
+	_, err := conn.Read(make([]byte, 10))
+
+	assert.Error(t, err)
+}
+
+// The negotiation never makes it into the chat, even through a real server.
+func Test_Telnet_server_round_trip(t *testing.T) {
+	s := startTestServer(t)
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	readTelnetUntil(t, conn, r, "If you'd like to reset it")
+
+	conn.Write([]byte{IAC, WILL, NAWS, IAC, SB, NAWS, 0, 100, 0, 30, IAC, SE})
+	conn.Write(append([]byte("\\name Lan"), IAC, NOP))
+	conn.Write([]byte("do\r\n"))
+
+	readTelnetUntil(t, conn, r, "has become -> Lando")
+}
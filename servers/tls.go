@@ -0,0 +1,73 @@
+package servers
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// How long a client gets to finish the TLS handshake before we give up on them.
+var TLS_HANDSHAKE_TIMEOUT = 10 * time.Second
+
+// Build the TLS config from `TLS_CERT_FILE` and `TLS_KEY_FILE` if `TLS_PORT` is set, returning nil when it isn't.
+//	`TLS_ONLY=true` turns the plaintext listener off, so passwords never cross the network in the clear.
+func tlsConfigFromEnv() (*tls.Config, bool, error) {
+	tlsOnly := false
+	if value := os.Getenv("TLS_ONLY"); value != "" {
+		var err error
+		tlsOnly, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, false, fmt.Errorf("Invalid TLS_ONLY `%s`: %v", value, err)
+		}
+	}
+	if os.Getenv("TLS_PORT") == "" {
+		if tlsOnly {
+			return nil, false, fmt.Errorf("TLS_ONLY is set but TLS_PORT isn't")
+		}
+		return nil, false, nil
+	}
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile == "" || keyFile == "" {
+		return nil, false, fmt.Errorf("TLS_PORT needs both TLS_CERT_FILE and TLS_KEY_FILE to be set")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, false, fmt.Errorf("Invalid TLS certificate `%s` or key `%s`: %v", certFile, keyFile, err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	return config, tlsOnly, nil
+}
+
+// The TLS listener hands back connections that encrypt and decrypt as they go, so the clients never know the difference.
+func listenTLS(port string, config *tls.Config, keepAlive time.Duration) (net.Listener, error) {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		return nil, err
+	}
+	// The keepalives go on the TCP connection underneath, before TLS wraps it up.
+	return tls.NewListener(keepAliveListener{l, keepAlive}, config), nil
+}
+
+// The handshake happens on the first read or write, which for us is the intro in `GenerateNewClient`.  Get it out of
+//	the way here instead, off the accept loop, so someone who connects and never says anything can't hold up everyone
+//	else.
+func (s *Server) acceptTLS(conn *tls.Conn) {
+	conn.SetDeadline(time.Now().Add(TLS_HANDSHAKE_TIMEOUT))
+	err := conn.Handshake()
+	if err != nil {
+		log.Printf("TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	// It's still telnet, just encrypted.
+	s.acceptTelnet(conn)
+}
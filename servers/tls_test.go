@@ -0,0 +1,158 @@
+package servers_test
+
+import (
+	"bufio"
+	"chat-telnet/servers"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Generate a self-signed certificate for 127.0.0.1, write it and its key out to a temp dir and point the environment at
+//	them.  Hands back a pool that trusts the certificate, for the client side of the handshake.
+func useSelfSignedCert(t *testing.T) *x509.CertPool {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"Chattington"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	setEnv(t, "TLS_CERT_FILE", certFile)
+	setEnv(t, "TLS_KEY_FILE", keyFile)
+
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return pool
+}
+
+func setEnv(t *testing.T, key, value string) {
+	os.Setenv(key, value)
+	t.Cleanup(func() { os.Unsetenv(key) })
+}
+
+func startTLSServer(t *testing.T) *servers.Server {
+	setEnv(t, "SHUTDOWN_GRACE_PERIOD", "0s")
+	s, err := servers.NewServer()
+	assert.Nil(t, err)
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	return &s
+}
+
+// `NewServer` listens on every interface, but the certificate is only good for 127.0.0.1.
+func localAddr(l net.Listener) string {
+	return fmt.Sprintf("127.0.0.1:%d", l.Addr().(*net.TCPAddr).Port)
+}
+
+func Test_TLS_round_trip(t *testing.T) {
+	pool := useSelfSignedCert(t)
+	setEnv(t, "PORT", "0")
+	setEnv(t, "TLS_PORT", "0")
+	s := startTLSServer(t)
+	// Someone who connects and never starts the handshake shouldn't hold up anyone else.
+	silent, err := net.Dial("tcp", localAddr(s.TLSListener))
+	assert.Nil(t, err)
+	defer silent.Close()
+
+	conn, err := tls.Dial("tcp", localAddr(s.TLSListener), &tls.Config{RootCAs: pool})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	readTelnetUntil(t, conn, r, "If you'd like to reset it")
+	fmt.Fprint(conn, "\\name Leia Organa\n")
+	line := readTelnetUntil(t, conn, r, "has become -> Leia Organa")
+
+	assert.Contains(t, line, ": Leia Organa> User: guest-")
+	assert.NotNil(t, s.Listener, "plaintext should still be listening alongside TLS")
+}
+
+func Test_TLS_only_turns_off_plaintext(t *testing.T) {
+	pool := useSelfSignedCert(t)
+	setEnv(t, "TLS_PORT", "0")
+	setEnv(t, "TLS_ONLY", "true")
+	s := startTLSServer(t)
+
+	conn, err := tls.Dial("tcp", localAddr(s.TLSListener), &tls.Config{RootCAs: pool})
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	readTelnetUntil(t, conn, r, "Welcome to Chattington!")
+
+	assert.Nil(t, s.Listener)
+}
+
+func Test_TLS_rejects_plaintext_clients(t *testing.T) {
+	useSelfSignedCert(t)
+	setEnv(t, "TLS_PORT", "0")
+	setEnv(t, "TLS_ONLY", "true")
+	s := startTLSServer(t)
+
+	conn, err := net.Dial("tcp", localAddr(s.TLSListener))
+	assert.Nil(t, err)
+	defer conn.Close()
+	fmt.Fprint(conn, "\\name Leia Organa\n")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response, _ := ioutil.ReadAll(conn)
+
+	assert.NotContains(t, string(response), "Welcome to Chattington!")
+}
+
+func Test_NewServer_invalid_tls_config(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		env      map[string]string
+		expected string
+	}{
+		{map[string]string{"TLS_ONLY": "maybe"}, "Invalid TLS_ONLY `maybe`: strconv.ParseBool: parsing \"maybe\": invalid syntax"},
+		{map[string]string{"TLS_ONLY": "true"}, "TLS_ONLY is set but TLS_PORT isn't"},
+		{map[string]string{"TLS_PORT": "0"}, "TLS_PORT needs both TLS_CERT_FILE and TLS_KEY_FILE to be set"},
+		{
+			map[string]string{"TLS_PORT": "0", "TLS_CERT_FILE": filepath.Join(dir, "cert.pem"), "TLS_KEY_FILE": filepath.Join(dir, "key.pem")},
+			fmt.Sprintf("Invalid TLS certificate `%s` or key `%s`: open %s: no such file or directory",
+				filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "cert.pem")),
+		},
+	}
+	for _, test := range tests {
+		for key, value := range test.env {
+			os.Setenv(key, value)
+		}
+		_, err := servers.NewServer()
+		for key := range test.env {
+			os.Unsetenv(key)
+		}
+
+		assert.Equal(t, test.expected, fmt.Sprint(err))
+	}
+}
@@ -0,0 +1,95 @@
+package servers
+
+import (
+	"chat-telnet/clients"
+	"errors"
+	"github.com/gorilla/websocket"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var upgrader = websocket.Upgrader{}
+
+// WebSocketConn wraps a websocket so the clients can treat it like any other connection.  Each message the browser
+//	sends is read back as one line, and each write goes out as one text message.
+type WebSocketConn struct {
+	ws      *websocket.Conn
+	reader  io.Reader
+	writeMu sync.Mutex // gorilla only allows one writer at a time, and broadcasts come in from all over.
+}
+
+func NewWebSocketConn(ws *websocket.Conn) *WebSocketConn {
+	return &WebSocketConn{ws: ws}
+}
+
+func (c *WebSocketConn) Read(b []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, r, err := c.ws.NextReader()
+			// A close frame from the browser is the websocket version of hanging up.
+			if _, ok := err.(*websocket.CloseError); ok {
+				return 0, io.EOF
+			}
+			if err != nil {
+				return 0, err
+			}
+			// `listen` reads line by line, so end every message with a newline.
+			c.reader = io.MultiReader(r, strings.NewReader("\n"))
+		}
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *WebSocketConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	err := c.ws.WriteMessage(websocket.TextMessage, b)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *WebSocketConn) Close() error {
+	return c.ws.Close()
+}
+
+func (c *WebSocketConn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+// Upgrade each request to a websocket and hand it off to the clients, exactly like a telnet connection.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already written an error response back for us.
+		log.Printf("Websocket upgrade failed: %v", err)
+		return
+	}
+	conn := NewWebSocketConn(ws)
+	err = clients.GenerateNewClient(conn, s.Store)
+	if err != nil {
+		log.Println(err)
+		conn.Close()
+	}
+}
+
+func (s *Server) serveWebSockets() error {
+	err := http.Serve(s.WebSocketListener, http.HandlerFunc(s.handleWebSocket))
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
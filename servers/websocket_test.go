@@ -0,0 +1,146 @@
+package servers_test
+
+import (
+	"bufio"
+	"chat-telnet/servers"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Spin up a real server, with both a telnet and a websocket listener on random local ports.
+func startTestServer(t *testing.T) *servers.Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	wsl, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := &servers.Server{Listener: l, WebSocketListener: wsl, Store: servers.NewChatStore()}
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+// Keep reading websocket messages until one of them contains `expected`.
+func readWebSocketUntil(t *testing.T, ws *websocket.Conn, expected string) string {
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, msg, err := ws.ReadMessage()
+		if !assert.Nil(t, err, "waiting on %q", expected) {
+			return ""
+		}
+		if strings.Contains(string(msg), expected) {
+			return string(msg)
+		}
+	}
+}
+
+func readTelnetUntil(t *testing.T, conn net.Conn, r *bufio.Reader, expected string) string {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		line, err := r.ReadString('\n')
+		if !assert.Nil(t, err, "waiting on %q", expected) {
+			return ""
+		}
+		if strings.Contains(line, expected) {
+			return line
+		}
+	}
+}
+
+func Test_WebSocket_round_trip(t *testing.T) {
+	s := startTestServer(t)
+
+	ws, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s/", s.WebSocketListener.Addr()), nil)
+	assert.Nil(t, err)
+	defer ws.Close()
+
+	readWebSocketUntil(t, ws, "Welcome to Chattington!")
+	ws.WriteMessage(websocket.TextMessage, []byte("\\name Leia Organa"))
+	msg := readWebSocketUntil(t, ws, "has become -> Leia Organa")
+
+	assert.Contains(t, msg, ": Leia Organa> User: guest-")
+	assert.True(t, strings.HasSuffix(msg, " has become -> Leia Organa\n"))
+}
+
+func Test_WebSocket_shares_rooms_with_telnet(t *testing.T) {
+	s := startTestServer(t)
+
+	telnet, err := net.Dial("tcp", s.Listener.Addr().String())
+	assert.Nil(t, err)
+	defer telnet.Close()
+	r := bufio.NewReader(telnet)
+	readTelnetUntil(t, telnet, r, "If you'd like to reset it")
+	fmt.Fprint(telnet, "\\name Han Solo\n")
+	readTelnetUntil(t, telnet, r, "has become -> Han Solo")
+	fmt.Fprint(telnet, "\\create falcon\n")
+	readTelnetUntil(t, telnet, r, "New room created: falcon")
+
+	ws, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s/", s.WebSocketListener.Addr()), nil)
+	assert.Nil(t, err)
+	defer ws.Close()
+	readWebSocketUntil(t, ws, "Welcome to Chattington!")
+	ws.WriteMessage(websocket.TextMessage, []byte("\\name Chewbacca"))
+	readWebSocketUntil(t, ws, "has become -> Chewbacca")
+	ws.WriteMessage(websocket.TextMessage, []byte("\\join falcon"))
+	readWebSocketUntil(t, ws, "Chewbacca has entered: falcon")
+	readTelnetUntil(t, telnet, r, "Chewbacca has entered: falcon")
+
+	fmt.Fprint(telnet, "Punch it, Chewie!\n")
+	msg := readWebSocketUntil(t, ws, "Punch it")
+	assert.True(t, strings.HasSuffix(msg, ": [falcon] Han Solo: Punch it, Chewie!\n"))
+
+	ws.WriteMessage(websocket.TextMessage, []byte("Rrraaawwr"))
+	line := readTelnetUntil(t, telnet, r, "Rrraaawwr")
+	assert.True(t, strings.HasSuffix(line, ": [falcon] Chewbacca: Rrraaawwr\n"))
+}
+
+func Test_WebSocket_close_frame_disconnects_client(t *testing.T) {
+	s := startTestServer(t)
+
+	ws, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s/", s.WebSocketListener.Addr()), nil)
+	assert.Nil(t, err)
+	readWebSocketUntil(t, ws, "Welcome to Chattington!")
+	assert.Len(t, s.Store.ListClients(), 1)
+
+	ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	ws.Close()
+
+	assert.Eventually(t, func() bool { return len(s.Store.ListClients()) == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func Test_WebSocketConn_Read_splits_messages_into_lines(t *testing.T) {
+	// Stand up our own little websocket server so we can read from the wrapped connection directly.
+	conns := make(chan *servers.WebSocketConn, 1)
+	upgrader := websocket.Upgrader{}
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, _ := upgrader.Upgrade(w, r, nil)
+		conns <- servers.NewWebSocketConn(ws)
+	}))
+	defer hs.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial(strings.Replace(hs.URL, "http", "ws", 1), nil)
+	assert.Nil(t, err)
+	defer ws.Close()
+	ws.WriteMessage(websocket.TextMessage, []byte("Ahoy!"))
+	ws.WriteMessage(websocket.TextMessage, []byte("\\list"))
+	ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+
+	conn := <-conns
+	r := bufio.NewReader(conn)
+	line1, err1 := r.ReadString('\n')
+	line2, err2 := r.ReadString('\n')
+	_, err3 := r.ReadString('\n')
+
+	assert.Equal(t, "Ahoy!\n", line1)
+	assert.Nil(t, err1)
+	assert.Equal(t, "\\list\n", line2)
+	assert.Nil(t, err2)
+	assert.Equal(t, io.EOF, err3)
+}